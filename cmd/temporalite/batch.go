@@ -0,0 +1,395 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	batchpb "go.temporal.io/api/batch/v1"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/server/api/adminservice/v1"
+	"go.temporal.io/server/common/persistence/visibility/store/elasticsearch"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	dryRunFlag = "dry-run"
+
+	// batchConcurrency is the number of workflows operated on at a time by client-side
+	// batch operations.
+	batchConcurrency = 8
+	// batchProgressInterval is how often the progress of batch operations is printed.
+	batchProgressInterval = time.Second
+)
+
+// batchOperation is an operation applied to all workflows matching a visibility query.
+type batchOperation struct {
+	// verb and done describe the operation in messages, eg. "terminate" and "terminated".
+	verb, done string
+	// runningOnly is set for operations that only apply to running workflows.
+	runningOnly bool
+	// setOperation sets the operation of a batch operations API request.
+	setOperation func(c *cli.Context, req *workflowservice.StartBatchOperationRequest, input *commonpb.Payloads)
+	// apply applies the operation to a single workflow when the server doesn't support the
+	// batch operations API.
+	apply func(c *cli.Context, ws *workflowService, execution *commonpb.WorkflowExecution, input *commonpb.Payloads) error
+}
+
+func newWorkflowBatchCommand() *cli.Command {
+	operations := []struct {
+		name, usage string
+		flags       []cli.Flag
+		op          batchOperation
+	}{
+		{
+			name:  "terminate",
+			usage: "Terminate running workflows matching a query",
+			op: batchOperation{
+				verb:        "terminate",
+				done:        "terminated",
+				runningOnly: true,
+				setOperation: func(c *cli.Context, req *workflowservice.StartBatchOperationRequest, _ *commonpb.Payloads) {
+					req.Operation = &workflowservice.StartBatchOperationRequest_TerminationOperation{
+						TerminationOperation: &batchpb.BatchOperationTermination{Identity: cliIdentity()},
+					}
+				},
+				apply: func(c *cli.Context, ws *workflowService, execution *commonpb.WorkflowExecution, _ *commonpb.Payloads) error {
+					_, err := ws.client.TerminateWorkflowExecution(c.Context, &workflowservice.TerminateWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: execution,
+						Reason:            c.String(reasonFlag),
+						Identity:          cliIdentity(),
+					})
+					return err
+				},
+			},
+		},
+		{
+			name:  "cancel",
+			usage: "Request running workflows matching a query to cancel",
+			op: batchOperation{
+				verb:        "cancel",
+				done:        "canceled",
+				runningOnly: true,
+				setOperation: func(c *cli.Context, req *workflowservice.StartBatchOperationRequest, _ *commonpb.Payloads) {
+					req.Operation = &workflowservice.StartBatchOperationRequest_CancellationOperation{
+						CancellationOperation: &batchpb.BatchOperationCancellation{Identity: cliIdentity()},
+					}
+				},
+				apply: func(c *cli.Context, ws *workflowService, execution *commonpb.WorkflowExecution, _ *commonpb.Payloads) error {
+					_, err := ws.client.RequestCancelWorkflowExecution(c.Context, &workflowservice.RequestCancelWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: execution,
+						Identity:          cliIdentity(),
+						RequestId:         uuid.NewString(),
+						Reason:            c.String(reasonFlag),
+					})
+					return err
+				},
+			},
+		},
+		{
+			name:  "signal",
+			usage: "Send a signal to running workflows matching a query",
+			flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     nameFlag,
+					Usage:    "signal name",
+					Required: true,
+				},
+				newInputFlag("signal argument"),
+			},
+			op: batchOperation{
+				verb:        "signal",
+				done:        "signaled",
+				runningOnly: true,
+				setOperation: func(c *cli.Context, req *workflowservice.StartBatchOperationRequest, input *commonpb.Payloads) {
+					req.Operation = &workflowservice.StartBatchOperationRequest_SignalOperation{
+						SignalOperation: &batchpb.BatchOperationSignal{
+							Signal:   c.String(nameFlag),
+							Input:    input,
+							Identity: cliIdentity(),
+						},
+					}
+				},
+				apply: func(c *cli.Context, ws *workflowService, execution *commonpb.WorkflowExecution, input *commonpb.Payloads) error {
+					_, err := ws.client.SignalWorkflowExecution(c.Context, &workflowservice.SignalWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: execution,
+						SignalName:        c.String(nameFlag),
+						Input:             input,
+						Identity:          cliIdentity(),
+						RequestId:         uuid.NewString(),
+					})
+					return err
+				},
+			},
+		},
+		{
+			name:  "delete",
+			usage: "Delete workflows matching a query along with their histories, terminating running ones",
+			op: batchOperation{
+				verb: "delete",
+				done: "deleted",
+				setOperation: func(c *cli.Context, req *workflowservice.StartBatchOperationRequest, _ *commonpb.Payloads) {
+					req.Operation = &workflowservice.StartBatchOperationRequest_DeletionOperation{
+						DeletionOperation: &batchpb.BatchOperationDeletion{Identity: cliIdentity()},
+					}
+				},
+				apply: func(c *cli.Context, ws *workflowService, execution *commonpb.WorkflowExecution, _ *commonpb.Payloads) error {
+					_, err := ws.client.DeleteWorkflowExecution(c.Context, &workflowservice.DeleteWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: execution,
+					})
+					return err
+				},
+			},
+		},
+	}
+
+	var subcommands []*cli.Command
+	for _, o := range operations {
+		op := o.op
+		subcommands = append(subcommands, &cli.Command{
+			Name:      o.name,
+			Usage:     o.usage,
+			ArgsUsage: " ",
+			Flags: append(append(newWorkflowTargetFlags(),
+				&cli.StringFlag{
+					Name:     queryFlag,
+					Aliases:  []string{"q"},
+					Usage:    "visibility query selecting the workflows, eg. \"WorkflowType='Greet'\"",
+					Required: true,
+				},
+				&cli.BoolFlag{
+					Name:  dryRunFlag,
+					Usage: "only print the number of workflows the operation would apply to",
+				},
+				newReasonFlag(),
+			), o.flags...),
+			BashComplete: completeWorkflowFlags,
+			Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+				return runBatchOperation(c, ws, op)
+			}),
+		})
+	}
+	return &cli.Command{
+		Name:        "batch",
+		Usage:       "Terminate, cancel, signal or delete all workflows matching a visibility query",
+		Subcommands: subcommands,
+	}
+}
+
+func runBatchOperation(c *cli.Context, ws *workflowService, op batchOperation) error {
+	query := c.String(queryFlag)
+	serverSide := ws.supportsBatchOperations(c.Context)
+	if c.Bool(dryRunFlag) {
+		count, err := ws.countBatchTargets(c.Context, query, op.runningOnly, serverSide)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("ERROR: unable to count workflows: %v", err), 1)
+		}
+		fmt.Fprintf(c.App.Writer, "Would %s %d workflows in namespace %q\n", op.verb, count, ws.namespace)
+		return nil
+	}
+
+	input, err := inputPayloads(c)
+	if err != nil {
+		return err
+	}
+	if serverSide {
+		jobID := uuid.NewString()
+		req := &workflowservice.StartBatchOperationRequest{
+			Namespace:       ws.namespace,
+			VisibilityQuery: batchQuery(query, op.runningOnly),
+			JobId:           jobID,
+			Reason:          c.String(reasonFlag),
+		}
+		op.setOperation(c, req, input)
+		_, err = ws.client.StartBatchOperation(c.Context, req)
+		switch {
+		case err == nil:
+			fmt.Fprintf(c.App.Writer, "Started batch job %s\n", jobID)
+			return ws.waitForBatchJob(c, jobID, op)
+		case status.Code(err) != codes.Unimplemented:
+			return cli.Exit(fmt.Sprintf("ERROR: unable to start batch job: %v", err), 1)
+		}
+	}
+
+	// The server doesn't support batch operations, eg. with SQLite visibility, so go through
+	// the workflows here. They are all listed first as the operation changes
+	// which workflows match the query.
+	targets, err := ws.batchTargets(c.Context, query, op.runningOnly)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to list workflows: %v", err), 1)
+	}
+	var (
+		mu        sync.Mutex
+		completed int
+		failed    int
+		wg        sync.WaitGroup
+		work      = make(chan *commonpb.WorkflowExecution)
+		progress  = time.NewTicker(batchProgressInterval)
+	)
+	defer progress.Stop()
+	report := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(c.App.Writer, "%s %d of %d workflows, %d failed\n", capitalize(op.done), completed, len(targets), failed)
+	}
+	for i := 0; i < batchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for execution := range work {
+				err := op.apply(c, ws, execution, input)
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(c.App.ErrWriter, "Unable to %s workflow %q (run %s): %v\n", op.verb, execution.GetWorkflowId(), execution.GetRunId(), err)
+				} else {
+					completed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, execution := range targets {
+		select {
+		case work <- execution:
+		case <-progress.C:
+			report()
+			work <- execution
+		}
+	}
+	close(work)
+	wg.Wait()
+	report()
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to %s %d workflows", op.verb, failed), 1)
+	}
+	return nil
+}
+
+// supportsBatchOperations reports whether the server's visibility store supports batch
+// operations, which servers of this version only do with Elasticsearch.
+//
+// Servers that don't let the CLI find out are assumed to support them.
+func (ws *workflowService) supportsBatchOperations(ctx context.Context) bool {
+	resp, err := adminservice.NewAdminServiceClient(ws.conn).DescribeCluster(ctx, &adminservice.DescribeClusterRequest{})
+	if err != nil {
+		return true
+	}
+	return resp.GetVisibilityStore() == elasticsearch.PersistenceName
+}
+
+// batchQuery returns the visibility query selecting the workflows a batch operation applies to.
+func batchQuery(query string, runningOnly bool) string {
+	if !runningOnly {
+		return query
+	}
+	return fmt.Sprintf("(%s) AND ExecutionStatus='Running'", query)
+}
+
+// batchTargets lists the workflows a batch operation applies to.
+//
+// Running workflows are filtered here as SQLite visibility doesn't support the query of
+// batchQuery.
+func (ws *workflowService) batchTargets(ctx context.Context, query string, runningOnly bool) ([]*commonpb.WorkflowExecution, error) {
+	list, err := ws.list(ctx, query, 0)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*commonpb.WorkflowExecution
+	for _, e := range list {
+		if runningOnly && e.Status != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING.String() {
+			continue
+		}
+		targets = append(targets, &commonpb.WorkflowExecution{WorkflowId: e.WorkflowID, RunId: e.RunID})
+	}
+	return targets, nil
+}
+
+// countBatchTargets counts the workflows a batch operation applies to, with the query of the
+// batch job when the server runs it.
+func (ws *workflowService) countBatchTargets(ctx context.Context, query string, runningOnly, serverSide bool) (int64, error) {
+	if serverSide {
+		resp, err := ws.client.CountWorkflowExecutions(ctx, &workflowservice.CountWorkflowExecutionsRequest{
+			Namespace: ws.namespace,
+			Query:     batchQuery(query, runningOnly),
+		})
+		if err == nil || status.Code(err) != codes.Unimplemented {
+			return resp.GetCount(), err
+		}
+	}
+	targets, err := ws.batchTargets(ctx, query, runningOnly)
+	return int64(len(targets)), err
+}
+
+// waitForBatchJob prints the progress of a batch job until it finishes.
+func (ws *workflowService) waitForBatchJob(c *cli.Context, jobID string, op batchOperation) error {
+	ticker := time.NewTicker(batchProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Context.Done():
+			return c.Context.Err()
+		case <-ticker.C:
+		}
+		resp, err := ws.client.DescribeBatchOperation(c.Context, &workflowservice.DescribeBatchOperationRequest{
+			Namespace: ws.namespace,
+			JobId:     jobID,
+		})
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("ERROR: unable to describe batch job %s: %v", jobID, err), 1)
+		}
+		fmt.Fprintf(c.App.Writer, "%s %d of %d workflows, %d failed\n", capitalize(op.done), resp.GetCompleteOperationCount(), resp.GetTotalOperationCount(), resp.GetFailureOperationCount())
+		switch resp.GetState() {
+		case enumspb.BATCH_OPERATION_STATE_RUNNING:
+		case enumspb.BATCH_OPERATION_STATE_COMPLETED:
+			if failed := resp.GetFailureOperationCount(); failed > 0 {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to %s %d workflows", op.verb, failed), 1)
+			}
+			return nil
+		default:
+			return cli.Exit(fmt.Sprintf("ERROR: batch job %s is %s", jobID, resp.GetState()), 1)
+		}
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,173 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestWorkflowBatchCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dir := filepath.Join(t.TempDir(), "state")
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite", "workflow"}, args...))
+		return out.String(), err
+	}
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--data-dir", dir)
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	_, clientOpts := newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+
+	clientOpts.Namespace = "default"
+	c, err := client.Dial(clientOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w := worker.New(c, "batch-test", worker.Options{})
+	w.RegisterWorkflowWithOptions(waitForGreeting, workflow.RegisterOptions{Name: "waitForGreeting"})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	startWorkflows := func(workflowType string, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := run("start", "--data-dir", dir, "--type", workflowType, "-t", "batch-test", "--input", `"Temporalite"`); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Visibility is updated asynchronously, poll it slowly enough not to be rate limited.
+	waitForCount := func(verb string, count int, query string) {
+		want := fmt.Sprintf("Would %s %d workflows", verb, count)
+		for {
+			out, err := run("batch", verb, "--data-dir", dir, "--query", query, "--dry-run")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out, want) {
+				return
+			}
+			if ctx.Err() != nil {
+				t.Fatalf("expected %q, got %q", want, out)
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	startWorkflows("waitForGreeting", 5)
+	startWorkflows("other", 1)
+	waitForCount("terminate", 5, "WorkflowType='waitForGreeting'")
+	out, err := run("batch", "signal", "--data-dir", dir, "--query", "WorkflowType='waitForGreeting'", "--name", "greet", "--input", `"Hello"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Signaled 5 of 5 workflows, 0 failed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	waitForCount("terminate", 0, "WorkflowType='waitForGreeting'")
+
+	// Closed workflows are skipped.
+	startWorkflows("waitForGreeting", 3)
+	waitForCount("terminate", 3, "WorkflowType='waitForGreeting'")
+	if _, err := run("batch", "cancel", "--data-dir", dir, "--query", "WorkflowType='waitForGreeting'"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run("batch", "terminate", "--data-dir", dir, "--query", "WorkflowType='waitForGreeting'", "--reason", "load test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Terminated 3 of 3 workflows, 0 failed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	waitForCount("delete", 8, "WorkflowType='waitForGreeting'")
+	out, err = run("batch", "delete", "--data-dir", dir, "--query", "WorkflowType='waitForGreeting'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Deleted 8 of 8 workflows, 0 failed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	waitForCount("delete", 1, "WorkflowType='other'")
+
+	if _, err := run("batch", "terminate", "--data-dir", dir); err == nil {
+		t.Error("expected error without a query")
+	}
+}
+
+func TestBatchQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query       string
+		runningOnly bool
+		expected    string
+	}{
+		{query: "WorkflowType='Greet'", expected: "WorkflowType='Greet'"},
+		{query: "WorkflowType='Greet' OR WorkflowType='Other'", runningOnly: true, expected: "(WorkflowType='Greet' OR WorkflowType='Other') AND ExecutionStatus='Running'"},
+	} {
+		if q := batchQuery(tc.query, tc.runningOnly); q != tc.expected {
+			t.Errorf("expected query %q, got %q", tc.expected, q)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// completionTimeout bounds the requests made to the server to complete namespace names and
+// workflow IDs, so that completing never hangs a shell.
+const completionTimeout = time.Second
+
+// Completion scripts ask the CLI for completions by calling it with the arguments typed so
+// far followed by --generate-bash-completion, like the scripts shipped with urfave/cli.
+var completionScripts = map[string]string{
+	"bash": `_temporalite_bash_complete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion 2>/dev/null )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion 2>/dev/null )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+
+complete -o bashdefault -o default -o nospace -F _temporalite_bash_complete temporalite
+`,
+	"zsh": `#compdef temporalite
+
+_temporalite_zsh_complete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _temporalite_zsh_complete temporalite
+`,
+	"fish": `function __temporalite_complete
+  set -l args (commandline -opc)
+  set -l cur (commandline -ct)
+  if string match -q -- '-*' $cur
+    $args $cur --generate-bash-completion 2>/dev/null
+  else
+    $args --generate-bash-completion 2>/dev/null
+  end
+end
+
+complete -c temporalite -f -a '(__temporalite_complete)'
+`,
+}
+
+func newCompletionCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "completion",
+		Usage: "Print the shell completion script for bash, zsh or fish",
+		Description: `Load completions in the current shell with:
+
+   source <(temporalite completion bash)
+   source <(temporalite completion zsh)
+   temporalite completion fish | source
+
+or add the line to ~/.bashrc, ~/.zshrc or ~/.config/fish/config.fish to load them in every shell.`,
+		ArgsUsage: "bash|zsh|fish",
+		Before: func(c *cli.Context) error {
+			if _, ok := completionScripts[c.Args().First()]; c.Args().Len() != 1 || !ok {
+				return cli.Exit(fmt.Sprintf("ERROR: %s command requires one of bash, zsh or fish as its only argument.", c.Command.Name), 1)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			_, err := fmt.Fprint(c.App.Writer, completionScripts[c.Args().First()])
+			return err
+		},
+		BashComplete: func(c *cli.Context) {
+			for _, shell := range []string{"bash", "fish", "zsh"} {
+				fmt.Fprintln(c.App.Writer, shell)
+			}
+		},
+	}
+}
+
+// completeNamespaceArgs completes the names of the namespaces of the server or database
+// file selected by the flags of namespace commands.
+func completeNamespaceArgs(c *cli.Context) {
+	complete(c, namespaceNames)
+}
+
+// completeWorkflowArgs completes the IDs of the most recent workflows of the server selected
+// by the flags of workflow commands.
+func completeWorkflowArgs(c *cli.Context) {
+	complete(c, workflowIDs)
+}
+
+// completeWorkflowFlags completes flag names of workflow commands and the namespaces and
+// workflow IDs passed to their flags.
+func completeWorkflowFlags(c *cli.Context) {
+	complete(c, nil)
+}
+
+// complete prints the values of the flag being completed when it names a namespace or a
+// workflow, the names of flags when a flag is being completed, and the values returned by
+// args otherwise.
+func complete(c *cli.Context, args func(context.Context, *cli.Context) ([]string, error)) {
+	var last string
+	// Like urfave/cli's completion of flag names, look at the arguments before
+	// --generate-bash-completion, which are not available once parsed.
+	if len(os.Args) > 2 {
+		last = os.Args[len(os.Args)-2]
+	}
+	switch last {
+	case "--" + namespaceFlag, "-n":
+		args = namespaceNames
+	case "--" + workflowIDFlag, "--id", "-w":
+		args = workflowIDs
+	default:
+		if strings.HasPrefix(last, "-") {
+			cli.DefaultCompleteWithFlags(c.Command)(c)
+			return
+		}
+	}
+	if args == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context, completionTimeout)
+	defer cancel()
+	values, err := args(ctx, c)
+	if err != nil {
+		return
+	}
+	for _, value := range values {
+		fmt.Fprintln(c.App.Writer, value)
+	}
+}
+
+func namespaceNames(ctx context.Context, c *cli.Context) ([]string, error) {
+	m, err := openNamespaceManager(c)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	list, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list))
+	for _, ns := range list {
+		names = append(names, ns.Name)
+	}
+	return names, nil
+}
+
+// completedWorkflows is the number of most recently started workflows whose IDs are completed.
+const completedWorkflows = 100
+
+func workflowIDs(ctx context.Context, c *cli.Context) ([]string, error) {
+	ws, err := dialWorkflowService(c)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.conn.Close()
+	list, err := ws.list(ctx, "", completedWorkflows)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, w := range list {
+		if !seen[w.WorkflowID] {
+			seen[w.WorkflowID] = true
+			ids = append(ids, w.WorkflowID)
+		}
+	}
+	return ids, nil
+}
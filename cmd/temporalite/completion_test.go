@@ -0,0 +1,70 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCompletionCommand(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.Run(append([]string{"temporalite"}, args...))
+		return out.String(), err
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		out, err := run("completion", shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "--generate-bash-completion") || !strings.Contains(out, "temporalite") {
+			t.Errorf("unexpected %s completion script:\n%s", shell, out)
+		}
+	}
+	if _, err := run("completion", "powershell"); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+
+	// Completion looks at the raw arguments like urfave/cli does
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"temporalite", "workflow", "--generate-bash-completion"}
+	out, err := run(os.Args[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "show\n") || !strings.Contains(out, "batch\n") {
+		t.Errorf("expected workflow subcommands to be completed, got %q", out)
+	}
+}
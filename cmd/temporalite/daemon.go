@@ -0,0 +1,287 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+const (
+	timeoutFlag = "timeout"
+
+	// detachTimeout bounds how long start --detach waits for the server to be ready.
+	detachTimeout = time.Minute
+	// statusHealthTimeout bounds the health check made by the status command.
+	statusHealthTimeout = 5 * time.Second
+)
+
+// Statuses reported by the status command.
+const (
+	statusRunning   = "running"
+	statusUnhealthy = "unhealthy"
+	statusStopped   = "stopped"
+)
+
+// serverStatus is the report printed by the status command.
+type serverStatus struct {
+	Status string `json:"status"`
+	*datadir.State
+	Uptime string `json:"uptime,omitempty"`
+}
+
+func newStatusCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "status",
+		Usage:     "Report whether the server using a data directory is running and healthy",
+		ArgsUsage: " ",
+		Flags:     append(append(newServerDirFlags(), newOutputFlag()), newClientTLSFlags()...),
+		Before:    checkOutputFlag,
+		Action: func(c *cli.Context) error {
+			dir, err := serverDataDir(c)
+			if err != nil {
+				return err
+			}
+			state, err := dir.ReadState()
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to read server state: %v", err), 1)
+			}
+
+			status := serverStatus{Status: statusStopped}
+			if state != nil && process.Exists(state.PID) {
+				status.State = state
+				status.Uptime = time.Since(state.StartedAt).Round(time.Second).String()
+				ctx, cancel := context.WithTimeout(c.Context, statusHealthTimeout)
+				defer cancel()
+				clientTLS := flagsClientTLS(c)
+				if clientTLS == nil {
+					clientTLS = state.TLS
+				}
+				if err := checkFrontendHealth(ctx, state.FrontendAddress, clientTLS); err != nil {
+					status.Status = statusUnhealthy
+				} else {
+					status.Status = statusRunning
+				}
+			}
+
+			if c.String(outputFlag) == "json" {
+				err = writeJSON(c.App.Writer, status)
+			} else {
+				err = writeServerStatus(c.App.Writer, status)
+			}
+			if err != nil {
+				return err
+			}
+
+			// Mirror the exit codes of service managers so scripts can tell the cases apart.
+			switch status.Status {
+			case statusStopped:
+				return cli.Exit("", 3)
+			case statusUnhealthy:
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func newStopCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "stop",
+		Usage:     "Gracefully stop the server using a data directory",
+		ArgsUsage: " ",
+		Flags: append(newServerDirFlags(), &cli.DurationFlag{
+			Name:  timeoutFlag,
+			Usage: "how long to wait for the server to stop",
+			Value: 30 * time.Second,
+		}),
+		Action: func(c *cli.Context) error {
+			dir, err := serverDataDir(c)
+			if err != nil {
+				return err
+			}
+			state, err := dir.ReadState()
+			if errors.Is(err, fs.ErrNotExist) {
+				fmt.Fprintln(c.App.Writer, "Temporalite is not running")
+				return nil
+			} else if err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to read server state: %v", err), 1)
+			}
+			if !process.Exists(state.PID) {
+				// Left behind by a server that did not shut down gracefully.
+				if err := dir.RemoveState(); err != nil {
+					return cli.Exit(fmt.Sprintf("ERROR: unable to remove stale server state: %v", err), 1)
+				}
+				fmt.Fprintln(c.App.Writer, "Temporalite is not running")
+				return nil
+			}
+
+			// The server handles the request like an interrupt from the terminal it was started in.
+			if err := dir.RequestStop(state.PID); err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to stop server (pid %d): %v", state.PID, err), 1)
+			}
+			deadline := time.Now().Add(c.Duration(timeoutFlag))
+			for process.Exists(state.PID) {
+				if time.Now().After(deadline) {
+					return cli.Exit(fmt.Sprintf("ERROR: server (pid %d) did not stop within %s", state.PID, c.Duration(timeoutFlag)), 1)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			fmt.Fprintf(c.App.Writer, "Stopped Temporalite (pid %d)\n", state.PID)
+			return nil
+		},
+	}
+}
+
+// newServerDirFlags returns the flags selecting the data directory of the server a command acts on.
+func newServerDirFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  dataDirFlag,
+			Usage: "data directory the server was started with",
+		},
+		&cli.StringFlag{
+			Name:  profileFlag,
+			Usage: "profile the server was started with",
+		},
+	}
+}
+
+// serverDataDir returns the data directory selected by the flags from newServerDirFlags.
+func serverDataDir(c *cli.Context) (datadir.Dir, error) {
+	switch {
+	case c.IsSet(dataDirFlag) && c.IsSet(profileFlag):
+		return "", cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", dataDirFlag, profileFlag), 1)
+	case c.IsSet(dataDirFlag):
+		return datadir.Dir(c.String(dataDirFlag)), nil
+	case c.IsSet(profileFlag):
+		p, err := loadProfile(c.String(profileFlag))
+		if err != nil {
+			return "", err
+		}
+		return datadir.Dir(p.DataDir), nil
+	default:
+		return "", cli.Exit(fmt.Sprintf("ERROR: %s command requires %q or %q", c.Command.Name, dataDirFlag, profileFlag), 1)
+	}
+}
+
+// startDetached runs the start command with the same flags, minus the detach flag, in a
+// background process and waits for it to record its state in dir and serve.
+func startDetached(c *cli.Context, dir datadir.Dir) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to start server in the background: %v", err), 1)
+	}
+	args := []string{c.Command.Name}
+	for _, f := range c.Command.Flags {
+		name := f.Names()[0]
+		if name == detachFlag || !c.IsSet(name) {
+			continue
+		}
+		switch f.(type) {
+		case *cli.StringSliceFlag:
+			for _, v := range c.StringSlice(name) {
+				args = append(args, "--"+name, v)
+			}
+		case *cli.BoolFlag:
+			args = append(args, fmt.Sprintf("--%s=%t", name, c.Bool(name)))
+		default:
+			args = append(args, "--"+name, fmt.Sprint(c.Value(name)))
+		}
+	}
+
+	// The server's output is kept for troubleshooting startup failures, its logs are also
+	// written to the data directory's log file.
+	stderr, err := openLogFile(dir.StderrFile())
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to open server output file: %v", err), 1)
+	}
+	defer func() { _ = stderr.Close() }()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stderr = stderr
+	process.Detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to start server in the background: %v", err), 1)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(detachTimeout)
+	for {
+		select {
+		case err := <-exited:
+			return cli.Exit(fmt.Sprintf("ERROR: server exited during startup (%v), see %s", err, dir.StderrFile()), 1)
+		case <-timeout:
+			_ = process.Terminate(cmd.Process.Pid)
+			return cli.Exit(fmt.Sprintf("ERROR: server did not start within %s, see %s", detachTimeout, dir.StderrFile()), 1)
+		case <-ticker.C:
+			// A state file written by an earlier server may still be around.
+			if state, err := dir.ReadState(); err == nil && state.PID == cmd.Process.Pid {
+				selector := fmt.Sprintf("--%s %s", dataDirFlag, dir)
+				if c.IsSet(profileFlag) {
+					selector = fmt.Sprintf("--%s %s", profileFlag, c.String(profileFlag))
+				}
+				fmt.Fprintf(c.App.Writer, "Temporalite is running in the background (pid %d), stop it with: temporalite stop %s\n", state.PID, selector)
+				return writeServerStatus(c.App.Writer, serverStatus{Status: statusRunning, State: state})
+			}
+		}
+	}
+}
+
+func writeServerStatus(w io.Writer, s serverStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Status:\t%s\n", s.Status)
+	if s.State != nil {
+		fmt.Fprintf(tw, "PID:\t%d\n", s.PID)
+		fmt.Fprintf(tw, "Version:\t%s (server %s)\n", s.Version, s.ServerVersion)
+		fmt.Fprintf(tw, "Frontend:\t%s\n", s.FrontendAddress)
+		if s.UIAddress != "" {
+			fmt.Fprintf(tw, "UI:\t%s\n", s.UIAddress)
+		}
+		fmt.Fprintf(tw, "Metrics and health:\t%s\n", s.MetricsAddress)
+		if s.HTTPAddress != "" {
+			fmt.Fprintf(tw, "HTTP API:\t%s\n", s.HTTPAddress)
+		}
+		fmt.Fprintf(tw, "Started:\t%s\n", s.StartedAt.Format(time.RFC3339))
+		if s.Uptime != "" {
+			fmt.Fprintf(tw, "Uptime:\t%s\n", s.Uptime)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,267 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+func TestDetach(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	dataDir := t.TempDir()
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port        = portProvider.MustGetFreePort()
+		uiPort      = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+		httpPort    = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite"}, args...))
+		return out.String(), err
+	}
+	exitCode := func(err error) int {
+		var exitErr cli.ExitCoder
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return -1
+	}
+	status := func() (serverStatus, int) {
+		out, err := run("status", "--data-dir", dataDir, "--output", "json")
+		var s serverStatus
+		if jsonErr := json.Unmarshal([]byte(out), &s); jsonErr != nil {
+			t.Fatalf("unable to decode status %q: %v", out, jsonErr)
+		}
+		if err != nil {
+			return s, exitCode(err)
+		}
+		return s, 0
+	}
+
+	if _, err := run("start", "--detach", "--headless"); err == nil || !strings.Contains(err.Error(), dataDirFlag) {
+		t.Errorf("expected error requiring a data directory, got %v", err)
+	}
+	if s, code := status(); s.Status != statusStopped || code != 3 {
+		t.Errorf("expected stopped status and exit code 3 before start, got %q and %d", s.Status, code)
+	}
+
+	// Detaching is done by the CLI's own process, run it from the test binary. The UI is
+	// enabled as stopping the server must not exit the process before its state is removed.
+	_, clientOpts := newServerAndClientOpts(port)
+	cmd := exec.CommandContext(ctx, os.Args[0], "start", "--detach", "--data-dir", dataDir,
+		"--namespace", "default", "--log-format", "noop", "--port", strconv.Itoa(port), "--ui-port", strconv.Itoa(uiPort),
+		"--metrics-port", strconv.Itoa(metricsPort), "--http-port", strconv.Itoa(httpPort))
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("start --detach failed: %v: %s", err, out)
+	}
+	if !strings.Contains(string(out), "running in the background") {
+		t.Errorf("unexpected start --detach output: %s", out)
+	}
+	t.Cleanup(func() { _, _ = run("stop", "--data-dir", dataDir) })
+
+	s, code := status()
+	if s.Status != statusRunning || code != 0 {
+		t.Fatalf("expected running status and exit code 0, got %q and %d", s.Status, code)
+	}
+	if s.State == nil || s.PID == os.Getpid() || !process.Exists(s.PID) {
+		t.Fatalf("expected status to report the background process, got %+v", s.State)
+	}
+	if s.FrontendAddress != clientOpts.HostPort && !strings.HasSuffix(s.FrontendAddress, ":"+strconv.Itoa(port)) {
+		t.Errorf("unexpected frontend address %q", s.FrontendAddress)
+	}
+	if !strings.HasSuffix(s.MetricsAddress, ":"+strconv.Itoa(metricsPort)) || !strings.HasSuffix(s.HTTPAddress, ":"+strconv.Itoa(httpPort)) {
+		t.Errorf("unexpected metrics and HTTP API addresses %q and %q", s.MetricsAddress, s.HTTPAddress)
+	}
+	assertServerHealth(t, ctx, clientOpts)
+
+	out2, err := run("stop", "--data-dir", dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out2, "Stopped") {
+		t.Errorf("unexpected stop output: %s", out2)
+	}
+	if process.Exists(s.PID) {
+		t.Errorf("expected process %d to be stopped", s.PID)
+	}
+	// The state file is only removed by a graceful shutdown.
+	if _, err := datadir.Dir(dataDir).ReadState(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected state file to be removed, got %v", err)
+	}
+	if s, code := status(); s.Status != statusStopped || code != 3 {
+		t.Errorf("expected stopped status and exit code 3 after stop, got %q and %d", s.Status, code)
+	}
+	if out2, err := run("stop", "--data-dir", dataDir); err != nil || !strings.Contains(out2, "not running") {
+		t.Errorf("expected stopping a stopped server to succeed, got %q, %v", out2, err)
+	}
+}
+
+func TestDetachDefaultPorts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	dataDir := t.TempDir()
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	// Only the frontend port is passed, the metrics port is chosen when the server starts.
+	cmd := exec.CommandContext(ctx, os.Args[0], "start", "--detach", "--data-dir", dataDir, "--headless",
+		"--log-format", "noop", "--port", strconv.Itoa(port))
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("start --detach failed: %v: %s", err, out)
+	}
+	t.Cleanup(func() {
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		temporaliteCLI.Writer = io.Discard
+		_ = temporaliteCLI.RunContext(context.Background(), []string{"temporalite", "stop", "--data-dir", dataDir})
+	})
+
+	state, err := datadir.Dir(dataDir).ReadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, metricsPort, err := net.SplitHostPort(state.MetricsAddress)
+	if err != nil || metricsPort == "0" {
+		t.Fatalf("expected the chosen metrics port to be recorded, got %q", state.MetricsAddress)
+	}
+	if state.HTTPAddress != "" {
+		t.Errorf("expected no HTTP API address without --http-port, got %q", state.HTTPAddress)
+	}
+
+	// The worker service may not poll yet when the frontend serves and start returns.
+	readyURL := "http://" + state.MetricsAddress + "/readyz"
+	for {
+		res, err := http.Get(readyURL)
+		if err == nil {
+			_ = res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("%s never became ready: %v", readyURL, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestStatusTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dataDir, confDir := t.TempDir(), t.TempDir()
+	writeMTLSConfig(t, confDir, "temporalite.yaml")
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--data-dir", dataDir, "--config", confDir)
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	var state *datadir.State
+	for {
+		var err error
+		if state, err = datadir.Dir(dataDir).ReadState(); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if state.TLS == nil {
+		t.Fatal("expected state to record the client TLS material")
+	}
+	tlsConfig, err := newClientTLSConfig(state.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientOpts := newServerAndClientOpts(port)
+	clientOpts.ConnectionOptions.TLS = tlsConfig
+	assertServerHealth(t, ctx, clientOpts)
+
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	var out bytes.Buffer
+	temporaliteCLI.Writer = &out
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "status", "--data-dir", dataDir, "--output", "json"}); err != nil {
+		t.Fatalf("status failed: %v: %s", err, out.String())
+	}
+	var s serverStatus
+	if err := json.Unmarshal(out.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != statusRunning {
+		t.Errorf("expected running status, got %q", s.Status)
+	}
+}
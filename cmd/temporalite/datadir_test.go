@@ -0,0 +1,236 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/server/common/headers"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestDataDir(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dir := datadir.Dir(filepath.Join(t.TempDir(), "project", "state"))
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--data-dir", string(dir), "--log-format", "json")
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+
+	_, clientOpts := newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+
+	for _, path := range []string{dir.DatabaseFile(), dir.DatabaseFile() + ".lock", dir.HistoryArchivalDir(), dir.VisibilityArchivalDir()} {
+		if _, err := os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+	m, err := dir.ReadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CreatedWith.Server != headers.ServerVersion || m.LastStartedWith.Server != headers.ServerVersion {
+		t.Errorf("expected server version %s in metadata, got %+v", headers.ServerVersion, m)
+	}
+
+	runEnv := func() (string, error) {
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "env", "--data-dir", string(dir)})
+		return out.String(), err
+	}
+	out, err := runEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("export TEMPORAL_ADDRESS='127.0.0.1:%d'\nexport TEMPORAL_NAMESPACE='default'\n", port); out != expected {
+		t.Errorf("expected env output %q, got %q", expected, out)
+	}
+
+	stopServer()
+	<-done
+
+	if _, err := runEnv(); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Errorf("expected env to fail once the server stopped, got %v", err)
+	}
+
+	if _, err := os.Stat(dir.DatabaseFile() + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected lock file to be removed, got %v", err)
+	}
+	logs, err := os.ReadFile(dir.LogFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Error("expected server logs in data directory")
+	}
+
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	args, _ := newServerAndClientOpts(port, "--data-dir", string(dir), "--ephemeral")
+	if err := temporaliteCLI.RunContext(ctx, args); err == nil {
+		t.Error("expected error combining --data-dir and --ephemeral")
+	}
+}
+
+func TestDataDirTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dir := datadir.Dir(t.TempDir())
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port     = portProvider.MustGetFreePort()
+		httpPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--data-dir", string(dir), "--tls", "--http-port", strconv.Itoa(httpPort))
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	var state *datadir.State
+	for {
+		var err error
+		if state, err = dir.ReadState(); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if state.TLS == nil {
+		t.Fatal("expected state to record the generated TLS material")
+	}
+	for _, path := range []string{state.TLS.CAFile, state.TLS.CertFile, state.TLS.KeyFile} {
+		if filepath.Dir(path) != dir.TLSDir() {
+			t.Errorf("expected %s in %s", path, dir.TLSDir())
+		}
+	}
+
+	// Plain connections are rejected
+	_, clientOpts := newServerAndClientOpts(port)
+	c, err := client.Dial(clientOpts)
+	if err == nil {
+		_, err = c.CheckHealth(ctx, &client.CheckHealthRequest{})
+		c.Close()
+	}
+	if err == nil {
+		t.Error("expected frontend to require TLS")
+	}
+
+	tlsConfig, err := newClientTLSConfig(state.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientOpts.ConnectionOptions.TLS = tlsConfig
+	assertServerHealth(t, ctx, clientOpts)
+
+	// The HTTP API requires the same client certificates as the frontend.
+	getWorkflows := func(tlsConfig *tls.Config) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/api/v1/namespaces/default/workflows", httpPort), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		defer httpClient.CloseIdleConnections()
+		return httpClient.Do(req)
+	}
+	if res, err := getWorkflows(tlsConfig); err != nil {
+		t.Errorf("HTTP API request with the client certificate failed: %v", err)
+	} else {
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("HTTP API request with the client certificate returned %d", res.StatusCode)
+		}
+	}
+	if res, err := getWorkflows(&tls.Config{ServerName: tlsConfig.ServerName, RootCAs: tlsConfig.RootCAs}); err == nil {
+		res.Body.Close()
+		t.Error("expected HTTP API to require a client certificate")
+	}
+
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	var out bytes.Buffer
+	temporaliteCLI.Writer = &out
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "status", "--data-dir", string(dir)}); err != nil {
+		t.Fatalf("status failed: %v: %s", err, out.String())
+	}
+	if !strings.Contains(out.String(), statusRunning) {
+		t.Errorf("expected running status, got %q", out.String())
+	}
+
+	temporaliteCLI = buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	args, _ := newServerAndClientOpts(port, "--tls")
+	if err := temporaliteCLI.RunContext(ctx, args); err == nil {
+		t.Error("expected error using --tls without a data directory")
+	}
+}
@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/inspect"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+const (
+	outputFlag           = "output"
+	largestHistoriesFlag = "largest-histories"
+)
+
+func newDBCommand(defaultCfg *liteconfig.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "db",
+		Usage: "Manage Temporalite database files",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "inspect",
+				Usage:     "Print a summary of a database file without starting the server",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    dbPathFlag,
+						Aliases: []string{"f"},
+						Value:   defaultCfg.DatabaseFilePath,
+						Usage:   "database file to inspect",
+					},
+					newOutputFlag(),
+					&cli.IntFlag{
+						Name:  largestHistoriesFlag,
+						Usage: "number of largest workflow histories to list",
+						Value: inspect.DefaultLargestHistories,
+					},
+				},
+				Before: checkOutputFlag,
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() > 0 {
+						return cli.Exit("ERROR: inspect command doesn't support arguments.", 1)
+					}
+					report, err := inspect.Inspect(c.Context, c.String(dbPathFlag), c.Int(largestHistoriesFlag))
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Unable to inspect database. Error: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						return writeJSON(c.App.Writer, report)
+					}
+					return writeInspectReport(c.App.Writer, report)
+				},
+			},
+		},
+	}
+}
+
+func newOutputFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:    outputFlag,
+		Aliases: []string{"o"},
+		Usage:   `output format (allowed: ["table" "json"])`,
+		Value:   "table",
+	}
+}
+
+func checkOutputFlag(c *cli.Context) error {
+	switch c.String(outputFlag) {
+	case "table", "json":
+		return nil
+	default:
+		return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(outputFlag), outputFlag), 1)
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeInspectReport(w io.Writer, r *inspect.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Path:\t%s\n", r.Path)
+	fmt.Fprintf(tw, "File size:\t%d bytes\n", r.FileSize)
+	fmt.Fprintf(tw, "Supported schema version (this binary):\t%s (visibility %s)\n", r.SupportedSchemaVersion, r.SupportedVisibilitySchemaVersion)
+	fmt.Fprintf(tw, "Shards:\t%d\n", r.ShardCount)
+	fmt.Fprintf(tw, "Executions:\t%d open, %d closed\n", r.Executions.Open, r.Executions.Closed)
+
+	fmt.Fprintln(tw, "\nCLUSTER\tID\tSHARDS\tSERVER VERSION")
+	for _, cl := range r.Clusters {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", cl.Name, cl.ID, cl.HistoryShardCount, cl.ServerVersion)
+	}
+
+	fmt.Fprintln(tw, "\nNAMESPACE\tID\tSTATE\tRETENTION")
+	for _, ns := range r.Namespaces {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ns.Name, ns.ID, ns.State, ns.Retention)
+	}
+
+	fmt.Fprintln(tw, "\nHISTORY\tNAMESPACE\tRUN ID\tBATCHES\tSIZE")
+	for _, h := range r.LargestHistories {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", h.WorkflowID, h.Namespace, h.RunID, h.Batches, h.Size)
+	}
+
+	fmt.Fprintln(tw, "\nTABLE\tROWS\tSIZE")
+	for _, t := range r.Tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", t.Name, t.Rows, t.Size)
+	}
+	return tw.Flush()
+}
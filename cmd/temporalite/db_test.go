@@ -0,0 +1,150 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/server/common/log"
+
+	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/examples/helloworld"
+	"github.com/temporalio/temporalite/internal/inspect"
+)
+
+// newTestDatabase returns the path to a database file containing a completed workflow execution
+// in the "default" namespace.
+func newTestDatabase(ctx context.Context, t *testing.T, workflowID string, opts ...temporalite.ServerOption) string {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	s, err := temporalite.NewServer(append([]temporalite.ServerOption{
+		temporalite.WithDatabaseFilePath(dbPath),
+		temporalite.WithNamespaces("default"),
+		temporalite.WithDynamicPorts(),
+		temporalite.WithLogger(log.NewNoopLogger()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	c, err := s.NewClient(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w := worker.New(c, "hello_world", worker.Options{})
+	helloworld.RegisterWorkflowsAndActivities(w)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	wfr, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{ID: workflowID, TaskQueue: "hello_world"}, helloworld.Greet, "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfr.Get(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	systemClient, err := s.NewClient(ctx, "temporal-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer systemClient.Close()
+	if err := waitForScanners(ctx, systemClient); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath
+}
+
+func TestDBInspect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dbPath := newTestDatabase(ctx, t, "inspect-me")
+
+	temporaliteCLI := buildCLI()
+	// Don't call os.Exit
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	var out bytes.Buffer
+	temporaliteCLI.Writer = &out
+
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "db", "inspect", "-f", dbPath, "--output", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var report inspect.Report
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("cannot decode %q: %s", out.String(), err)
+	}
+	if report.ShardCount != 1 {
+		t.Errorf("expected 1 shard, got %d", report.ShardCount)
+	}
+	if report.Executions.Closed < 1 {
+		t.Errorf("expected at least one closed execution, got %d", report.Executions.Closed)
+	}
+	var found bool
+	for _, ns := range report.Namespaces {
+		if ns.Name == "default" {
+			found = ns.Retention == "24h0m0s"
+		}
+	}
+	if !found {
+		t.Errorf("namespace %q with default retention missing from %+v", "default", report.Namespaces)
+	}
+	found = false
+	for _, h := range report.LargestHistories {
+		if h.WorkflowID == "inspect-me" && h.Namespace == "default" && h.Size > 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("workflow history missing from %+v", report.LargestHistories)
+	}
+
+	out.Reset()
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "db", "inspect", "-f", dbPath}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "inspect-me") {
+		t.Errorf("expected table output to list workflow history, got:\n%s", out.String())
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "db", "inspect", "-f", missing}); err == nil {
+		t.Error("expected error inspecting missing file")
+	}
+}
@@ -0,0 +1,367 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+const (
+	workerFlag = "worker"
+
+	// workerStopTimeout bounds how long a worker gets to shut down before it is killed.
+	workerStopTimeout = 10 * time.Second
+)
+
+// newDevCommand returns a command running the start command along with a worker that is
+// rebuilt and restarted whenever its sources change.
+func newDevCommand(start *cli.Command) *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  workerFlag,
+			Usage: "Go package of the worker to build and run, eg. ./cmd/worker",
+		},
+	}
+	for _, f := range start.Flags {
+		// The worker's output is only streamed while the command runs in the foreground.
+		if f.Names()[0] != detachFlag {
+			flags = append(flags, f)
+		}
+	}
+	return &cli.Command{
+		Name:      "dev",
+		Usage:     "Start Temporal server along with a worker that is rebuilt and restarted when its sources change",
+		ArgsUsage: " ",
+		Flags:     flags,
+		Before: func(c *cli.Context) error {
+			if !c.IsSet(workerFlag) {
+				return cli.Exit(fmt.Sprintf("ERROR: %s command requires %q", c.Command.Name, workerFlag), 1)
+			}
+			if !c.IsSet(namespaceFlag) {
+				if err := c.Set(namespaceFlag, "default"); err != nil {
+					return err
+				}
+			}
+			return start.Before(c)
+		},
+		Action: func(c *cli.Context) error {
+			port, dataDir := c.Int(portFlag), c.String(dataDirFlag)
+			if c.IsSet(profileFlag) {
+				p, err := loadProfile(c.String(profileFlag))
+				if err != nil {
+					return err
+				}
+				if !c.IsSet(portFlag) {
+					port = p.Port
+				}
+				dataDir = p.DataDir
+			}
+			// Servers without a data directory record no state, the worker connects to them
+			// with the flags and config dir instead.
+			fallback := &datadir.State{
+				FrontendAddress: net.JoinHostPort(c.String(ipFlag), strconv.Itoa(port)),
+				Namespaces:      c.StringSlice(namespaceFlag),
+			}
+			if c.IsSet(listenFlag) {
+				fallback.FrontendAddress = c.String(listenFlag)
+			}
+			if dataDir == "" {
+				baseConfig, err := loadBaseConfig(c.String(configFlag))
+				if err != nil {
+					return err
+				}
+				// Frontends requiring client certificates are connected to with the user's own,
+				// which the worker reads from its environment too.
+				if fallback.TLS = clientTLS(baseConfig); fallback.TLS != nil {
+					fallback.TLS.CertFile = os.Getenv("TEMPORAL_TLS_CERT")
+					fallback.TLS.KeyFile = os.Getenv("TEMPORAL_TLS_KEY")
+				}
+			}
+
+			binDir, err := os.MkdirTemp("", "temporalite-dev-")
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to create worker build directory: %v", err), 1)
+			}
+			defer func() { _ = os.RemoveAll(binDir) }()
+			w := newDevWorker(c.String(workerFlag), binDir, c.App.ErrWriter)
+
+			ctx, cancel := context.WithCancel(c.Context)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				w.run(ctx, datadir.Dir(dataDir), fallback)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+			return start.Action(c)
+		},
+	}
+}
+
+// devWorker builds a worker package and supervises its process.
+type devWorker struct {
+	pkg    string // package passed to the go command
+	dir    string // directory the go command runs in
+	binary string
+	env    []string
+	out    *prefixWriter
+
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+func newDevWorker(pkg, binDir string, w io.Writer) *devWorker {
+	d := &devWorker{
+		pkg:    pkg,
+		binary: filepath.Join(binDir, "worker"),
+		out:    &prefixWriter{w: w, prefix: "[worker] "},
+	}
+	if runtime.GOOS == "windows" {
+		d.binary += ".exe"
+	}
+	// Build packages given as a directory from within it so that they can belong to another
+	// module than the current directory.
+	if info, err := os.Stat(pkg); err == nil && info.IsDir() {
+		d.dir, d.pkg = pkg, "."
+	}
+	return d
+}
+
+// run starts the worker once the server is serving, and restarts it whenever its sources
+// change until ctx is done.
+//
+// The worker connects to the server like clients of its data directory do, see env, or as
+// described by fallback when it runs without one.
+func (d *devWorker) run(ctx context.Context, dir datadir.Dir, fallback *datadir.State) {
+	defer d.stop()
+	state := d.waitForServer(ctx, dir, fallback)
+	if state == nil {
+		return
+	}
+	d.env = os.Environ()
+	for _, v := range stateEnv(state) {
+		d.env = append(d.env, v[0]+"="+v[1])
+	}
+	// Sources are watched before each build so that changes made during the build are not missed.
+	var changes <-chan []string
+	stopWatching := func() {}
+	defer func() { stopWatching() }()
+	watch := func() {
+		stopWatching()
+		var watchCtx context.Context
+		watchCtx, stopWatching = context.WithCancel(ctx)
+		changes = d.watch(watchCtx)
+	}
+	watch()
+	if err := d.build(); err == nil {
+		d.start()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-d.exited:
+			d.exited = nil
+			d.logf("Worker exited (%v), waiting for source changes to restart it.", err)
+		case changed := <-changes:
+			var sources bool
+			for _, path := range changed {
+				if name := filepath.Base(path); strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum" {
+					sources = true
+				}
+			}
+			if !sources {
+				continue
+			}
+			// The worker may depend on other packages now.
+			watch()
+			d.logf("Sources changed, rebuilding.")
+			if err := d.build(); err == nil {
+				d.stop()
+				d.start()
+			}
+		}
+	}
+}
+
+// waitForServer returns the state the server of this process recorded in dir once it is
+// serving, or nil if ctx is done first. Without a data directory, it returns fallback once the
+// server it describes is serving.
+func (d *devWorker) waitForServer(ctx context.Context, dir datadir.Dir, fallback *datadir.State) *datadir.State {
+	for {
+		if dir != "" {
+			// The state of a previous server may be left behind until this one records its own.
+			if s, err := dir.ReadState(); err == nil && s.PID == os.Getpid() {
+				return s
+			}
+		} else if checkFrontendHealth(ctx, fallback.FrontendAddress, fallback.TLS) == nil {
+			return fallback
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// build builds the worker binary, printing the compiler output. A worker that is already
+// running keeps running when the build fails.
+func (d *devWorker) build() error {
+	cmd := exec.Command("go", "build", "-o", d.binary, d.pkg)
+	cmd.Dir = d.dir
+	cmd.Stdout = d.out
+	cmd.Stderr = d.out
+	err := cmd.Run()
+	d.out.Flush()
+	if err != nil {
+		d.logf("Unable to build %s: %v", d.pkg, err)
+	}
+	return err
+}
+
+func (d *devWorker) start() {
+	cmd := exec.Command(d.binary)
+	cmd.Env = d.env
+	cmd.Stdout = d.out
+	cmd.Stderr = d.out
+	if err := cmd.Start(); err != nil {
+		d.logf("Unable to start worker: %v", err)
+		return
+	}
+	d.logf("Started worker (pid %d).", cmd.Process.Pid)
+	d.cmd = cmd
+	d.exited = make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		d.out.Flush()
+		d.exited <- err
+	}()
+}
+
+// stop gracefully stops the worker if it is running, killing it after workerStopTimeout.
+func (d *devWorker) stop() {
+	if d.cmd == nil {
+		return
+	}
+	defer func() { d.cmd, d.exited = nil, nil }()
+	if d.exited == nil {
+		// Already reported as exited.
+		return
+	}
+	_ = process.Terminate(d.cmd.Process.Pid)
+	select {
+	case <-d.exited:
+	case <-time.After(workerStopTimeout):
+		_ = d.cmd.Process.Kill()
+		<-d.exited
+	}
+}
+
+// watch watches the directories of the packages the worker is built from that belong to its
+// main module, along with the module's go.mod and go.sum files.
+func (d *devWorker) watch(ctx context.Context) <-chan []string {
+	cmd := exec.Command("go", "list", "-deps", "-f", "{{if and .Module .Module.Main}}{{.Dir}}\n{{.Module.GoMod}}{{end}}", d.pkg)
+	cmd.Dir = d.dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		d.logf("Unable to list the packages of %s: %v: %s", d.pkg, err, strings.TrimSpace(stderr.String()))
+	}
+	var dirs, files []string
+	seen := map[string]bool{}
+	for _, path := range strings.Fields(string(out)) {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if filepath.Ext(path) == ".mod" {
+			files = append(files, path, strings.TrimSuffix(path, ".mod")+".sum")
+		} else {
+			dirs = append(dirs, path)
+		}
+	}
+	return watchFiles(ctx, dirs, files...)
+}
+
+func (d *devWorker) logf(format string, args ...interface{}) {
+	fmt.Fprintf(d.out, format+"\n", args...)
+}
+
+// prefixWriter writes each line written to it to w, starting with prefix.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes what remains of an unterminated line.
+func (p *prefixWriter) Flush() {
+	p.mu.Lock()
+	unterminated := len(p.buf) > 0
+	p.mu.Unlock()
+	if unterminated {
+		_, _ = p.Write([]byte{'\n'})
+	}
+}
@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while the CLI writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+const devWorkerSource = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	fmt.Println("pid", os.Getpid(), "%s", os.Getenv("TEMPORAL_ADDRESS"), os.Getenv("TEMPORAL_NAMESPACE"), os.Getenv("TEMPORAL_TLS_CERT"))
+	time.Sleep(time.Hour)
+}
+`
+
+func TestDev(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	workerDir := t.TempDir()
+	writeWorker := func(version string) {
+		if err := os.WriteFile(filepath.Join(workerDir, "main.go"), []byte(fmt.Sprintf(devWorkerSource, version)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(workerDir, "go.mod"), []byte("module example.com/worker\n\ngo 1.18\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeWorker("v1")
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	if err := temporaliteCLI.RunContext(ctx, []string{"temporalite", "dev", "--ephemeral"}); err == nil {
+		t.Error("expected error running dev without --worker")
+	}
+
+	var out syncBuffer
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		temporaliteCLI.ErrWriter = &out
+		args := []string{"temporalite", "dev", "--worker", workerDir, "--ephemeral", "--log-format", "noop", "--headless", "--port", strconv.Itoa(port)}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+
+	// waitForWorker returns the pid of the worker once it printed its version.
+	waitForWorker := func(version string) int {
+		re := regexp.MustCompile(fmt.Sprintf(`(?m)^\[worker\] pid (\d+) %s 127\.0\.0\.1:%d default $`, version, port))
+		for {
+			if m := re.FindStringSubmatch(out.String()); m != nil {
+				pid, _ := strconv.Atoi(m[1])
+				return pid
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("worker %s did not start, output:\n%s", version, out.String())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	pid := waitForWorker("v1")
+
+	writeWorker("v2")
+	newPID := waitForWorker("v2")
+	if process.Exists(pid) {
+		t.Errorf("expected previous worker (pid %d) to be stopped", pid)
+	}
+
+	stopServer()
+	<-done
+	if process.Exists(newPID) {
+		t.Errorf("expected worker (pid %d) to be stopped with the server", newPID)
+	}
+	if !strings.Contains(out.String(), "[worker] Sources changed, rebuilding.") {
+		t.Errorf("expected rebuild to be logged, output:\n%s", out.String())
+	}
+}
+
+func TestDevTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	workerDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workerDir, "main.go"), []byte(fmt.Sprintf(devWorkerSource, "v1")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workerDir, "go.mod"), []byte("module example.com/worker\n\ngo 1.18\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	var out syncBuffer
+	dataDir := t.TempDir()
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		temporaliteCLI.ErrWriter = &out
+		args := []string{"temporalite", "dev", "--worker", workerDir, "--data-dir", dataDir, "--tls", "--log-format", "noop", "--headless", "--port", strconv.Itoa(port)}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	// The worker only starts once the server answers over TLS, and gets the client certificate.
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^\[worker\] pid \d+ v1 127\.0\.0\.1:%d default (\S+)$`, port))
+	for {
+		if m := re.FindStringSubmatch(out.String()); m != nil {
+			if !strings.HasPrefix(m[1], dataDir) {
+				t.Errorf("expected client certificate from the data directory, got %s", m[1])
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("worker did not start, output:\n%s", out.String())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/server/common/log"
+
+	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/examples/helloworld"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestDatabaseEncryption(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wrongKeyFile := filepath.Join(t.TempDir(), "wrong-key")
+	if err := os.WriteFile(wrongKeyFile, bytes.Repeat([]byte{'a'}, 64), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The workflow result must show up in plain databases for the check below to be meaningful.
+	plain, err := os.ReadFile(newTestDatabase(ctx, t, "plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(plain, []byte("Hello world")) {
+		t.Fatal("expected workflow result in unencrypted database")
+	}
+
+	dbPath := newTestDatabase(ctx, t, "encrypted", temporalite.WithDatabaseEncryptionKey(key))
+	encrypted, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("Hello world")) {
+		t.Error("found workflow result in encrypted database")
+	}
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	for name, tc := range map[string]struct {
+		args        []string
+		expectedErr string
+	}{
+		"missing key":        {args: []string{"-f", dbPath}, expectedErr: "requires an encryption key"},
+		"wrong key":          {args: []string{"-f", dbPath, "--db-encryption-key-file", wrongKeyFile}, expectedErr: "does not match"},
+		"unencrypted":        {args: []string{"-f", newTestDatabase(ctx, t, "unencrypted"), "--db-encryption-key-file", keyFile}, expectedErr: "unencrypted workflow data"},
+		"malformed key file": {args: []string{"-f", dbPath, "--db-encryption-key-file", dbPath}, expectedErr: "must be 32 bytes"},
+		"ephemeral":          {args: []string{"--ephemeral", "--db-encryption-key-file", keyFile}, expectedErr: "only one of"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			temporaliteCLI := buildCLI()
+			// Don't call os.Exit
+			temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+			args, _ := newServerAndClientOpts(port, tc.args...)
+			err := temporaliteCLI.RunContext(ctx, args)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	s, err := temporalite.NewServer(
+		temporalite.WithDatabaseFilePath(dbPath),
+		temporalite.WithDatabaseEncryptionKey(key),
+		temporalite.WithDynamicPorts(),
+		temporalite.WithLogger(log.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	c, err := s.NewClient(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var result string
+	if err := c.GetWorkflow(ctx, "encrypted", "").Get(ctx, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result != "Hello world" {
+		t.Errorf("unexpected workflow result %q", result)
+	}
+
+	// Workflows keep running against the encrypted database after a restart
+	w := worker.New(c, "hello_world", worker.Options{})
+	helloworld.RegisterWorkflowsAndActivities(w)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	wfr, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: "hello_world"}, helloworld.Greet, "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfr.Get(ctx, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result != "Hello again" {
+		t.Errorf("unexpected workflow result %q", result)
+	}
+}
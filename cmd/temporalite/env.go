@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/server/common/config"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+func newEnvCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "env",
+		Usage:     "Print shell commands exporting the address of the server using a data directory, eg. for eval or direnv",
+		ArgsUsage: " ",
+		Flags:     newServerDirFlags(),
+		Action: func(c *cli.Context) error {
+			dir, err := serverDataDir(c)
+			if err != nil {
+				return err
+			}
+			state, err := dir.ReadState()
+			if errors.Is(err, fs.ErrNotExist) || (err == nil && !process.Exists(state.PID)) {
+				return cli.Exit(fmt.Sprintf("ERROR: Temporalite is not running in %s", dir), 1)
+			} else if err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to read server state: %v", err), 1)
+			}
+			for _, v := range stateEnv(state) {
+				fmt.Fprintf(c.App.Writer, "export %s=%s\n", v[0], shellQuote(v[1]))
+			}
+			return nil
+		},
+	}
+}
+
+// stateEnv returns the environment variables SDKs and the temporal CLI read to connect to
+// the server described by state, skipping the ones without a value.
+func stateEnv(state *datadir.State) [][2]string {
+	env := [][2]string{{"TEMPORAL_ADDRESS", state.FrontendAddress}}
+	if len(state.Namespaces) > 0 {
+		env = append(env, [2]string{"TEMPORAL_NAMESPACE", state.Namespaces[0]})
+	}
+	if state.TLS != nil {
+		env = append(env,
+			[2]string{"TEMPORAL_TLS_CA", state.TLS.CAFile},
+			[2]string{"TEMPORAL_TLS_CERT", state.TLS.CertFile},
+			[2]string{"TEMPORAL_TLS_KEY", state.TLS.KeyFile},
+			[2]string{"TEMPORAL_TLS_SERVER_NAME", state.TLS.ServerName},
+		)
+	}
+	var set [][2]string
+	for _, v := range env {
+		if v[1] != "" {
+			set = append(set, v)
+		}
+	}
+	return set
+}
+
+// clientTLS returns the TLS material for clients of a frontend configured to serve TLS, or nil.
+//
+// Clients of a frontend requiring client certificates pass their own: the frontend's certificate
+// is never given out, it would let them act as the server.
+func clientTLS(cfg *config.Config) *datadir.ClientTLS {
+	frontend := cfg.Global.TLS.Frontend
+	if frontend.Server.CertFile == "" && frontend.Server.CertData == "" {
+		return nil
+	}
+	t := &datadir.ClientTLS{ServerName: frontend.Client.ServerName}
+	if len(frontend.Client.RootCAFiles) > 0 {
+		t.CAFile = frontend.Client.RootCAFiles[0]
+	}
+	return t
+}
+
+// serveGeneratedTLS configures the frontend of cfg to require mutual TLS with the material
+// generated in dir, returned by GenerateTLS.
+//
+// The server certificate is also presented by the system workers, other clients present the
+// generated client certificate.
+func serveGeneratedTLS(cfg *config.Config, dir datadir.Dir, generated *datadir.ClientTLS) error {
+	if clientTLS(cfg) != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: %q flag may not be combined with TLS configured in the config dir", tlsFlag), 1)
+	}
+	cfg.Global.TLS.Frontend = config.GroupTLS{
+		Server: config.ServerTLS{
+			CertFile:          dir.CertFile(),
+			KeyFile:           dir.KeyFile(),
+			ClientCAFiles:     []string{generated.CAFile},
+			RequireClientAuth: true,
+		},
+		Client: config.ClientTLS{
+			ServerName:  generated.ServerName,
+			RootCAFiles: []string{generated.CAFile},
+		},
+	}
+	cfg.Global.TLS.SystemWorker = config.WorkerTLS{
+		CertFile: dir.CertFile(),
+		KeyFile:  dir.KeyFile(),
+		Client: config.ClientTLS{
+			ServerName:  generated.ServerName,
+			RootCAFiles: []string{generated.CAFile},
+		},
+	}
+	return nil
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,228 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+const (
+	addressFlag       = "address"
+	tlsCAFlag         = "tls-ca"
+	tlsCertFlag       = "tls-cert"
+	tlsKeyFlag        = "tls-key"
+	tlsServerNameFlag = "tls-server-name"
+)
+
+var defaultFrontendAddress = net.JoinHostPort("127.0.0.1", strconv.Itoa(liteconfig.DefaultFrontendPort))
+
+// workflowServiceName is the service the frontend reports the health of.
+const workflowServiceName = "temporal.api.workflowservice.v1.WorkflowService"
+
+func newHealthcheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "healthcheck",
+		Usage:     "Check that a server is serving requests, exiting with a non-zero code if it isn't (eg. for container health checks)",
+		ArgsUsage: " ",
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  addressFlag,
+				Usage: "host:port of the temporal-frontend GRPC service",
+				Value: defaultFrontendAddress,
+			},
+			&cli.StringFlag{
+				Name:    namespaceFlag,
+				Aliases: []string{"n"},
+				Usage:   "also check that this namespace exists",
+			},
+			&cli.DurationFlag{
+				Name:  timeoutFlag,
+				Usage: "how long to wait for the server to respond",
+				Value: 5 * time.Second,
+			},
+		}, newClientTLSFlags()...), newServerDirFlags()...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel := context.WithTimeout(c.Context, c.Duration(timeoutFlag))
+			defer cancel()
+
+			address, clientTLS := c.String(addressFlag), flagsClientTLS(c)
+			if c.IsSet(dataDirFlag) || c.IsSet(profileFlag) {
+				if c.IsSet(addressFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q may not be combined with %q or %q", addressFlag, dataDirFlag, profileFlag), 1)
+				}
+				dir, err := serverDataDir(c)
+				if err != nil {
+					return err
+				}
+				state, err := dir.ReadState()
+				if err != nil || !process.Exists(state.PID) {
+					return cli.Exit(fmt.Sprintf("ERROR: no server is running in %s", dir), 1)
+				}
+				address = state.FrontendAddress
+				if clientTLS == nil {
+					clientTLS = state.TLS
+				}
+			}
+			conn, err := dialFrontend(ctx, address, clientTLS)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to connect to %s: %v", address, err), 1)
+			}
+			defer func() { _ = conn.Close() }()
+
+			if err := checkServing(ctx, conn); err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: health check of %s failed: %v", address, err), 1)
+			}
+			client := workflowservice.NewWorkflowServiceClient(conn)
+			info, err := client.GetSystemInfo(ctx, &workflowservice.GetSystemInfoRequest{})
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("ERROR: unable to get system info from %s: %v", address, err), 1)
+			}
+			if ns := c.String(namespaceFlag); ns != "" {
+				if _, err := client.DescribeNamespace(ctx, &workflowservice.DescribeNamespaceRequest{Namespace: ns}); err != nil {
+					return cli.Exit(fmt.Sprintf("ERROR: unable to describe namespace %q: %v", ns, err), 1)
+				}
+			}
+
+			fmt.Fprintf(c.App.Writer, "OK: %s is serving (server %s)\n", address, info.GetServerVersion())
+			return nil
+		},
+	}
+}
+
+// newClientTLSFlags returns the flags passing the TLS material to connect to a frontend serving
+// TLS with, which default to the environment variables printed by env.
+func newClientTLSFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    tlsCAFlag,
+			Usage:   "CA certificate file to verify the frontend's certificate with, connecting over TLS",
+			EnvVars: []string{"TEMPORAL_TLS_CA"},
+		},
+		&cli.StringFlag{
+			Name:    tlsCertFlag,
+			Usage:   "client certificate file to present to the frontend, connecting over TLS",
+			EnvVars: []string{"TEMPORAL_TLS_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    tlsKeyFlag,
+			Usage:   "private key file of the client certificate",
+			EnvVars: []string{"TEMPORAL_TLS_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    tlsServerNameFlag,
+			Usage:   "server name to verify the frontend's certificate against, connecting over TLS",
+			EnvVars: []string{"TEMPORAL_TLS_SERVER_NAME"},
+		},
+	}
+}
+
+// flagsClientTLS returns the TLS material passed with the flags from newClientTLSFlags, or nil
+// when none was passed.
+func flagsClientTLS(c *cli.Context) *datadir.ClientTLS {
+	t := &datadir.ClientTLS{
+		ServerName: c.String(tlsServerNameFlag),
+		CAFile:     c.String(tlsCAFlag),
+		CertFile:   c.String(tlsCertFlag),
+		KeyFile:    c.String(tlsKeyFlag),
+	}
+	if *t == (datadir.ClientTLS{}) {
+		return nil
+	}
+	return t
+}
+
+// checkFrontendHealth returns an error unless the frontend at address reports itself as serving.
+func checkFrontendHealth(ctx context.Context, address string, clientTLS *datadir.ClientTLS) error {
+	conn, err := dialFrontend(ctx, address, clientTLS)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	return checkServing(ctx, conn)
+}
+
+// dialFrontend connects to the frontend at address, over TLS when clientTLS is not nil.
+func dialFrontend(ctx context.Context, address string, clientTLS *datadir.ClientTLS) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if clientTLS != nil {
+		cfg, err := newClientTLSConfig(clientTLS)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(cfg)
+	}
+	return grpc.DialContext(ctx, address, grpc.WithTransportCredentials(creds))
+}
+
+// newClientTLSConfig loads the TLS material recorded for clients of a server.
+func newClientTLSConfig(clientTLS *datadir.ClientTLS) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: clientTLS.ServerName}
+	if clientTLS.CAFile != "" {
+		data, err := os.ReadFile(clientTLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", clientTLS.CAFile)
+		}
+	}
+	if clientTLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(clientTLS.CertFile, clientTLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func checkServing(ctx context.Context, conn *grpc.ClientConn) error {
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: workflowServiceName})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("frontend is %s", resp.GetStatus())
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestHealthcheck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port       = portProvider.MustGetFreePort()
+		unusedPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite", "healthcheck"}, args...))
+		return out.String(), err
+	}
+
+	if _, err := run("--address", "127.0.0.1:"+strconv.Itoa(unusedPort), "--timeout", "1s"); err == nil {
+		t.Error("expected error checking a server that isn't running")
+	}
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--ephemeral")
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	_, clientOpts := newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+
+	out, err := run("--address", clientOpts.HostPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "OK") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if _, err := run("--address", clientOpts.HostPort, "--namespace", "default"); err != nil {
+		t.Error(err)
+	}
+	if _, err := run("--address", clientOpts.HostPort, "--namespace", "missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected error for missing namespace, got %v", err)
+	}
+}
+
+func TestHealthcheckTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port        = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite", "healthcheck"}, args...))
+		return out.String(), err
+	}
+
+	dataDir := t.TempDir()
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--data-dir", dataDir, "--tls", "--metrics-port", strconv.Itoa(metricsPort))
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	// Servers stop slowly until all their services started.
+	for {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/readyz", metricsPort))
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("server never became ready: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The data directory gives the address and TLS material of its server.
+	if _, err := run("--data-dir", dataDir); err != nil {
+		t.Fatal(err)
+	}
+	state, err := datadir.Dir(dataDir).ReadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("--address", state.FrontendAddress, "--timeout", "1s"); err == nil {
+		t.Error("expected error checking a TLS server over plaintext")
+	}
+	out, err := run("--address", state.FrontendAddress,
+		"--tls-ca", state.TLS.CAFile,
+		"--tls-cert", state.TLS.CertFile,
+		"--tls-key", state.TLS.KeyFile,
+		"--tls-server-name", state.TLS.ServerName,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "OK") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if _, err := run("--data-dir", dataDir, "--address", state.FrontendAddress); err == nil {
+		t.Error("expected error passing both an address and a data directory")
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	for name, serverArgs := range map[string][]string{
+		"plaintext": {"--ephemeral"},
+		// The health checks dial the services with the server's TLS configuration.
+		"tls": {"--data-dir", t.TempDir(), "--tls"},
+	} {
+		serverArgs := serverArgs
+		t.Run(name, func(t *testing.T) {
+			testHealthEndpoints(t, serverArgs...)
+		})
+	}
+}
+
+func testHealthEndpoints(t *testing.T, serverArgs ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port        = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, append(serverArgs, "--metrics-port", strconv.Itoa(metricsPort))...)
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	get := func(path string) (int, string, error) {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", metricsPort, path))
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+
+	// A harness only needs to wait on /readyz
+	var (
+		code int
+		body string
+		err  error
+	)
+	for ctx.Err() == nil {
+		if code, body, err = get("/readyz"); err == nil && code == http.StatusOK {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if code != http.StatusOK {
+		t.Fatalf("server never became ready, last response %d %s: %v", code, body, err)
+	}
+	var report struct {
+		Status string
+		Checks map[string]struct{ Status string }
+	}
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"server", "database", "frontend", "history", "matching", "worker"} {
+		if report.Checks[name].Status != "ok" {
+			t.Errorf("expected %s check to be ok, got %+v", name, report.Checks[name])
+		}
+	}
+	if report.Checks["ui"].Status != "disabled" {
+		t.Errorf("expected ui check to be disabled when headless, got %+v", report.Checks["ui"])
+	}
+
+	if code, body, err := get("/healthz"); err != nil || code != http.StatusOK {
+		t.Errorf("unexpected /healthz response %d %s: %v", code, body, err)
+	}
+	if code, body, err := get("/metrics"); err != nil || code != http.StatusOK || !strings.Contains(body, "# TYPE") {
+		t.Errorf("unexpected /metrics response %d: %v", code, err)
+	}
+}
@@ -0,0 +1,222 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	commonpb "go.temporal.io/api/common/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/client"
+
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/encryption"
+	"github.com/temporalio/temporalite/internal/histories"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func newWorkflowImportCommand(defaultCfg *liteconfig.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "Store closed workflow runs from history files written by export into a database file while no server uses it, eg. to browse or replay histories of another cluster",
+		Description: `The history is stored as is, with its event times, task queues and identities. Runs exported
+with --dir keep their workflow and run IDs unless --workflow-id is passed, other runs get a new run ID.
+Imported runs are listed once a server is started on the database file, and deleted once the
+namespace retention has passed since the import.
+
+The run of a child workflow or of a continue-as-new is imported on its own, its parent or previous
+run is only referred to. Histories of running workflows are rejected.`,
+		ArgsUsage: "FILE...",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    dbPathFlag,
+				Aliases: []string{"f"},
+				Value:   defaultCfg.DatabaseFilePath,
+				Usage:   "database file to import into, no server may be using it",
+			},
+			&cli.StringFlag{
+				Name:    namespaceFlag,
+				Aliases: []string{"n"},
+				Value:   defaultNamespace,
+				Usage:   "namespace to import into",
+			},
+			&cli.StringFlag{
+				Name:        workflowIDFlag,
+				Aliases:     []string{"id", "w"},
+				Usage:       "workflow ID of the imported run",
+				DefaultText: "from file names written by export --dir, otherwise the file name without extension",
+			},
+			&cli.StringFlag{
+				Name:  encryptionKeyFileFlag,
+				Usage: "file holding the key the database is encrypted with",
+			},
+		}, newServerDirFlags()...),
+		Before: func(c *cli.Context) error {
+			if c.Args().Len() == 0 {
+				return cli.Exit("ERROR: import command requires at least one history file as argument.", 1)
+			}
+			if c.Args().Len() > 1 && c.IsSet(workflowIDFlag) {
+				return cli.Exit(fmt.Sprintf("ERROR: --%s can only be passed when importing a single history", workflowIDFlag), 1)
+			}
+			return nil
+		},
+		BashComplete: completeWorkflowFlags,
+		Action: func(c *cli.Context) error {
+			store, err := openHistoryStore(c)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			for _, file := range c.Args().Slice() {
+				events, err := readHistory(file)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("ERROR: unable to read workflow history: %v", err), 1)
+				}
+				execution := importedExecution(file)
+				if c.IsSet(workflowIDFlag) {
+					// Run IDs are unique within a namespace, copies get their own.
+					execution = &commonpb.WorkflowExecution{WorkflowId: c.String(workflowIDFlag), RunId: uuid.NewString()}
+				}
+				if err := store.Import(c.Context, c.String(namespaceFlag), execution, events); err != nil {
+					return cli.Exit(fmt.Sprintf("ERROR: unable to import workflow history from %s: %v", file, err), 1)
+				}
+				fmt.Fprintf(c.App.Writer, "Imported workflow %q from %s\n", execution.GetWorkflowId(), file)
+				if err := writeWorkflowRun(c.App.Writer, workflowRun{WorkflowID: execution.GetWorkflowId(), RunID: execution.GetRunId()}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// lockedHistoryStore holds the lock of its database file so that no server starts using
+// it during the import.
+type lockedHistoryStore struct {
+	*histories.Store
+	lock *dblock.Lock
+}
+
+func (s *lockedHistoryStore) Close() {
+	s.Store.Close()
+	_ = s.lock.Release()
+}
+
+// openHistoryStore opens the database file selected by the command's flags.
+func openHistoryStore(c *cli.Context) (*lockedHistoryStore, error) {
+	var set []string
+	for _, name := range []string{dbPathFlag, dataDirFlag, profileFlag} {
+		if c.IsSet(name) {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", set[0], set[1]), 1)
+	}
+	path := c.String(dbPathFlag)
+	if c.IsSet(dataDirFlag) || c.IsSet(profileFlag) {
+		dir, err := serverDataDir(c)
+		if err != nil {
+			return nil, err
+		}
+		path = dir.DatabaseFile()
+	}
+
+	var cipher *encryption.Cipher
+	if c.IsSet(encryptionKeyFileFlag) {
+		key, err := readEncryptionKey(c)
+		if err != nil {
+			return nil, err
+		}
+		if cipher, err = encryption.NewCipher(key); err != nil {
+			return nil, cli.Exit(fmt.Sprintf("bad value %q passed for flag %q: %v", c.String(encryptionKeyFileFlag), encryptionKeyFileFlag, err), 1)
+		}
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: database file %q does not exist", path), 1)
+	}
+	lock, err := dblock.Acquire(path, false)
+	if err != nil {
+		var lockErr *dblock.HeldError
+		if errors.As(err, &lockErr) {
+			return nil, cli.Exit(fmt.Sprintf("ERROR: %v. Stop the server before importing histories.", err), 1)
+		}
+		return nil, cli.Exit(fmt.Sprintf("ERROR: unable to lock database file %q: %v", path, err), 1)
+	}
+	store, err := histories.Open(path, cipher)
+	if err != nil {
+		_ = lock.Release()
+		if errors.Is(err, encryption.ErrKeyRequired) {
+			return nil, cli.Exit(fmt.Sprintf("ERROR: %v. Pass the key it was created with using --%s.", err, encryptionKeyFileFlag), 1)
+		}
+		return nil, cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+	}
+	return &lockedHistoryStore{Store: store, lock: lock}, nil
+}
+
+// readHistory reads a history written by export, in either format.
+func readHistory(file string) ([]*historypb.HistoryEvent, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var history *historypb.History
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if history, err = client.HistoryFromJSON(bytes.NewReader(data), client.HistoryJSONOptions{}); err != nil {
+			return nil, fmt.Errorf("invalid JSON history in %s: %w", file, err)
+		}
+	} else {
+		history = &historypb.History{}
+		if err := history.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("invalid protobuf history in %s: %w", file, err)
+		}
+	}
+	return history.GetEvents(), nil
+}
+
+// importedExecution returns the workflow and run IDs to import a history as, recovering
+// them from the names of files written by export --dir.
+func importedExecution(file string) *commonpb.WorkflowExecution {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if i := strings.LastIndex(name, "_"); i > 0 {
+		if runID, err := uuid.Parse(name[i+1:]); err == nil {
+			if workflowID, err := url.PathUnescape(name[:i]); err == nil {
+				return &commonpb.WorkflowExecution{WorkflowId: workflowID, RunId: runID.String()}
+			}
+		}
+	}
+	return &commonpb.WorkflowExecution{WorkflowId: name, RunId: uuid.NewString()}
+}
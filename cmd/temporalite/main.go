@@ -5,19 +5,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	goLog "log"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"go.temporal.io/server/common/config"
 	"go.temporal.io/server/common/dynamicconfig"
 	"go.temporal.io/server/common/headers"
 	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
 	"go.temporal.io/server/temporal"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -26,6 +33,9 @@ import (
 	_ "go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
 
 	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/encryption"
 	"github.com/temporalio/temporalite/internal/liteconfig"
 )
 
@@ -39,9 +49,14 @@ const (
 	portFlag               = "port"
 	metricsPortFlag        = "metrics-port"
 	uiPortFlag             = "ui-port"
+	httpPortFlag           = "http-port"
+	grpcReflectionFlag     = "grpc-reflection"
 	headlessFlag           = "headless"
 	ipFlag                 = "ip"
 	uiIPFlag               = "ui-ip"
+	listenFlag             = "listen"
+	internalIPFlag         = "internal-ip"
+	broadcastAddressFlag   = "broadcast-address"
 	uiCodecEndpointFlag    = "ui-codec-endpoint"
 	logFormatFlag          = "log-format"
 	logLevelFlag           = "log-level"
@@ -49,6 +64,14 @@ const (
 	pragmaFlag             = "sqlite-pragma"
 	configFlag             = "config"
 	dynamicConfigValueFlag = "dynamic-config-value"
+	forceFlag              = "force"
+	readOnlyFlag           = "read-only"
+	encryptionKeyFileFlag  = "db-encryption-key-file"
+	dataDirFlag            = "data-dir"
+	profileFlag            = "profile"
+	detachFlag             = "detach"
+	watchFlag              = "watch"
+	tlsFlag                = "tls"
 )
 
 type uiConfig struct {
@@ -57,6 +80,8 @@ type uiConfig struct {
 	TemporalGRPCAddress string
 	EnableUI            bool
 	CodecEndpoint       string
+	// TLS is the generated TLS material to connect to the frontend with, if any.
+	TLS *datadir.ClientTLS
 }
 
 func main() {
@@ -78,6 +103,8 @@ func buildCLI() *cli.App {
 	app.Name = "temporalite"
 	app.Usage = "An experimental distribution of Temporal that runs as a single process\n\nFind more information at: https://github.com/temporalio/temporalite"
 	app.Version = fmt.Sprintf("%s (server %s)", version, headers.ServerVersion)
+	app.EnableBashCompletion = true
+	app.Suggest = true
 	app.Commands = []*cli.Command{
 		{
 			Name:      "start",
@@ -95,6 +122,14 @@ func buildCLI() *cli.App {
 					Value:   defaultCfg.DatabaseFilePath,
 					Usage:   "file in which to persist Temporal state",
 				},
+				&cli.StringFlag{
+					Name:  dataDirFlag,
+					Usage: "directory in which to keep all Temporal state: database, archives, logs and metadata",
+				},
+				&cli.StringFlag{
+					Name:  profileFlag,
+					Usage: "start the named profile, using its data directory and ports (see: temporalite profile --help)",
+				},
 				&cli.StringSliceFlag{
 					Name:    namespaceFlag,
 					Aliases: []string{"n"},
@@ -109,28 +144,52 @@ func buildCLI() *cli.App {
 					Value:   liteconfig.DefaultFrontendPort,
 				},
 				&cli.IntFlag{
-					Name:  metricsPortFlag,
-					Usage: "port for the metrics listener",
-					Value: liteconfig.DefaultMetricsPort,
+					Name:        metricsPortFlag,
+					Usage:       "port for the metrics listener",
+					Value:       liteconfig.DefaultMetricsPort,
+					DefaultText: "chosen by the system",
 				},
 				&cli.IntFlag{
 					Name:        uiPortFlag,
 					Usage:       "port for the temporal web UI",
 					DefaultText: fmt.Sprintf("--port + 1000, eg. %d", liteconfig.DefaultFrontendPort+1000),
 				},
+				&cli.IntFlag{
+					Name:        httpPortFlag,
+					Usage:       "port for the HTTP/JSON API of the workflow operations, served on --ip with the frontend's TLS configuration (not with mTLS, eg. --tls)",
+					DefaultText: "disabled",
+				},
+				&cli.BoolFlag{
+					Name:  grpcReflectionFlag,
+					Usage: "let tools like grpcurl discover and describe the frontend's gRPC services without proto files",
+				},
 				&cli.BoolFlag{
 					Name:  headlessFlag,
 					Usage: "disable the temporal web UI",
 				},
 				&cli.StringFlag{
 					Name:    ipFlag,
-					Usage:   `IPv4 address to bind the frontend service to instead of localhost`,
+					Usage:   `IPv4 or IPv6 address to bind the frontend service to instead of localhost, :: binds to both`,
 					EnvVars: nil,
 					Value:   "127.0.0.1",
 				},
+				&cli.StringFlag{
+					Name:  listenFlag,
+					Usage: "serve the frontend service on a Unix domain socket instead of --ip and --port, eg. unix:///tmp/temporal.sock; only the current user may connect to the socket, but the other services keep reaching the frontend on a loopback port open to all local users",
+				},
+				&cli.StringFlag{
+					Name:        internalIPFlag,
+					Usage:       `IPv4 or IPv6 address to bind the history, matching and worker services to, eg. a private address of a container network`,
+					DefaultText: "same as --broadcast-address",
+				},
+				&cli.StringFlag{
+					Name:        broadcastAddressFlag,
+					Usage:       `IPv4 or IPv6 address services advertise to each other, required to reach the services bound to --internal-ip`,
+					DefaultText: "--internal-ip, 127.0.0.1 when it binds to all interfaces",
+				},
 				&cli.StringFlag{
 					Name:        uiIPFlag,
-					Usage:       `IPv4 address to bind the web UI to instead of localhost`,
+					Usage:       `IPv4 or IPv6 address to bind the web UI to instead of localhost`,
 					DefaultText: "same as --ip (eg. 127.0.0.1)",
 				},
 				&cli.StringFlag{
@@ -168,6 +227,30 @@ func buildCLI() *cli.App {
 					Name:  dynamicConfigValueFlag,
 					Usage: `dynamic config value, as KEY=JSON_VALUE (meaning strings need quotes)`,
 				},
+				&cli.StringFlag{
+					Name:  encryptionKeyFileFlag,
+					Usage: "file holding a 32 bytes key (raw, hex or base64) used to encrypt workflow data in the database, required on every start once set",
+				},
+				&cli.BoolFlag{
+					Name:  readOnlyFlag,
+					Usage: "serve an existing database for browsing only, rejecting all API calls that modify state. The database is copied to the system's temporary directory on each start, which takes time and disk space in proportion to its size",
+				},
+				&cli.BoolFlag{
+					Name:  forceFlag,
+					Usage: "replace the database lock file even if another process holds its lock, eg. a hung server",
+				},
+				&cli.BoolFlag{
+					Name:  detachFlag,
+					Usage: fmt.Sprintf("run the server in the background once it is ready, requires --%s or --%s (see: temporalite status, temporalite stop)", dataDirFlag, profileFlag),
+				},
+				&cli.BoolFlag{
+					Name:  tlsFlag,
+					Usage: fmt.Sprintf("serve the frontend over mutual TLS with a certificate authority and certificate generated in the data directory, requires --%s or --%s", dataDirFlag, profileFlag),
+				},
+				&cli.BoolFlag{
+					Name:  watchFlag,
+					Usage: fmt.Sprintf("restart the server in-process when files of the --%s directory change, applying changes to its dynamic config file without restarting", configFlag),
+				},
 			},
 			Before: func(c *cli.Context) error {
 				if c.Args().Len() > 0 {
@@ -176,9 +259,30 @@ func buildCLI() *cli.App {
 				if c.IsSet(ephemeralFlag) && c.IsSet(dbPathFlag) {
 					return cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", ephemeralFlag, dbPathFlag), 1)
 				}
+				if c.IsSet(dataDirFlag) && (c.IsSet(ephemeralFlag) || c.IsSet(dbPathFlag)) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q flag may not be combined with %q or %q", dataDirFlag, ephemeralFlag, dbPathFlag), 1)
+				}
+				if c.IsSet(profileFlag) && (c.IsSet(ephemeralFlag) || c.IsSet(dbPathFlag) || c.IsSet(dataDirFlag)) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q flag may not be combined with %q, %q or %q", profileFlag, ephemeralFlag, dbPathFlag, dataDirFlag), 1)
+				}
+				if c.Bool(ephemeralFlag) && c.Bool(readOnlyFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", ephemeralFlag, readOnlyFlag), 1)
+				}
+				if c.Bool(ephemeralFlag) && c.IsSet(encryptionKeyFileFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", ephemeralFlag, encryptionKeyFileFlag), 1)
+				}
+				if c.Bool(detachFlag) && !c.IsSet(dataDirFlag) && !c.IsSet(profileFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q flag requires %q or %q", detachFlag, dataDirFlag, profileFlag), 1)
+				}
+				if c.Bool(tlsFlag) && !c.IsSet(dataDirFlag) && !c.IsSet(profileFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q flag requires %q or %q", tlsFlag, dataDirFlag, profileFlag), 1)
+				}
+				if c.Bool(watchFlag) && !c.IsSet(configFlag) {
+					return cli.Exit(fmt.Sprintf("ERROR: %q flag requires %q", watchFlag, configFlag), 1)
+				}
 
 				// Make sure the default db path exists (user does not specify path explicitly)
-				if !c.IsSet(dbPathFlag) {
+				if !c.IsSet(dbPathFlag) && !c.IsSet(dataDirFlag) && !c.IsSet(profileFlag) {
 					if err := os.MkdirAll(filepath.Dir(c.String(dbPathFlag)), os.ModePerm); err != nil {
 						return cli.Exit(err.Error(), 1)
 					}
@@ -196,9 +300,22 @@ func buildCLI() *cli.App {
 					return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(logLevelFlag), logLevelFlag), 1)
 				}
 
-				// Check that ip address is valid
-				if c.IsSet(ipFlag) && net.ParseIP(c.String(ipFlag)) == nil {
-					return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(ipFlag), ipFlag), 1)
+				// Check that ip addresses are valid
+				for _, flag := range []string{ipFlag, uiIPFlag, internalIPFlag, broadcastAddressFlag} {
+					if c.IsSet(flag) && net.ParseIP(c.String(flag)) == nil {
+						return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(flag), flag), 1)
+					}
+				}
+
+				if c.IsSet(listenFlag) {
+					if path := strings.TrimPrefix(c.String(listenFlag), "unix://"); path == "" || path == c.String(listenFlag) {
+						return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q: only unix:// addresses are supported", c.String(listenFlag), listenFlag), 1)
+					}
+					for _, flag := range []string{ipFlag, portFlag} {
+						if c.IsSet(flag) {
+							return cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", listenFlag, flag), 1)
+						}
+					}
 				}
 
 				if c.IsSet(configFlag) {
@@ -218,10 +335,28 @@ func buildCLI() *cli.App {
 					uiPort          = serverPort + 1000
 					uiIP            = ip
 					uiCodecEndpoint = ""
+					dataDir         = c.String(dataDirFlag)
 				)
 
+				if c.IsSet(profileFlag) {
+					p, err := loadProfile(c.String(profileFlag))
+					if err != nil {
+						return err
+					}
+					dataDir = p.DataDir
+					if !c.IsSet(portFlag) {
+						serverPort = p.Port
+					}
+					uiPort = p.UIPort
+					if !c.IsSet(metricsPortFlag) {
+						metricsPort = p.MetricsPort
+					}
+				}
+
 				if c.IsSet(uiPortFlag) {
 					uiPort = c.Int(uiPortFlag)
+				} else if c.IsSet(portFlag) {
+					uiPort = serverPort + 1000
 				}
 
 				if c.IsSet(uiIPFlag) {
@@ -232,22 +367,42 @@ func buildCLI() *cli.App {
 					uiCodecEndpoint = c.String(uiCodecEndpointFlag)
 				}
 
+				if c.Bool(detachFlag) {
+					return startDetached(c, datadir.Dir(dataDir))
+				}
+
 				pragmas, err := getPragmaMap(c.StringSlice(pragmaFlag))
 				if err != nil {
 					return err
 				}
 
-				baseConfig := &config.Config{}
-				if c.IsSet(configFlag) {
-					// Temporal server requires a couple of persistence config values to
-					// be explicitly set or the config loading fails. While these are the
-					// same values used internally, they are overridden later anyways,
-					// they are just here to pass validation.
-					baseConfig.Persistence.DefaultStore = liteconfig.PersistenceStoreName
-					baseConfig.Persistence.NumHistoryShards = 1
-					if err := config.Load("temporalite", c.String(configFlag), "", &baseConfig); err != nil {
-						return err
+				var generatedTLS *datadir.ClientTLS
+				if c.Bool(tlsFlag) {
+					var hosts []string
+					for _, addr := range []string{ip, c.String(internalIPFlag), c.String(broadcastAddressFlag)} {
+						if ip := net.ParseIP(addr); ip != nil && !ip.IsUnspecified() {
+							hosts = append(hosts, ip.String())
+						}
+					}
+					if generatedTLS, err = datadir.Dir(dataDir).GenerateTLS(hosts...); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to generate TLS material: %v", err), 1)
+					}
+				}
+				loadConfig := func() (*config.Config, error) {
+					baseConfig, err := loadBaseConfig(c.String(configFlag))
+					if err != nil {
+						return nil, err
 					}
+					if generatedTLS != nil {
+						if err := serveGeneratedTLS(baseConfig, datadir.Dir(dataDir), generatedTLS); err != nil {
+							return nil, err
+						}
+					}
+					return baseConfig, nil
+				}
+				baseConfig, err := loadConfig()
+				if err != nil {
+					return err
 				}
 
 				interruptChan := make(chan interface{}, 1)
@@ -260,43 +415,106 @@ func buildCLI() *cli.App {
 						interruptChan <- s
 					}
 				}()
+				if dataDir != "" {
+					// The stop command asks for a shutdown through the data directory, which
+					// unlike signals also works for servers in the background on Windows.
+					stopCtx, stopPolling := context.WithCancel(c.Context)
+					defer stopPolling()
+					go func() {
+						ticker := time.NewTicker(250 * time.Millisecond)
+						defer ticker.Stop()
+						for {
+							select {
+							case <-stopCtx.Done():
+								return
+							case <-ticker.C:
+								if datadir.Dir(dataDir).StopRequested(os.Getpid()) {
+									select {
+									case interruptChan <- "stop request":
+									case <-stopCtx.Done():
+									}
+									return
+								}
+							}
+						}
+					}()
+				}
 
+				frontendPort := serverPort
+				frontendAddr := net.JoinHostPort(ip, strconv.Itoa(serverPort))
+				if c.IsSet(listenFlag) {
+					// The frontend's loopback listener, used by the other services, takes any free port.
+					frontendPort = 0
+					frontendAddr = c.String(listenFlag)
+				}
 				opts := []temporalite.ServerOption{
 					temporalite.WithDynamicPorts(),
-					temporalite.WithFrontendPort(serverPort),
+					temporalite.WithFrontendPort(frontendPort),
 					temporalite.WithMetricsPort(metricsPort),
 					temporalite.WithFrontendIP(ip),
 					temporalite.WithDatabaseFilePath(c.String(dbPathFlag)),
 					temporalite.WithNamespaces(c.StringSlice(namespaceFlag)...),
 					temporalite.WithSQLitePragmas(pragmas),
-					temporalite.WithUpstreamOptions(
-						temporal.InterruptOn(interruptChan),
-					),
-					temporalite.WithBaseConfig(baseConfig),
 				}
+				if c.IsSet(listenFlag) {
+					opts = append(opts, temporalite.WithFrontendUnixSocket(strings.TrimPrefix(frontendAddr, "unix://")))
+				}
+				if c.IsSet(httpPortFlag) {
+					opts = append(opts, temporalite.WithHTTPPort(c.Int(httpPortFlag)))
+				}
+				if c.Bool(grpcReflectionFlag) {
+					opts = append(opts, temporalite.WithGRPCReflection())
+				}
+				if c.IsSet(internalIPFlag) {
+					opts = append(opts, temporalite.WithInternalIP(c.String(internalIPFlag)))
+				}
+				if c.IsSet(broadcastAddressFlag) {
+					opts = append(opts, temporalite.WithBroadcastAddress(c.String(broadcastAddressFlag)))
+				}
+				// The UI cannot be stopped without exiting the process, it keeps running
+				// across restarts of the server until the process exits.
 				if !c.Bool(headlessFlag) {
-					frontendAddr := fmt.Sprintf("%s:%d", ip, serverPort)
 					cfg := &uiConfig{
 						Host:                uiIP,
 						Port:                uiPort,
 						TemporalGRPCAddress: frontendAddr,
 						EnableUI:            true,
 						CodecEndpoint:       uiCodecEndpoint,
+						TLS:                 generatedTLS,
 					}
 
-					opt, err := newUIOption(cfg, c.String(configFlag))
+					server, err := newUIServer(cfg, c.String(configFlag))
 					if err != nil {
 						return err
 					}
-					if opt != nil {
-						opts = append(opts, opt)
+					if server != nil {
+						opts = append(opts, temporalite.WithUI(newPersistentUI(server)))
 					}
 				}
 				if c.Bool(ephemeralFlag) {
 					opts = append(opts, temporalite.WithPersistenceDisabled())
 				}
+				if dataDir != "" {
+					opts = append(opts, temporalite.WithDataDir(dataDir))
+				}
+				if c.Bool(forceFlag) {
+					opts = append(opts, temporalite.WithForcedDatabaseLock())
+				}
+				if c.Bool(readOnlyFlag) {
+					opts = append(opts, temporalite.WithReadOnly())
+				}
+				if c.IsSet(encryptionKeyFileFlag) {
+					key, err := readEncryptionKey(c)
+					if err != nil {
+						return err
+					}
+					opts = append(opts, temporalite.WithDatabaseEncryptionKey(key))
+				}
 
-				var logger log.Logger
+				var (
+					logger    log.Logger
+					zapLogger *zap.Logger
+				)
 				switch c.String(logFormatFlag) {
 				case "pretty":
 					lcfg := zap.NewDevelopmentConfig()
@@ -320,15 +538,30 @@ func buildCLI() *cli.App {
 					if err != nil {
 						return err
 					}
-					logger = log.NewZapLogger(l)
+					zapLogger = l
 				case "noop":
 					logger = log.NewNoopLogger()
 				default:
-					logger = log.NewZapLogger(log.BuildZapLogger(log.Config{
+					zapLogger = log.BuildZapLogger(log.Config{
 						Stdout:     true,
 						Level:      c.String(logLevelFlag),
 						OutputFile: "",
-					}))
+					})
+				}
+				if zapLogger != nil {
+					// Also keep JSON logs in the data directory, at the same level as the console
+					if dataDir != "" {
+						logFile, err := openLogFile(datadir.Dir(dataDir).LogFile())
+						if err != nil {
+							return err
+						}
+						defer func() { _ = logFile.Close() }()
+						zapLogger = zapLogger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+							fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), logFile, core)
+							return zapcore.NewTee(core, fileCore)
+						}))
+					}
+					logger = log.NewZapLogger(zapLogger)
 				}
 				opts = append(opts, temporalite.WithLogger(logger))
 
@@ -340,22 +573,221 @@ func buildCLI() *cli.App {
 					opts = append(opts, temporalite.WithDynamicConfigValue(k, v))
 				}
 
-				s, err := temporalite.NewServer(opts...)
+				var dynamicConfig *reloadableDynamicConfig
+				defer func() {
+					if dynamicConfig != nil {
+						dynamicConfig.Close()
+					}
+				}()
+				// The state file is removed however the server stops, once this process wrote it.
+				var wroteState bool
+				if dataDir != "" {
+					defer func() {
+						if !wroteState {
+							return
+						}
+						if err := datadir.Dir(dataDir).RemoveState(); err != nil {
+							logger.Warn("Unable to remove server state file", tag.Error(err))
+						}
+					}()
+				}
+				// startServer starts a server in the background, which stops through
+				// temporal.InterruptOn once a value is sent to interrupt. Start returns on
+				// stopped once the server stopped, or failed to start.
+				startServer := func(baseConfig *config.Config) (interrupt chan<- interface{}, stopped <-chan error, err error) {
+					interruptCh := make(chan interface{}, 1)
+					opts := append(opts[:len(opts):len(opts)], temporalite.WithBaseConfig(baseConfig), temporalite.WithInterruptOn(interruptCh))
+					if dynamicConfig != nil {
+						dynamicConfig.Close()
+						dynamicConfig = nil
+					}
+					if c.Bool(watchFlag) && baseConfig.DynamicConfigClient != nil {
+						d, err := newReloadableDynamicConfig(baseConfig.DynamicConfigClient, logger)
+						if err != nil {
+							return nil, nil, err
+						}
+						dynamicConfig = d
+						opts = append(opts, temporalite.WithUpstreamOptions(temporal.WithDynamicConfigClient(d)))
+					}
+
+					s, err := temporalite.NewServer(opts...)
+					if err != nil {
+						var lockErr *dblock.HeldError
+						if errors.As(err, &lockErr) {
+							return nil, nil, cli.Exit(fmt.Sprintf("ERROR: %v. Stop that process, or restart with --%s if it is hung.", err, forceFlag), 1)
+						}
+						if errors.Is(err, encryption.ErrKeyRequired) {
+							return nil, nil, cli.Exit(fmt.Sprintf("ERROR: %v. Pass the key it was created with using --%s.", err, encryptionKeyFileFlag), 1)
+						}
+						var portErr *temporalite.PortConflictError
+						if errors.As(err, &portErr) {
+							return nil, nil, cli.Exit(portConflictMessage(portErr), 1)
+						}
+						return nil, nil, err
+					}
+
+					// The state file is written once the frontend is serving, so that readers of
+					// the file can connect right away. stopped only fires once it was written, or
+					// given up on.
+					readyCtx, cancelReady := context.WithCancel(c.Context)
+					recorded := make(chan struct{})
+					go func() {
+						defer close(recorded)
+						if dataDir == "" || s.WaitReady(readyCtx) != nil {
+							return
+						}
+						state := datadir.State{
+							PID:             os.Getpid(),
+							StartedAt:       time.Now(),
+							Version:         version,
+							ServerVersion:   headers.ServerVersion,
+							FrontendAddress: s.FrontendHostPort(),
+							MetricsAddress:  s.MetricsHostPort(),
+							HTTPAddress:     s.HTTPHostPort(),
+							Namespaces:      c.StringSlice(namespaceFlag),
+						}
+						if !c.Bool(headlessFlag) {
+							state.UIAddress = net.JoinHostPort(uiIP, strconv.Itoa(uiPort))
+							state.UIURL = "http://" + state.UIAddress
+						}
+						state.TLS = generatedTLS
+						if state.TLS == nil {
+							state.TLS = clientTLS(baseConfig)
+						}
+						if err := datadir.Dir(dataDir).WriteState(state); err != nil {
+							logger.Warn("Unable to write server state file", tag.Error(err))
+						} else {
+							wroteState = true
+						}
+					}()
+					stoppedCh := make(chan error, 1)
+					go func() {
+						err := s.Start()
+						cancelReady()
+						<-recorded
+						stoppedCh <- err
+					}()
+					return interruptCh, stoppedCh, nil
+				}
+
+				interrupt, stopped, err := startServer(baseConfig)
 				if err != nil {
 					return err
 				}
-
-				if err := s.Start(); err != nil {
-					return cli.Exit(fmt.Sprintf("Unable to start server. Error: %v", err), 1)
+				var changes <-chan []string
+				stopWatching := func() {}
+				watch := func() {
+					stopWatching()
+					var ctx context.Context
+					ctx, stopWatching = context.WithCancel(c.Context)
+					var files []string
+					if baseConfig.DynamicConfigClient != nil {
+						files = append(files, baseConfig.DynamicConfigClient.Filepath)
+					}
+					changes = watchFiles(ctx, []string{c.String(configFlag)}, files...)
+				}
+				if c.Bool(watchFlag) {
+					watch()
+				}
+				for {
+					select {
+					case signal := <-interruptChan:
+						stopWatching()
+						interrupt <- signal
+						if err := <-stopped; err != nil {
+							return cli.Exit(fmt.Sprintf("Unable to start server. Error: %v", err), 1)
+						}
+						return cli.Exit("All services are stopped.", 0)
+					case err := <-stopped:
+						// Only returns before an interrupt when the server fails to start.
+						stopWatching()
+						return cli.Exit(fmt.Sprintf("Unable to start server. Error: %v", err), 1)
+					case changed := <-changes:
+						var restart bool
+						for _, path := range changed {
+							switch {
+							case dynamicConfig != nil && path == dynamicConfig.config.Filepath:
+								if err := dynamicConfig.Reload(); err != nil {
+									logger.Error("Unable to reload dynamic config file.", tag.Error(err))
+								} else {
+									logger.Info("Reloaded dynamic config file.", tag.Value(path))
+								}
+							case strings.HasPrefix(filepath.Base(path), "temporalite-ui"):
+								logger.Warn("UI config changes are only applied when Temporalite is restarted.", tag.Value(path))
+							default:
+								restart = true
+							}
+						}
+						if !restart {
+							continue
+						}
+						newConfig, err := loadConfig()
+						if err != nil {
+							logger.Error("Unable to load changed config, the server keeps running with the previous one.", tag.Error(err))
+							continue
+						}
+						logger.Info("Config changed, restarting the server.", tag.Value(changed))
+						interrupt <- "config change"
+						if err := <-stopped; err != nil {
+							stopWatching()
+							return cli.Exit(fmt.Sprintf("Unable to start server. Error: %v", err), 1)
+						}
+						baseConfig = newConfig
+						if interrupt, stopped, err = startServer(baseConfig); err != nil {
+							stopWatching()
+							return err
+						}
+						watch()
+					}
 				}
-				return cli.Exit("All services are stopped.", 0)
 			},
 		},
+		newDBCommand(defaultCfg),
+		newProfileCommand(),
+		newStatusCommand(),
+		newStopCommand(),
+		newHealthcheckCommand(),
+		newEnvCommand(),
+		newNamespaceCommand(),
+		newWorkflowCommand(defaultCfg),
+		newCompletionCommand(),
+		newVersionCommand(),
 	}
+	// dev shares the flags and behavior of the start command.
+	app.Commands = append(app.Commands, newDevCommand(app.Command("start")))
 
 	return app
 }
 
+// portConflictMessage lists every port the server needs, with the processes using those
+// that are unavailable.
+func portConflictMessage(err *temporalite.PortConflictError) string {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "ERROR: ports needed by Temporalite are unavailable:")
+	fmt.Fprintln(&buf)
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ADDRESS\tPURPOSE\tSTATUS")
+	for _, p := range err.Ports {
+		status := "free"
+		var opErr *net.OpError
+		switch {
+		case p.Err == nil:
+		case p.PID != 0:
+			status = fmt.Sprintf("in use by %s (pid %d)", p.Process, p.PID)
+		case errors.As(p.Err, &opErr):
+			status = opErr.Err.Error()
+		default:
+			status = p.Err.Error()
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", p.Address, p.Purpose, status)
+	}
+	_ = w.Flush()
+	fmt.Fprintln(&buf)
+	fmt.Fprintf(&buf, "Stop the processes using them, or pass --%s, --%s, --%s or --%s to use other ports. The other ports are chosen by the system.",
+		portFlag, uiPortFlag, metricsPortFlag, httpPortFlag)
+	return buf.String()
+}
+
 func getPragmaMap(input []string) (map[string]string, error) {
 	result := make(map[string]string)
 	for _, pragma := range input {
@@ -385,3 +817,23 @@ func getDynamicConfigValues(input []string) (map[dynamicconfig.Key][]dynamicconf
 	}
 	return ret, nil
 }
+
+func openLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// readEncryptionKey reads the database encryption key from the file passed with --db-encryption-key-file.
+func readEncryptionKey(c *cli.Context) ([]byte, error) {
+	data, err := os.ReadFile(c.String(encryptionKeyFileFlag))
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("bad value %q passed for flag %q: %v", c.String(encryptionKeyFileFlag), encryptionKeyFileFlag, err), 1)
+	}
+	key, err := encryption.ParseKey(data)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("bad value %q passed for flag %q: %v", c.String(encryptionKeyFileFlag), encryptionKeyFileFlag, err), 1)
+	}
+	return key, nil
+}
@@ -25,12 +25,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -39,10 +46,31 @@ import (
 	"github.com/urfave/cli/v2"
 	"go.temporal.io/api/enums/v1"
 	"go.temporal.io/sdk/client"
+	sdkworker "go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+	"go.temporal.io/server/api/adminservice/v1"
+	"go.temporal.io/server/service/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/temporalio/temporalite/internal/liteconfig"
 )
 
+// runMainEnv makes the test binary run the CLI instead of the tests, for tests that need
+// the CLI in a separate process.
+const runMainEnv = "TEMPORALITE_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func TestGetDynamicConfigValues(t *testing.T) {
 	assertBadVal := func(v string) {
 		if _, err := getDynamicConfigValues([]string{v}); err == nil {
@@ -115,12 +143,14 @@ func assertServerHealth(t *testing.T, ctx context.Context, opts client.Options)
 	}
 
 	// Check for pollers on a system task queue to ensure that the worker service is running.
+	// The default worker is the last one the worker service starts, stopping the server
+	// while the others start fails them fatally.
 	for {
 		if ctx.Err() != nil {
 			t.Error(ctx.Err())
 			break
 		}
-		resp, err := c.DescribeTaskQueue(ctx, "temporal-sys-tq-scanner-taskqueue-0", enums.TASK_QUEUE_TYPE_WORKFLOW)
+		resp, err := c.DescribeTaskQueue(ctx, worker.DefaultWorkerTaskQueue, enums.TASK_QUEUE_TYPE_WORKFLOW)
 		if err != nil {
 			t.Error(err)
 		}
@@ -129,6 +159,38 @@ func assertServerHealth(t *testing.T, ctx context.Context, opts client.Options)
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
+
+	if err := waitForScanners(ctx, c); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitForScanners waits for the worker service to start its scanner workflows, using a client
+// of the temporal-system namespace. The worker service retries starting them with a backoff of
+// up to a minute and waits for them to be started when it stops, which would hold up stopping
+// the server.
+func waitForScanners(ctx context.Context, c client.Client) error {
+	// The task queue scanner only runs with SQL stores, not with the encrypted store.
+	resp, err := c.DescribeTaskQueue(ctx, "temporal-sys-tq-scanner-taskqueue-0", enums.TASK_QUEUE_TYPE_WORKFLOW)
+	if err != nil {
+		return err
+	}
+	workflowIDs := []string{"temporal-sys-history-scanner"}
+	if len(resp.GetPollers()) > 0 {
+		workflowIDs = append(workflowIDs, "temporal-sys-tq-scanner")
+	}
+	for _, workflowID := range workflowIDs {
+		for {
+			if _, err := c.DescribeWorkflowExecution(ctx, workflowID, ""); err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+	}
+	return nil
 }
 
 func TestCreateDataDirectory(t *testing.T) {
@@ -219,3 +281,485 @@ func TestCreateDataDirectory(t *testing.T) {
 		assertServerHealth(t, ctx, clientOpts)
 	})
 }
+
+func TestDatabaseLock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port1 = portProvider.MustGetFreePort()
+		port2 = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	dbPath := filepath.Join(t.TempDir(), "foo.db")
+	args, clientOpts := newServerAndClientOpts(port1, "-f", dbPath)
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	assertServerHealth(t, ctx, clientOpts)
+
+	// A second server must not open the same database file
+	args, _ = newServerAndClientOpts(port2, "-f", dbPath)
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	if err := temporaliteCLI.RunContext(ctx, args); err != nil {
+		if !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+			t.Errorf("expected error %q to contain pid %d", err, os.Getpid())
+		}
+	} else {
+		t.Error("no error when database file is locked")
+	}
+}
+
+func TestRestartDatabase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dbPath := filepath.Join(t.TempDir(), "foo.db")
+	// The second server starts right after the first one stops, while the membership
+	// records of the first one are still fresh.
+	for i := 0; i < 2; i++ {
+		portProvider := liteconfig.NewPortProvider()
+		port := portProvider.MustGetFreePort()
+		portProvider.Close()
+
+		args, clientOpts := newServerAndClientOpts(port, "-f", dbPath)
+		serverCtx, stopServer := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			temporaliteCLI := buildCLI()
+			temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+			if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+				fmt.Println("Server closed with error:", err)
+			}
+		}()
+		assertServerHealth(t, ctx, clientOpts)
+		stopServer()
+		<-done
+	}
+}
+
+func TestListenIP(t *testing.T) {
+	if l, err := net.Listen("tcp", "[::1]:0"); err != nil {
+		t.Skip("IPv6 is not available:", err)
+	} else {
+		_ = l.Close()
+	}
+
+	for _, tc := range []struct {
+		args        []string
+		clientHosts []string
+	}{
+		{args: []string{"--ip", "127.0.0.1"}, clientHosts: []string{"127.0.0.1"}},
+		{args: []string{"--ip", "::1"}, clientHosts: []string{"::1"}},
+		// Dual-stack
+		{args: []string{"--ip", "::"}, clientHosts: []string{"127.0.0.1", "::1"}},
+		{args: []string{"--ip", "::", "--internal-ip", "::", "--broadcast-address", "::1"}, clientHosts: []string{"::1"}},
+	} {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			portProvider := liteconfig.NewPortProvider()
+			var (
+				port        = portProvider.MustGetFreePort()
+				metricsPort = portProvider.MustGetFreePort()
+			)
+			portProvider.Close()
+
+			serverCtx, stopServer := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				temporaliteCLI := buildCLI()
+				temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+				args, _ := newServerAndClientOpts(port, append(tc.args, "--metrics-port", strconv.Itoa(metricsPort))...)
+				if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+					fmt.Println("Server closed with error:", err)
+				}
+			}()
+
+			for _, host := range tc.clientHosts {
+				_, clientOpts := newServerAndClientOpts(port)
+				clientOpts.HostPort = net.JoinHostPort(host, strconv.Itoa(port))
+				assertServerHealth(t, ctx, clientOpts)
+
+				// Readiness covers the history and matching services listening on the broadcast address.
+				readyURL := fmt.Sprintf("http://%s/readyz", net.JoinHostPort(host, strconv.Itoa(metricsPort)))
+				for {
+					resp, err := http.Get(readyURL)
+					if err == nil {
+						_ = resp.Body.Close()
+						if resp.StatusCode == http.StatusOK {
+							break
+						}
+					}
+					if ctx.Err() != nil {
+						t.Fatalf("%s never became ready: %v", readyURL, err)
+					}
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+
+			stopServer()
+			<-done
+		})
+	}
+
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	if err := temporaliteCLI.RunContext(context.Background(), []string{"temporalite", "start", "--ephemeral", "--ui-ip", "localhost:8233"}); err == nil || !strings.Contains(err.Error(), uiIPFlag) {
+		t.Errorf("expected error for invalid --ui-ip, got %v", err)
+	}
+	if err := temporaliteCLI.RunContext(context.Background(), []string{"temporalite", "start", "--ephemeral", "--headless", "--internal-ip", "127.0.0.1", "--broadcast-address", "::1"}); err == nil || !strings.Contains(err.Error(), "cannot be reached") {
+		t.Errorf("expected error for a broadcast address not reaching the internal services, got %v", err)
+	}
+}
+
+func TestInternalIP(t *testing.T) {
+	// Linux routes the whole 127.0.0.0/8 block to the loopback interface, standing in for a
+	// private address of a container network.
+	const internalIP = "127.0.0.2"
+	if l, err := net.Listen("tcp", net.JoinHostPort(internalIP, "0")); err != nil {
+		t.Skip("loopback address is not available:", err)
+	} else {
+		_ = l.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port        = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	// The frontend stays on the default --ip
+	args, clientOpts := newServerAndClientOpts(port, "--internal-ip", internalIP, "--metrics-port", strconv.Itoa(metricsPort))
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	assertServerHealth(t, ctx, clientOpts)
+
+	// The history and matching services advertise the internal address in the membership ring,
+	// while clients keep reaching the frontend on localhost.
+	conn, err := grpc.DialContext(ctx, clientOpts.HostPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	resp, err := adminservice.NewAdminServiceClient(conn).DescribeCluster(ctx, &adminservice.DescribeClusterRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ring := range resp.GetMembershipInfo().GetRings() {
+		for _, member := range ring.GetMembers() {
+			if host, _, _ := net.SplitHostPort(member.GetIdentity()); host != internalIP {
+				t.Errorf("expected %s service at %s, got %s", ring.GetRole(), internalIP, member.GetIdentity())
+			}
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	run := func(ctx context.Context, args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite"}, args...))
+		return out.String(), err
+	}
+
+	if _, err := run(ctx, "start", "--ephemeral", "--listen", "tcp://127.0.0.1:7233"); err == nil || !strings.Contains(err.Error(), listenFlag) {
+		t.Errorf("expected error for non-unix --listen address, got %v", err)
+	}
+	if _, err := run(ctx, "start", "--ephemeral", "--listen", "unix:///tmp/temporal.sock", "--port", "7233"); err == nil || !strings.Contains(err.Error(), "only one of") {
+		t.Errorf("expected error combining --listen and --port, got %v", err)
+	}
+
+	address := "unix://" + filepath.Join(t.TempDir(), "temporal.sock")
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := run(serverCtx, "start", "--ephemeral", "--namespace", "default", "--log-format", "noop", "--headless", "--listen", address); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+
+	assertServerHealth(t, ctx, client.Options{HostPort: address, Namespace: "temporal-system"})
+	if out, err := run(ctx, "healthcheck", "--address", address, "--namespace", "default"); err != nil {
+		t.Errorf("health check through the socket failed: %v: %s", err, out)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(strings.TrimPrefix(address, "unix://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("expected socket mode 0600, got %o", mode)
+		}
+	}
+
+	stopServer()
+	<-done
+}
+
+func httpAPIWorkflow(ctx workflow.Context, name string) (string, error) {
+	if err := workflow.SetQueryHandler(ctx, "state", func() (string, error) { return "waiting", nil }); err != nil {
+		return "", err
+	}
+	workflow.GetSignalChannel(ctx, "done").Receive(ctx, nil)
+	return "hello " + name, nil
+}
+
+func TestHTTPAPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		frontendPort = portProvider.MustGetFreePort()
+		httpPort     = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	args, clientOpts := newServerAndClientOpts(frontendPort, "--ephemeral", "--http-port", strconv.Itoa(httpPort))
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	assertServerHealth(t, ctx, clientOpts)
+
+	c, err := client.Dial(client.Options{HostPort: clientOpts.HostPort, Namespace: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w := sdkworker.New(c, "http-api", sdkworker.Options{})
+	w.RegisterWorkflowWithOptions(httpAPIWorkflow, workflow.RegisterOptions{Name: "HTTPAPI"})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	call := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://localhost:%d/api/v1/namespaces/default%s", httpPort, path), strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var resp map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, resp
+	}
+	// Payloads are encoded in base64 like any bytes field.
+	payload := func(value string) string {
+		return fmt.Sprintf(`{"metadata": {"encoding": %q}, "data": %q}`,
+			base64.StdEncoding.EncodeToString([]byte("json/plain")), base64.StdEncoding.EncodeToString([]byte(strconv.Quote(value))))
+	}
+
+	code, resp := call(http.MethodPost, "/workflows/http-wf/start",
+		`{"workflowType": {"name": "HTTPAPI"}, "taskQueue": {"name": "http-api"}, "input": {"payloads": [`+payload("curl")+`]}}`)
+	if code != http.StatusOK || resp["runId"] == "" {
+		t.Fatalf("start failed with %d: %v", code, resp)
+	}
+	runID := resp["runId"].(string)
+
+	code, resp = call(http.MethodPost, "/workflows/http-wf/query", `{"query": {"queryType": "state"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("query failed with %d: %v", code, resp)
+	}
+	result := resp["queryResult"].(map[string]interface{})["payloads"].([]interface{})[0].(map[string]interface{})["data"]
+	if want := base64.StdEncoding.EncodeToString([]byte(`"waiting"`)); result != want {
+		t.Errorf("query returned %v, want %v", result, want)
+	}
+
+	if code, resp = call(http.MethodPost, "/workflows/http-wf/runs/"+runID+"/signal", `{"signalName": "done"}`); code != http.StatusOK {
+		t.Fatalf("signal failed with %d: %v", code, resp)
+	}
+	var greeting string
+	if err := c.GetWorkflow(ctx, "http-wf", runID).Get(ctx, &greeting); err != nil {
+		t.Fatal(err)
+	} else if greeting != "hello curl" {
+		t.Errorf("workflow returned %q", greeting)
+	}
+
+	code, resp = call(http.MethodGet, "/workflows/http-wf/runs/"+runID, "")
+	if code != http.StatusOK {
+		t.Fatalf("describe failed with %d: %v", code, resp)
+	} else if status := resp["workflowExecutionInfo"].(map[string]interface{})["status"]; status != "Completed" {
+		t.Errorf("described status %v", status)
+	}
+	code, resp = call(http.MethodGet, "/workflows/http-wf/events?maximumPageSize=2", "")
+	if code != http.StatusOK {
+		t.Fatalf("history failed with %d: %v", code, resp)
+	} else if events := resp["history"].(map[string]interface{})["events"].([]interface{}); len(events) == 0 {
+		t.Error("history returned no events")
+	} else if resp["nextPageToken"] == nil {
+		// Pages hold whole batches of events, but the history spans more than one.
+		t.Error("history did not return the next page token")
+	}
+	code, resp = call(http.MethodGet, "/workflows?query="+url.QueryEscape("WorkflowType='HTTPAPI'"), "")
+	if code != http.StatusOK {
+		t.Fatalf("list failed with %d: %v", code, resp)
+	} else if executions := resp["executions"].([]interface{}); len(executions) != 1 {
+		t.Errorf("list returned %d executions, want 1", len(executions))
+	}
+
+	if code, resp = call(http.MethodGet, "/workflows/missing", ""); code != http.StatusNotFound {
+		t.Errorf("describing a missing workflow returned %d: %v", code, resp)
+	}
+	if code, resp = call(http.MethodPost, "/workflows/http-wf/start", `{"bogus": true}`); code != http.StatusBadRequest {
+		t.Errorf("starting with an unknown field returned %d: %v", code, resp)
+	}
+	if code, resp = call(http.MethodGet, "/workflows/http-wf/start", ""); code != http.StatusNotImplemented {
+		t.Errorf("GET on start returned %d: %v", code, resp)
+	}
+}
+
+func TestGRPCReflection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	args, clientOpts := newServerAndClientOpts(port, "--ephemeral", "--grpc-reflection")
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	assertServerHealth(t, ctx, clientOpts)
+
+	conn, err := grpc.DialContext(ctx, clientOpts.HostPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for symbol, want := range map[string]string{
+		"temporal.api.workflowservice.v1.WorkflowService":               "StartWorkflowExecution",
+		"temporal.api.operatorservice.v1.OperatorService":               "AddSearchAttributes",
+		"temporal.api.workflowservice.v1.StartWorkflowExecutionRequest": "workflow_id",
+	} {
+		if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+		if len(files) == 0 {
+			t.Errorf("no descriptor returned for %s: %v", symbol, resp.GetErrorResponse())
+			continue
+		}
+		// Files are returned along with those they depend on, which are only sent once per stream.
+		var fd descriptorpb.FileDescriptorProto
+		if err := proto.Unmarshal(files[0], &fd); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(fd.String(), strconv.Quote(want)) {
+			t.Errorf("descriptor returned for %s does not declare %s", symbol, want)
+		}
+	}
+}
+
+func TestPortConflict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	args, _ := newServerAndClientOpts(port, "--ephemeral")
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	err = temporaliteCLI.RunContext(ctx, args)
+	if err == nil {
+		t.Fatal("expected server to fail starting on a port in use")
+	}
+	for _, want := range []string{
+		fmt.Sprintf("127.0.0.1:%d", port),
+		"frontend gRPC",
+		"history membership",
+		"--port",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(err.Error(), fmt.Sprintf("(pid %d)", os.Getpid())) {
+		t.Errorf("expected error to report the test process using the port, got:\n%v", err)
+	}
+}
@@ -49,43 +49,43 @@ import (
 	"github.com/temporalio/temporalite/internal/liteconfig"
 )
 
+func mtlsExampleDir() string {
+	_, thisFile, _, _ := runtime.Caller(0)
+	return filepath.Join(thisFile, "../../../internal/examples/mtls")
+}
+
+// writeMTLSConfig runs the templates of the mTLS example config files and puts them in confDir.
+func writeMTLSConfig(t *testing.T, confDir string, names ...string) {
+	mtlsDir := mtlsExampleDir()
+	for _, name := range names {
+		var buf bytes.Buffer
+		tmpl, err := template.New(name + ".template").
+			Funcs(template.FuncMap{"qualified": func(s string) string { return strconv.Quote(filepath.Join(mtlsDir, s)) }}).
+			ParseFiles(filepath.Join(mtlsDir, name+".template"))
+		if err != nil {
+			t.Fatal(err)
+		} else if err = tmpl.Execute(&buf, nil); err != nil {
+			t.Fatal(err)
+		} else if err = os.WriteFile(filepath.Join(confDir, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestMTLSConfig(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	_, thisFile, _, _ := runtime.Caller(0)
-	mtlsDir := filepath.Join(thisFile, "../../../internal/examples/mtls")
+	mtlsDir := mtlsExampleDir()
 
 	// Create temp config dir
 	confDir := t.TempDir()
-
-	// Run templated config and put in temp dir
-	var buf bytes.Buffer
-	tmpl, err := template.New("temporalite.yaml.template").
-		Funcs(template.FuncMap{"qualified": func(s string) string { return strconv.Quote(filepath.Join(mtlsDir, s)) }}).
-		ParseFiles(filepath.Join(mtlsDir, "temporalite.yaml.template"))
-	if err != nil {
-		t.Fatal(err)
-	} else if err = tmpl.Execute(&buf, nil); err != nil {
-		t.Fatal(err)
-	} else if err = os.WriteFile(filepath.Join(confDir, "temporalite.yaml"), buf.Bytes(), 0644); err != nil {
-		t.Fatal(err)
-	}
-	buf.Reset()
-	tmpl, err = template.New("temporalite-ui.yaml.template").
-		Funcs(template.FuncMap{"qualified": func(s string) string { return strconv.Quote(filepath.Join(mtlsDir, s)) }}).
-		ParseFiles(filepath.Join(mtlsDir, "temporalite-ui.yaml.template"))
-	if err != nil {
-		t.Fatal(err)
-	} else if err = tmpl.Execute(&buf, nil); err != nil {
-		t.Fatal(err)
-	} else if err = os.WriteFile(filepath.Join(confDir, "temporalite-ui.yaml"), buf.Bytes(), 0644); err != nil {
-		t.Fatal(err)
-	}
+	writeMTLSConfig(t, confDir, "temporalite.yaml", "temporalite-ui.yaml")
 
 	portProvider := liteconfig.NewPortProvider()
 	var (
 		frontendPort = portProvider.MustGetFreePort()
 		webUIPort    = portProvider.MustGetFreePort()
+		httpPort     = portProvider.MustGetFreePort()
 	)
 	portProvider.Close()
 
@@ -99,6 +99,7 @@ func TestMTLSConfig(t *testing.T) {
 		"--log-format", "noop",
 		"--port", strconv.Itoa(frontendPort),
 		"--ui-port", strconv.Itoa(webUIPort),
+		"--http-port", strconv.Itoa(httpPort),
 	}
 	go func() {
 		temporaliteCLI := buildCLI()
@@ -157,6 +158,24 @@ func TestMTLSConfig(t *testing.T) {
 		t.Fatalf("Bad state: %v", resp.NamespaceInfo.State)
 	}
 
+	// The HTTP API is served with the frontend's TLS configuration
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: options.ConnectionOptions.TLS}}
+	apiRes, err := httpClient.Get(fmt.Sprintf("https://localhost:%d/api/v1/namespaces/default/workflows", httpPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiRes.Body.Close()
+	if apiRes.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected HTTP API response %s", apiRes.Status)
+	}
+	// Go's TLS server answers plaintext requests with 400 Bad Request
+	if plainRes, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/namespaces/default/workflows", httpPort)); err == nil {
+		plainRes.Body.Close()
+		if plainRes.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Unexpected plaintext HTTP API response %s", plainRes.Status)
+		}
+	}
+
 	if !isUIPresent() {
 		t.Log("headless build detected, not testing temporal-ui mTLS")
 		return
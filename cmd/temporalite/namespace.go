@@ -0,0 +1,425 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/api/operatorservice/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/grpc"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/namespaces"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+const (
+	descriptionFlag = "description"
+	ownerEmailFlag  = "owner-email"
+	retentionFlag   = "retention"
+	dataFlag        = "data"
+)
+
+// namespaceManager manages namespaces either through a running server or directly in a
+// database file.
+type namespaceManager interface {
+	List(ctx context.Context) ([]namespaces.Namespace, error)
+	Describe(ctx context.Context, name string) (namespaces.Namespace, error)
+	Create(ctx context.Context, name string, opts namespaces.Options) (namespaces.Namespace, error)
+	Update(ctx context.Context, name string, opts namespaces.Options) (namespaces.Namespace, error)
+	Delete(ctx context.Context, name string) error
+	Close()
+}
+
+func newNamespaceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "namespace",
+		Usage: "Manage namespaces of a running server, or of a database file while no server uses it",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List namespaces",
+				ArgsUsage: " ",
+				Flags:     append(newNamespaceTargetFlags(), newOutputFlag()),
+				Before:    checkOutputFlag,
+				Action: withNamespaceManager(func(c *cli.Context, m namespaceManager) error {
+					list, err := m.List(c.Context)
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to list namespaces: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						if list == nil {
+							list = []namespaces.Namespace{}
+						}
+						return writeJSON(c.App.Writer, list)
+					}
+					return writeNamespaces(c.App.Writer, list)
+				}),
+			},
+			{
+				Name:         "describe",
+				Usage:        "Print the settings of a namespace",
+				ArgsUsage:    "NAME",
+				Flags:        append(newNamespaceTargetFlags(), newOutputFlag()),
+				Before:       requireNamespaceName(checkOutputFlag),
+				BashComplete: completeNamespaceArgs,
+				Action: withNamespaceManager(func(c *cli.Context, m namespaceManager) error {
+					ns, err := m.Describe(c.Context, c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to describe namespace: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						return writeJSON(c.App.Writer, ns)
+					}
+					return writeNamespace(c.App.Writer, ns)
+				}),
+			},
+			{
+				Name:      "create",
+				Usage:     "Register a namespace",
+				ArgsUsage: "NAME",
+				Flags:     append(newNamespaceTargetFlags(), newNamespaceOptionFlags(fmt.Sprintf("(default: %s)", namespaces.DefaultRetention))...),
+				Before:    requireNamespaceName(nil),
+				Action: withNamespaceManager(func(c *cli.Context, m namespaceManager) error {
+					opts, err := namespaceOptions(c)
+					if err != nil {
+						return err
+					}
+					ns, err := m.Create(c.Context, c.Args().First(), opts)
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to create namespace: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Created namespace %q\n", ns.Name)
+					return writeNamespace(c.App.Writer, ns)
+				}),
+			},
+			{
+				Name:         "update",
+				Usage:        "Change the settings of a namespace, leaving the ones not passed unchanged",
+				ArgsUsage:    "NAME",
+				Flags:        append(newNamespaceTargetFlags(), newNamespaceOptionFlags("")...),
+				Before:       requireNamespaceName(nil),
+				BashComplete: completeNamespaceArgs,
+				Action: withNamespaceManager(func(c *cli.Context, m namespaceManager) error {
+					opts, err := namespaceOptions(c)
+					if err != nil {
+						return err
+					}
+					ns, err := m.Update(c.Context, c.Args().First(), opts)
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to update namespace: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Updated namespace %q\n", ns.Name)
+					return writeNamespace(c.App.Writer, ns)
+				}),
+			},
+			{
+				Name:         "delete",
+				Usage:        "Delete a namespace along with its workflows",
+				ArgsUsage:    "NAME",
+				Flags:        newNamespaceTargetFlags(),
+				Before:       requireNamespaceName(nil),
+				BashComplete: completeNamespaceArgs,
+				Action: withNamespaceManager(func(c *cli.Context, m namespaceManager) error {
+					name := c.Args().First()
+					if err := m.Delete(c.Context, name); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to delete namespace: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Deleted namespace %q\n", name)
+					return nil
+				}),
+			},
+		},
+	}
+}
+
+// newNamespaceTargetFlags returns the flags selecting the server or database file whose
+// namespaces are managed.
+func newNamespaceTargetFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        addressFlag,
+			Usage:       "host:port of the temporal-frontend GRPC service",
+			DefaultText: defaultFrontendAddress,
+		},
+		&cli.StringFlag{
+			Name:    dbPathFlag,
+			Aliases: []string{"f"},
+			Usage:   "database file to change directly, no server may be using it",
+		},
+	}, append(newServerDirFlags(), newClientTLSFlags()...)...)
+}
+
+func newNamespaceOptionFlags(retentionDefault string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  descriptionFlag,
+			Usage: "namespace description",
+		},
+		&cli.StringFlag{
+			Name:  ownerEmailFlag,
+			Usage: "email of the namespace owner",
+		},
+		&cli.DurationFlag{
+			Name:        retentionFlag,
+			Usage:       "how long closed workflows are kept, eg. 72h",
+			DefaultText: retentionDefault,
+		},
+		&cli.StringSliceFlag{
+			Name:  dataFlag,
+			Usage: "namespace data entry as KEY=VALUE, merged with the existing entries",
+		},
+	}
+}
+
+func requireNamespaceName(next cli.BeforeFunc) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return cli.Exit(fmt.Sprintf("ERROR: %s command requires a namespace name as its only argument.", c.Command.Name), 1)
+		}
+		if next != nil {
+			return next(c)
+		}
+		return nil
+	}
+}
+
+func namespaceOptions(c *cli.Context) (namespaces.Options, error) {
+	var opts namespaces.Options
+	if c.IsSet(descriptionFlag) {
+		description := c.String(descriptionFlag)
+		opts.Description = &description
+	}
+	if c.IsSet(ownerEmailFlag) {
+		owner := c.String(ownerEmailFlag)
+		opts.OwnerEmail = &owner
+	}
+	if c.IsSet(retentionFlag) {
+		retention := c.Duration(retentionFlag)
+		opts.Retention = &retention
+	}
+	for _, entry := range c.StringSlice(dataFlag) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return opts, cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", entry, dataFlag), 1)
+		}
+		if opts.Data == nil {
+			opts.Data = make(map[string]string)
+		}
+		opts.Data[key] = value
+	}
+	return opts, nil
+}
+
+// withNamespaceManager opens the namespace manager selected by the command's flags for action.
+func withNamespaceManager(action func(*cli.Context, namespaceManager) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		m, err := openNamespaceManager(c)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		return action(c, m)
+	}
+}
+
+func openNamespaceManager(c *cli.Context) (namespaceManager, error) {
+	var set []string
+	for _, name := range []string{addressFlag, dbPathFlag, dataDirFlag, profileFlag} {
+		if c.IsSet(name) {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", set[0], set[1]), 1)
+	}
+
+	clientTLS := flagsClientTLS(c)
+	switch {
+	case c.IsSet(dbPathFlag):
+		return openNamespaceStore(c.String(dbPathFlag))
+	case c.IsSet(dataDirFlag) || c.IsSet(profileFlag):
+		dir, err := serverDataDir(c)
+		if err != nil {
+			return nil, err
+		}
+		// Go through the server while one uses the directory.
+		if state, err := dir.ReadState(); err == nil && process.Exists(state.PID) {
+			if clientTLS == nil {
+				clientTLS = state.TLS
+			}
+			return dialNamespaceManager(c.Context, state.FrontendAddress, clientTLS)
+		}
+		return openNamespaceStore(dir.DatabaseFile())
+	case c.IsSet(addressFlag):
+		return dialNamespaceManager(c.Context, c.String(addressFlag), clientTLS)
+	default:
+		return dialNamespaceManager(c.Context, defaultFrontendAddress, clientTLS)
+	}
+}
+
+// lockedNamespaceStore holds the lock of its database file so that no server starts using
+// it while namespaces are changed.
+type lockedNamespaceStore struct {
+	*namespaces.Store
+	lock *dblock.Lock
+}
+
+func (s *lockedNamespaceStore) Close() {
+	s.Store.Close()
+	_ = s.lock.Release()
+}
+
+func openNamespaceStore(path string) (namespaceManager, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: database file %q does not exist", path), 1)
+	}
+	lock, err := dblock.Acquire(path, false)
+	if err != nil {
+		var lockErr *dblock.HeldError
+		if errors.As(err, &lockErr) {
+			return nil, cli.Exit(fmt.Sprintf("ERROR: %v. Manage its namespaces through the running server with --%s.", err, addressFlag), 1)
+		}
+		return nil, cli.Exit(fmt.Sprintf("ERROR: unable to lock database file %q: %v", path, err), 1)
+	}
+	store, err := namespaces.Open(path)
+	if err != nil {
+		_ = lock.Release()
+		return nil, cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+	}
+	return &lockedNamespaceStore{Store: store, lock: lock}, nil
+}
+
+// frontendNamespaces manages the namespaces of a running server.
+type frontendNamespaces struct {
+	conn *grpc.ClientConn
+}
+
+func dialNamespaceManager(ctx context.Context, address string, clientTLS *datadir.ClientTLS) (namespaceManager, error) {
+	conn, err := dialFrontend(ctx, address, clientTLS)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: unable to connect to %s: %v", address, err), 1)
+	}
+	return &frontendNamespaces{conn: conn}, nil
+}
+
+func (f *frontendNamespaces) List(ctx context.Context) ([]namespaces.Namespace, error) {
+	client := workflowservice.NewWorkflowServiceClient(f.conn)
+	var (
+		result []namespaces.Namespace
+		token  []byte
+	)
+	for {
+		resp, err := client.ListNamespaces(ctx, &workflowservice.ListNamespacesRequest{NextPageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range resp.GetNamespaces() {
+			result = append(result, namespaces.FromDescribeResponse(ns))
+		}
+		if token = resp.GetNextPageToken(); len(token) == 0 {
+			break
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (f *frontendNamespaces) Describe(ctx context.Context, name string) (namespaces.Namespace, error) {
+	resp, err := workflowservice.NewWorkflowServiceClient(f.conn).DescribeNamespace(ctx, &workflowservice.DescribeNamespaceRequest{Namespace: name})
+	if err != nil {
+		return namespaces.Namespace{}, err
+	}
+	return namespaces.FromDescribeResponse(resp), nil
+}
+
+func (f *frontendNamespaces) Create(ctx context.Context, name string, opts namespaces.Options) (namespaces.Namespace, error) {
+	if _, err := workflowservice.NewWorkflowServiceClient(f.conn).RegisterNamespace(ctx, opts.RegisterRequest(name)); err != nil {
+		return namespaces.Namespace{}, err
+	}
+	return f.Describe(ctx, name)
+}
+
+func (f *frontendNamespaces) Update(ctx context.Context, name string, opts namespaces.Options) (namespaces.Namespace, error) {
+	resp, err := workflowservice.NewWorkflowServiceClient(f.conn).UpdateNamespace(ctx, opts.UpdateRequest(name))
+	if err != nil {
+		return namespaces.Namespace{}, err
+	}
+	return namespaces.FromDescribeResponse(&workflowservice.DescribeNamespaceResponse{
+		NamespaceInfo:     resp.GetNamespaceInfo(),
+		Config:            resp.GetConfig(),
+		ReplicationConfig: resp.GetReplicationConfig(),
+		IsGlobalNamespace: resp.GetIsGlobalNamespace(),
+	}), nil
+}
+
+// Delete marks the namespace as deleted, the server then deletes its workflows in the background.
+func (f *frontendNamespaces) Delete(ctx context.Context, name string) error {
+	_, err := operatorservice.NewOperatorServiceClient(f.conn).DeleteNamespace(ctx, &operatorservice.DeleteNamespaceRequest{Namespace: name})
+	return err
+}
+
+func (f *frontendNamespaces) Close() {
+	_ = f.conn.Close()
+}
+
+func writeNamespaces(w io.Writer, list []namespaces.Namespace) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID\tSTATE\tRETENTION")
+	for _, ns := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ns.Name, ns.ID, ns.State, ns.Retention)
+	}
+	return tw.Flush()
+}
+
+func writeNamespace(w io.Writer, ns namespaces.Namespace) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", ns.Name)
+	fmt.Fprintf(tw, "ID:\t%s\n", ns.ID)
+	fmt.Fprintf(tw, "State:\t%s\n", ns.State)
+	fmt.Fprintf(tw, "Description:\t%s\n", ns.Description)
+	fmt.Fprintf(tw, "Owner email:\t%s\n", ns.OwnerEmail)
+	fmt.Fprintf(tw, "Retention:\t%s\n", ns.Retention)
+	fmt.Fprintf(tw, "Active cluster:\t%s\n", ns.ActiveCluster)
+	keys := make([]string, 0, len(ns.Data))
+	for k := range ns.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "Data %s:\t%s\n", k, ns.Data[k])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,179 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/namespaces"
+)
+
+func TestNamespaceCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dbPath := newTestDatabase(ctx, t, "namespace-test")
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite", "namespace"}, args...))
+		return out.String(), err
+	}
+	describe := func(target ...string) namespaces.Namespace {
+		out, err := run(append(append([]string{"describe"}, target...), "--output", "json", "payments")...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ns namespaces.Namespace
+		if err := json.Unmarshal([]byte(out), &ns); err != nil {
+			t.Fatal(err)
+		}
+		return ns
+	}
+
+	t.Run("database file", func(t *testing.T) {
+		if _, err := run("create", "-f", dbPath, "--description", "payments team", "--data", "team=payments", "payments"); err != nil {
+			t.Fatal(err)
+		}
+		out, err := run("list", "-f", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "default") || !strings.Contains(out, "payments") {
+			t.Errorf("expected both namespaces to be listed, got:\n%s", out)
+		}
+
+		if _, err := run("update", "-f", dbPath, "--retention", "72h", "--data", "tier=1", "payments"); err != nil {
+			t.Fatal(err)
+		}
+		ns := describe("-f", dbPath)
+		if ns.Retention != "72h0m0s" || ns.Description != "payments team" || ns.Data["team"] != "payments" || ns.Data["tier"] != "1" {
+			t.Errorf("unexpected namespace after update: %+v", ns)
+		}
+
+		if _, err := run("update", "-f", dbPath, "--data", "tier", "payments"); err == nil {
+			t.Error("expected error for malformed data entry")
+		}
+		if _, err := run("delete", "-f", dbPath, "default"); err == nil || !strings.Contains(err.Error(), namespaces.ErrHasExecutions.Error()) {
+			t.Errorf("expected error deleting namespace with executions, got %v", err)
+		}
+		if _, err := run("delete", "-f", dbPath, "payments"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run("describe", "-f", dbPath, "payments"); err == nil {
+			t.Error("expected error describing deleted namespace")
+		}
+
+		lock, err := dblock.Acquire(dbPath, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run("list", "-f", dbPath); err == nil || !strings.Contains(err.Error(), "--"+addressFlag) {
+			t.Errorf("expected error suggesting the running server, got %v", err)
+		}
+		if err := lock.Release(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("running server", func(t *testing.T) {
+		portProvider := liteconfig.NewPortProvider()
+		port := portProvider.MustGetFreePort()
+		portProvider.Close()
+
+		serverCtx, stopServer := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			temporaliteCLI := buildCLI()
+			temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+			args, _ := newServerAndClientOpts(port, "-f", dbPath)
+			if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+				fmt.Println("Server closed with error:", err)
+			}
+		}()
+		defer func() {
+			stopServer()
+			<-done
+		}()
+		_, clientOpts := newServerAndClientOpts(port)
+		assertServerHealth(t, ctx, clientOpts)
+
+		address := "127.0.0.1:" + strconv.Itoa(port)
+		if _, err := run("create", "--address", address, "--owner-email", "payments@example.com", "payments"); err != nil {
+			t.Fatal(err)
+		}
+		// The frontend only knows about new namespaces once it refreshes its namespace cache.
+		for {
+			_, err := run("update", "--address", address, "--retention", "48h", "payments")
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		ns := describe("--address", address)
+		if ns.Retention != "48h0m0s" || ns.OwnerEmail != "payments@example.com" || ns.State != "Registered" {
+			t.Errorf("unexpected namespace after update: %+v", ns)
+		}
+		out, err := run("list", "--address", address, "--output", "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list []namespaces.Namespace
+		if err := json.Unmarshal([]byte(out), &list); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ns := range list {
+			names = append(names, ns.Name)
+		}
+		if !strings.Contains(strings.Join(names, ","), "default,payments") {
+			t.Errorf("unexpected namespaces %v", names)
+		}
+		if _, err := run("delete", "--address", address, "payments"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run("list", "-f", dbPath, "--address", address); err == nil {
+			t.Error("expected error passing both a database file and an address")
+		}
+	})
+}
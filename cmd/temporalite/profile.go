@@ -0,0 +1,192 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/profile"
+)
+
+const keepDataFlag = "keep-data"
+
+func newProfileCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "profile",
+		Usage: "Manage named Temporalite instances, each with its own state and ports",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List profiles",
+				ArgsUsage: " ",
+				Flags:     []cli.Flag{newOutputFlag()},
+				Before:    checkOutputFlag,
+				Action: func(c *cli.Context) error {
+					r, err := profile.Load()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						profiles := r.Profiles
+						if profiles == nil {
+							profiles = []profile.Profile{}
+						}
+						return writeJSON(c.App.Writer, profiles)
+					}
+					return writeProfiles(c.App.Writer, r.Profiles)
+				},
+			},
+			{
+				Name:      "create",
+				Usage:     "Create a profile, assigning ports that don't collide with other profiles unless specified",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    portFlag,
+						Aliases: []string{"p"},
+						Usage:   "port for the temporal-frontend GRPC service",
+					},
+					&cli.IntFlag{
+						Name:        uiPortFlag,
+						Usage:       "port for the temporal web UI",
+						DefaultText: "--port + 1000",
+					},
+					&cli.IntFlag{
+						Name:        metricsPortFlag,
+						Usage:       "port for the metrics listener",
+						DefaultText: "--port + 2000",
+					},
+				},
+				Before: requireProfileName,
+				Action: func(c *cli.Context) error {
+					r, err := profile.Load()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+					}
+					p, err := r.Create(c.Args().First(), c.Int(portFlag), c.Int(uiPortFlag), c.Int(metricsPortFlag), time.Now())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+					}
+					if err := r.Save(); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to save profile: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Created profile %q, start it with: temporalite start --profile %s\n", p.Name, p.Name)
+					return writeProfiles(c.App.Writer, []profile.Profile{p})
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a profile along with its data directory",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  keepDataFlag,
+						Usage: "keep the profile's data directory",
+					},
+				},
+				Before: requireProfileName,
+				Action: func(c *cli.Context) error {
+					r, err := profile.Load()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+					}
+					p, err := r.Delete(c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+					}
+
+					if !c.Bool(keepDataFlag) {
+						if err := removeDataDir(p.DataDir); err != nil {
+							return cli.Exit(fmt.Sprintf("ERROR: unable to delete profile %q: %v", p.Name, err), 1)
+						}
+					}
+					if err := r.Save(); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to save profile registry: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Deleted profile %q\n", p.Name)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func requireProfileName(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return cli.Exit(fmt.Sprintf("ERROR: %s command requires a profile name as its only argument.", c.Command.Name), 1)
+	}
+	return nil
+}
+
+// loadProfile returns the named profile, or an error ready to be returned from a command.
+func loadProfile(name string) (profile.Profile, error) {
+	r, err := profile.Load()
+	if err != nil {
+		return profile.Profile{}, cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+	}
+	p, err := r.Get(name)
+	var notFound *profile.NotFoundError
+	if errors.As(err, &notFound) {
+		return profile.Profile{}, cli.Exit(fmt.Sprintf("ERROR: %v, create it with: temporalite profile create %s", err, notFound.Name), 1)
+	} else if err != nil {
+		return profile.Profile{}, cli.Exit(fmt.Sprintf("ERROR: %v", err), 1)
+	}
+	return p, nil
+}
+
+// removeDataDir deletes a profile's data directory unless a server is using it.
+func removeDataDir(dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	lock, err := dblock.Acquire(datadir.Dir(dir).DatabaseFile(), false)
+	if err != nil {
+		return err
+	}
+	// The lock is held until the directory is gone so that no server starts using it in
+	// the meantime. Its file is removed along with the directory.
+	err = os.RemoveAll(dir)
+	_ = lock.Release()
+	return err
+}
+
+func writeProfiles(w io.Writer, profiles []profile.Profile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPORT\tUI PORT\tMETRICS PORT\tDATA DIR")
+	for _, p := range profiles {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", p.Name, p.Port, p.UIPort, p.MetricsPort, p.DataDir)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,157 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/profile"
+)
+
+func TestProfiles(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Keep the profile registry out of the real user config directory
+	testUserHome := t.TempDir()
+	t.Setenv("AppData", testUserHome)         // Windows
+	t.Setenv("HOME", testUserHome)            // macOS
+	t.Setenv("XDG_CONFIG_HOME", testUserHome) // linux
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite"}, args...))
+		return out.String(), err
+	}
+
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		port        = portProvider.MustGetFreePort()
+		uiPort      = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	if _, err := run("profile", "create", "--port", strconv.Itoa(port), "--ui-port", strconv.Itoa(uiPort), "--metrics-port", strconv.Itoa(metricsPort), "payments"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("profile", "create", "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("profile", "create", "orders"); err == nil {
+		t.Error("expected error creating duplicate profile")
+	}
+
+	out, err := run("profile", "list", "--output", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profiles []profile.Profile
+	if err := json.Unmarshal([]byte(out), &profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].Name != "orders" || profiles[1].Name != "payments" {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+	payments := profiles[1]
+	if payments.Port != port || payments.UIPort != uiPort || payments.MetricsPort != metricsPort {
+		t.Errorf("unexpected ports for %+v", payments)
+	}
+	used := make(map[int]bool)
+	for _, p := range profiles {
+		for _, port := range []int{p.Port, p.UIPort, p.MetricsPort} {
+			if port == 0 || used[port] {
+				t.Errorf("expected ports of %+v to be assigned without collisions", p)
+			}
+			used[port] = true
+		}
+	}
+
+	if _, err := run("start", "--profile", "missing"); err == nil || !strings.Contains(err.Error(), "profile create missing") {
+		t.Errorf("expected error suggesting to create the profile, got %v", err)
+	}
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args := []string{"temporalite", "start", "--profile", "payments", "--namespace", "default", "--log-format", "noop", "--headless"}
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+
+	_, clientOpts := newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/healthz", metricsPort))
+	if err != nil {
+		t.Errorf("expected the profile's metrics port to be served: %v", err)
+	} else {
+		_ = resp.Body.Close()
+	}
+	if _, err := os.Stat(datadir.Dir(payments.DataDir).DatabaseFile()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := run("profile", "delete", "payments"); err == nil || !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Errorf("expected error deleting running profile, got %v", err)
+	}
+
+	stopServer()
+	<-done
+
+	if _, err := run("profile", "delete", "payments"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(payments.DataDir); !os.IsNotExist(err) {
+		t.Errorf("expected data directory to be deleted, got %v", err)
+	}
+	out, err = run("profile", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "payments") || !strings.Contains(out, "orders") {
+		t.Errorf("unexpected profile list:\n%s", out)
+	}
+}
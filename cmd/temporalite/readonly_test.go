@@ -0,0 +1,236 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/server/common/log"
+
+	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dbPath := newTestDatabase(ctx, t, "read-only")
+	original, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "-f", dbPath, "--read-only")
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+
+	var c client.Client
+	for i := 0; i < 50; i++ {
+		if c, err = client.Dial(client.Options{HostPort: fmt.Sprintf("localhost:%d", port), Namespace: "default"}); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.DescribeWorkflowExecution(ctx, "read-only", ""); err != nil {
+		t.Errorf("unable to describe workflow: %s", err)
+	}
+	iter := c.GetWorkflowHistory(ctx, "read-only", "", false, 0)
+	var events int
+	for iter.HasNext() {
+		if _, err := iter.Next(); err != nil {
+			t.Fatalf("unable to read workflow history: %s", err)
+		}
+		events++
+	}
+	if events == 0 {
+		t.Error("expected workflow history to contain events")
+	}
+
+	_, err = c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: "hello_world"}, "Greet", "world")
+	var permissionDenied *serviceerror.PermissionDenied
+	if !errors.As(err, &permissionDenied) {
+		t.Errorf("expected permission denied error, got %v", err)
+	}
+	if err := c.TerminateWorkflow(ctx, "read-only", "", "test"); !errors.As(err, &permissionDenied) {
+		t.Errorf("expected permission denied error, got %v", err)
+	}
+
+	stopServer()
+	<-done
+	current, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(original, current) {
+		t.Error("database file was modified in read-only mode")
+	}
+	if _, err := os.Stat(dbPath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected no lock file in read-only mode, got %v", err)
+	}
+
+	args, _ := newServerAndClientOpts(port, "--ephemeral", "--read-only")
+	temporaliteCLI := buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	if err := temporaliteCLI.RunContext(ctx, args); err == nil {
+		t.Error("expected error combining --ephemeral and --read-only")
+	}
+
+	// A dynamic config file would override the read-only settings.
+	configDir := t.TempDir()
+	dynamicConfigFile := filepath.Join(configDir, "dynamicconfig.yaml")
+	if err := os.WriteFile(dynamicConfigFile, []byte("limit.blobSize.error:\n  - value: 1048576\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "temporalite.yaml"), []byte(fmt.Sprintf("dynamicConfigClient:\n  filepath: %s\n  pollInterval: 10m\n", dynamicConfigFile)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args, _ = newServerAndClientOpts(port, "-f", dbPath, "--read-only", "--config", configDir)
+	temporaliteCLI = buildCLI()
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	if err := temporaliteCLI.RunContext(ctx, args); err == nil || !strings.Contains(err.Error(), "dynamic config") {
+		t.Errorf("expected error combining --read-only with a dynamic config file, got %v", err)
+	}
+}
+
+func TestReadOnlyPendingTimer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Leave a workflow with a pending run timeout timer in the database: there is no
+	// worker for its task queue, so it only completes once the timer fires.
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	s, err := temporalite.NewServer(
+		temporalite.WithDatabaseFilePath(dbPath),
+		temporalite.WithNamespaces("default"),
+		temporalite.WithDynamicPorts(),
+		temporalite.WithLogger(log.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.NewClient(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const timeout = 3 * time.Second
+	deadline := time.Now().Add(timeout)
+	if _, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:                 "pending-timer",
+		TaskQueue:          "no-worker",
+		WorkflowRunTimeout: timeout,
+	}, "Greet", "world"); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	systemClient, err := s.NewClient(ctx, "temporal-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForScanners(ctx, systemClient); err != nil {
+		t.Fatal(err)
+	}
+	systemClient.Close()
+	s.Stop()
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		// Dynamic config values can't turn task processing back on.
+		args, _ := newServerAndClientOpts(port, "-f", dbPath, "--read-only",
+			"--dynamic-config-value", "history.timerProcessorSchedulerWorkerCount=4",
+			"--dynamic-config-value", "history.timerTaskWorkerCount=4")
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	for i := 0; i < 50; i++ {
+		if c, err = client.Dial(client.Options{HostPort: fmt.Sprintf("localhost:%d", port), Namespace: "default"}); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Give the timer ample time to fire if it was going to.
+	time.Sleep(time.Until(deadline.Add(3 * time.Second)))
+
+	resp, err := c.DescribeWorkflowExecution(ctx, "pending-timer", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := resp.GetWorkflowExecutionInfo().GetStatus(); status != enums.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		t.Errorf("expected workflow to still be running, got %s", status)
+	}
+}
@@ -9,6 +9,8 @@ package main
 // This file should be the only one to import ui-server packages.
 // This is to avoid embedding the UI's static assets in the binary when the `headless` build tag is enabled.
 import (
+	"fmt"
+	"net"
 	"strings"
 
 	provider "github.com/temporalio/ui-server/v2/plugins/fs_config_provider"
@@ -16,10 +18,13 @@ import (
 	uiconfig "github.com/temporalio/ui-server/v2/server/config"
 	uiserveroptions "github.com/temporalio/ui-server/v2/server/server_options"
 
-	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/liteconfig"
 )
 
-func newUIOption(c *uiConfig, configDir string) (temporalite.ServerOption, error) {
+// headlessBuild reports whether the program was built with the `headless` tag.
+const headlessBuild = false
+
+func newUIServer(c *uiConfig, configDir string) (liteconfig.UIServer, error) {
 	cfg, err := newUIConfig(
 		c,
 		configDir,
@@ -27,7 +32,23 @@ func newUIOption(c *uiConfig, configDir string) (temporalite.ServerOption, error
 	if err != nil {
 		return nil, err
 	}
-	return temporalite.WithUI(uiserver.NewServer(uiserveroptions.WithConfigProvider(cfg))), nil
+	return &uiServer{
+		Server:  uiserver.NewServer(uiserveroptions.WithConfigProvider(cfg)),
+		address: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+	}, nil
+}
+
+// uiServer exposes the UI's listen address so the server can check its port is free
+// before starting.
+type uiServer struct {
+	*uiserver.Server
+	// Formatted like ui-server's listen address, with the host already bracketed when needed.
+	address string
+}
+
+// Address returns the address the UI listens on.
+func (s *uiServer) Address() string {
+	return s.address
 }
 
 func newUIConfig(c *uiConfig, configDir string) (*uiconfig.Config, error) {
@@ -53,6 +74,19 @@ func newUIConfig(c *uiConfig, configDir string) (*uiconfig.Config, error) {
 	// for context about those overrides.
 	cfg.TemporalGRPCAddress = c.TemporalGRPCAddress
 	cfg.EnableUI = c.EnableUI
+	if c.TLS != nil {
+		cfg.TLS = uiconfig.TLS{
+			CaFile:                 c.TLS.CAFile,
+			CertFile:               c.TLS.CertFile,
+			KeyFile:                c.TLS.KeyFile,
+			ServerName:             c.TLS.ServerName,
+			EnableHostVerification: true,
+		}
+	}
+	// ui-server formats its listen address as host:port, which requires brackets for IPv6.
+	if ip := net.ParseIP(cfg.Host); ip != nil && ip.To4() == nil {
+		cfg.Host = "[" + cfg.Host + "]"
+	}
 
 	return cfg, nil
 }
@@ -6,8 +6,11 @@
 
 package main
 
-import "github.com/temporalio/temporalite"
+import "github.com/temporalio/temporalite/internal/liteconfig"
 
-func newUIOption(c *uiConfig, configDir string) (temporalite.ServerOption, error) {
+// headlessBuild reports whether the program was built with the `headless` tag.
+const headlessBuild = true
+
+func newUIServer(c *uiConfig, configDir string) (liteconfig.UIServer, error) {
 	return nil, nil
 }
@@ -79,3 +79,19 @@ func TestNewUIConfigWithPresentConfigFile(t *testing.T) {
 		t.Errorf("did not load expected config file")
 	}
 }
+
+func TestNewUIConfigWithIPv6Host(t *testing.T) {
+	c := &uiConfig{
+		Host:                "::1",
+		Port:                8233,
+		TemporalGRPCAddress: "[::1]:7233",
+		EnableUI:            true,
+	}
+	cfg, err := newUIConfig(c, "")
+	if err != nil {
+		t.Fatalf("cannot create config: %s", err)
+	}
+	if cfg.Host != "[::1]" {
+		t.Errorf("expected IPv6 host to be bracketed, got %q", cfg.Host)
+	}
+}
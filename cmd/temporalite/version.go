@@ -0,0 +1,142 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/server/common/headers"
+	"go.temporal.io/server/schema/sqlite"
+)
+
+const (
+	sdkModule = "go.temporal.io/sdk"
+	apiModule = "go.temporal.io/api"
+)
+
+// buildInfo describes the build of the program, as reported by the version command.
+type buildInfo struct {
+	Temporalite             string `json:"temporalite"`
+	Server                  string `json:"server"`
+	UIServer                string `json:"ui_server,omitempty"`
+	SDK                     string `json:"sdk"`
+	API                     string `json:"api"`
+	Go                      string `json:"go"`
+	Headless                bool   `json:"headless"`
+	BuildTags               string `json:"build_tags,omitempty"`
+	Revision                string `json:"revision,omitempty"`
+	SchemaVersion           string `json:"schema_version"`
+	VisibilitySchemaVersion string `json:"visibility_schema_version"`
+	// Dependencies maps the path of each module built into the program to its version.
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+func newVersionCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "version",
+		Usage:     "Print the versions of Temporalite and of the components and dependencies it was built with",
+		ArgsUsage: " ",
+		Flags:     []cli.Flag{newOutputFlag()},
+		Before:    checkOutputFlag,
+		Action: func(c *cli.Context) error {
+			info := readBuildInfo()
+			if c.String(outputFlag) == "json" {
+				return writeJSON(c.App.Writer, info)
+			}
+			return writeBuildInfo(c.App.Writer, info)
+		},
+	}
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Temporalite:             version,
+		Server:                  headers.ServerVersion,
+		Go:                      runtime.Version(),
+		Headless:                headlessBuild,
+		SchemaVersion:           sqlite.Version,
+		VisibilitySchemaVersion: sqlite.VisibilityVersion,
+		Dependencies:            make(map[string]string),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	// Builds installed with go install report their module version instead of ldflags.
+	if info.Temporalite == "(devel)" && bi.Main.Version != "" {
+		info.Temporalite = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		v := dep.Version
+		if dep.Replace != nil {
+			v = dep.Replace.Version
+		}
+		info.Dependencies[dep.Path] = v
+		switch dep.Path {
+		case uiServerModule:
+			info.UIServer = v
+		case sdkModule:
+			info.SDK = v
+		case apiModule:
+			info.API = v
+		}
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "-tags":
+			info.BuildTags = s.Value
+		case "vcs.revision":
+			info.Revision = s.Value
+		}
+	}
+	return info
+}
+
+func writeBuildInfo(w io.Writer, info buildInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Temporalite:\t%s\n", info.Temporalite)
+	if info.Revision != "" {
+		fmt.Fprintf(tw, "Revision:\t%s\n", info.Revision)
+	}
+	fmt.Fprintf(tw, "Server:\t%s\n", info.Server)
+	if info.Headless {
+		fmt.Fprintf(tw, "UI server:\tnone (headless build)\n")
+	} else {
+		fmt.Fprintf(tw, "UI server:\t%s\n", info.UIServer)
+	}
+	fmt.Fprintf(tw, "SDK:\t%s\n", info.SDK)
+	fmt.Fprintf(tw, "API:\t%s\n", info.API)
+	fmt.Fprintf(tw, "Go:\t%s\n", info.Go)
+	if info.BuildTags != "" {
+		fmt.Fprintf(tw, "Build tags:\t%s\n", info.BuildTags)
+	}
+	fmt.Fprintf(tw, "Schema version:\t%s (visibility %s)\n", info.SchemaVersion, info.VisibilitySchemaVersion)
+	return tw.Flush()
+}
@@ -0,0 +1,77 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/server/common/headers"
+)
+
+func TestVersionCommand(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.Run(append([]string{"temporalite", "version"}, args...))
+		return out.String(), err
+	}
+
+	out, err := run("--output", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info buildInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Server != headers.ServerVersion || info.Go != runtime.Version() || info.Headless != headlessBuild {
+		t.Errorf("unexpected build info %+v", info)
+	}
+	if info.SDK == "" || info.API == "" || info.SchemaVersion == "" || info.Dependencies[sdkModule] != info.SDK {
+		t.Errorf("expected SDK, API and schema versions, got %+v", info)
+	}
+	if (info.UIServer == "") != headlessBuild {
+		t.Errorf("expected UI server version unless headless, got %q", info.UIServer)
+	}
+
+	out, err = run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Server:") || !strings.Contains(out, headers.ServerVersion) {
+		t.Errorf("unexpected version output:\n%s", out)
+	}
+	if _, err := run("--output", "yaml"); err == nil {
+		t.Error("expected error for unknown output format")
+	}
+}
@@ -0,0 +1,225 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/dynamicconfig"
+	"go.temporal.io/server/common/log"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+// watchInterval is how often the files watched by start --watch are checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// loadBaseConfig loads the Temporal server config of the config directory.
+func loadBaseConfig(configDir string) (*config.Config, error) {
+	baseConfig := &config.Config{}
+	if configDir == "" {
+		return baseConfig, nil
+	}
+	// Temporal server requires a couple of persistence config values to
+	// be explicitly set or the config loading fails. While these are the
+	// same values used internally, they are overridden later anyways,
+	// they are just here to pass validation.
+	baseConfig.Persistence.DefaultStore = liteconfig.PersistenceStoreName
+	baseConfig.Persistence.NumHistoryShards = 1
+	if err := config.Load("temporalite", configDir, "", &baseConfig); err != nil {
+		return nil, err
+	}
+	return baseConfig, nil
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchFiles polls the files of dirs along with the given files every watchInterval, sending
+// the paths of the files that were created, changed or removed since the previous poll.
+func watchFiles(ctx context.Context, dirs []string, files ...string) <-chan []string {
+	snapshot := func() map[string]fileVersion {
+		paths := append([]string(nil), files...)
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					paths = append(paths, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+		versions := make(map[string]fileVersion, len(paths))
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				versions[path] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+			}
+		}
+		return versions
+	}
+
+	changes := make(chan []string)
+	previous := snapshot()
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := snapshot()
+			var changed []string
+			for path, v := range current {
+				if previous[path] != v {
+					changed = append(changed, path)
+				}
+			}
+			for path := range previous {
+				if _, ok := current[path]; !ok {
+					changed = append(changed, path)
+				}
+			}
+			previous = current
+			if len(changed) == 0 {
+				continue
+			}
+			sort.Strings(changed)
+			select {
+			case changes <- changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// reloadableDynamicConfig serves the values of a dynamic config file like the server's file
+// based client does, but can be reloaded as soon as the file changes instead of on the next
+// poll of the file, which happens at least 5 seconds apart.
+type reloadableDynamicConfig struct {
+	config *dynamicconfig.FileBasedClientConfig
+	logger log.Logger
+
+	mu     sync.Mutex
+	client atomic.Value // dynamicconfig.Client
+	done   chan interface{}
+}
+
+func newReloadableDynamicConfig(cfg *dynamicconfig.FileBasedClientConfig, logger log.Logger) (*reloadableDynamicConfig, error) {
+	d := &reloadableDynamicConfig{config: cfg, logger: logger}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *reloadableDynamicConfig) GetValue(key dynamicconfig.Key) []dynamicconfig.ConstrainedValue {
+	return d.client.Load().(dynamicconfig.Client).GetValue(key)
+}
+
+// Reload reads the dynamic config file again, keeping the current values if it is invalid.
+func (d *reloadableDynamicConfig) Reload() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	done := make(chan interface{})
+	client, err := dynamicconfig.NewFileBasedClient(d.config, d.logger, done)
+	if err != nil {
+		return err
+	}
+	d.client.Store(client)
+	d.close()
+	d.done = done
+	return nil
+}
+
+// Close stops polling the dynamic config file.
+func (d *reloadableDynamicConfig) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.close()
+}
+
+func (d *reloadableDynamicConfig) close() {
+	if d.done != nil {
+		close(d.done)
+		d.done = nil
+	}
+}
+
+// persistentUI keeps the web UI running until the process exits. ui-server can only be
+// started once, and exits the process once stopped, which would skip the rest of the
+// shutdown, eg. removing the server state file. The UI keeps running while the server
+// restarts.
+type persistentUI struct {
+	liteconfig.UIServer
+
+	started atomic.Bool
+	// done is closed with err set once ui-server stops serving.
+	done chan struct{}
+	err  error
+}
+
+func newPersistentUI(ui liteconfig.UIServer) *persistentUI {
+	return &persistentUI{UIServer: ui, done: make(chan struct{})}
+}
+
+// Start starts the UI the first time it is called. Like ui-server's Start, every call
+// returns once the UI stops serving.
+func (u *persistentUI) Start() error {
+	if u.started.CompareAndSwap(false, true) {
+		go func() {
+			u.err = u.UIServer.Start()
+			close(u.done)
+		}()
+	}
+	<-u.done
+	return u.err
+}
+
+// Stop leaves the UI running, it stops serving when the process exits.
+func (u *persistentUI) Stop() {}
+
+// Address returns the address the UI listens on, until it is started: its port is then
+// taken by the UI itself rather than free.
+func (u *persistentUI) Address() string {
+	if a, ok := u.UIServer.(interface{ Address() string }); ok && !u.started.Load() {
+		return a.Address()
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/server/common/log"
+
+	"github.com/temporalio/temporalite"
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	configDir := t.TempDir()
+	dir := datadir.Dir(t.TempDir())
+	dynamicConfigFile := filepath.Join(configDir, "dynamic.yaml")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(dynamicConfigFile, "limit.blobSize.error:\n  - value: 1048576\n")
+	writeFile(filepath.Join(configDir, "temporalite.yaml"), fmt.Sprintf("dynamicConfigClient:\n  filepath: %s\n  pollInterval: 10m\n", dynamicConfigFile))
+
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	temporaliteCLI := buildCLI()
+	// Don't call os.Exit
+	temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+	args, clientOpts := newServerAndClientOpts(port, "--watch")
+	if err := temporaliteCLI.RunContext(ctx, args); err == nil || !strings.Contains(err.Error(), configFlag) {
+		t.Errorf("expected error watching without a config directory, got %v", err)
+	}
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		temporaliteCLI := buildCLI()
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		args, _ := newServerAndClientOpts(port, "--watch", "--config", configDir, "--data-dir", string(dir))
+		if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+			fmt.Println("Server closed with error:", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+	assertServerHealth(t, ctx, clientOpts)
+
+	clientOpts.Namespace = "default"
+	c, err := client.Dial(clientOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	run, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: "watch-test"}, "noop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// signalWorkflow signals the workflow with an input of 2KB.
+	signalWorkflow := func() error {
+		return c.SignalWorkflow(ctx, run.GetID(), run.GetRunID(), "poke", strings.Repeat("x", 2048))
+	}
+	if err := signalWorkflow(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dynamic config changes apply without restarting the server
+	state, err := dir.ReadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(dynamicConfigFile, "limit.blobSize.warn:\n  - value: 512\n    constraints:\n      namespace: default\nlimit.blobSize.error:\n  - value: 1024\n    constraints:\n      namespace: default\n")
+	for err := signalWorkflow(); !errors.As(err, new(*serviceerror.InvalidArgument)); err = signalWorkflow() {
+		if ctx.Err() != nil {
+			t.Fatalf("expected dynamic config change to limit the input size, got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if restarted, err := dir.ReadState(); err != nil || !restarted.StartedAt.Equal(state.StartedAt) {
+		t.Errorf("expected server not to restart on dynamic config changes, got %+v, %v", restarted, err)
+	}
+
+	// Other changes restart the server with the same database
+	writeFile(filepath.Join(configDir, "temporalite.yaml"), fmt.Sprintf("dynamicConfigClient:\n  filepath: %s\n  pollInterval: 1m\n", dynamicConfigFile))
+	for {
+		if restarted, err := dir.ReadState(); err == nil && restarted.StartedAt.After(state.StartedAt) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("expected server to restart on config changes")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	clientOpts.Namespace = "temporal-system"
+	assertServerHealth(t, ctx, clientOpts)
+	// The workflow started before restarting is still there
+	if err := signalWorkflow(); !errors.As(err, new(*serviceerror.InvalidArgument)) {
+		t.Errorf("expected dynamic config to apply after restarting, got %v", err)
+	}
+}
+
+// fakeUI listens on its address until stopped, like ui-server which then exits the process.
+type fakeUI struct {
+	address string
+	stopped chan struct{}
+	stops   int
+}
+
+func (u *fakeUI) Start() error {
+	l, err := net.Listen("tcp", u.address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	<-u.stopped
+	return nil
+}
+
+func (u *fakeUI) Stop() {
+	u.stops++
+	close(u.stopped)
+}
+
+func (u *fakeUI) Address() string {
+	return u.address
+}
+
+func TestPersistentUI(t *testing.T) {
+	portProvider := liteconfig.NewPortProvider()
+	var (
+		uiPort      = portProvider.MustGetFreePort()
+		metricsPort = portProvider.MustGetFreePort()
+	)
+	portProvider.Close()
+
+	fake := &fakeUI{address: fmt.Sprintf("127.0.0.1:%d", uiPort), stopped: make(chan struct{})}
+	ui := newPersistentUI(fake)
+	opts := []temporalite.ServerOption{
+		temporalite.WithPersistenceDisabled(),
+		temporalite.WithDynamicPorts(),
+		temporalite.WithMetricsPort(metricsPort),
+		temporalite.WithLogger(log.NewNoopLogger()),
+		temporalite.WithUI(ui),
+	}
+	uiStatus := func() string {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/healthz", metricsPort))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report struct {
+			Checks map[string]struct{ Status string }
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report.Checks["ui"].Status
+	}
+
+	for i := 0; i < 2; i++ {
+		s, err := temporalite.NewServer(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if status := uiStatus(); status != "ok" {
+			t.Errorf("expected UI to be reported running, got %q", status)
+		}
+		// Restart like start --watch does
+		s.Stop()
+	}
+	if fake.stops != 0 {
+		t.Error("expected UI to keep running across restarts and after stopping the server")
+	}
+	if conn, err := net.Dial("tcp", fake.address); err != nil {
+		t.Errorf("expected UI to keep listening: %v", err)
+	} else {
+		_ = conn.Close()
+	}
+	close(fake.stopped)
+}
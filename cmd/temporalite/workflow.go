@@ -0,0 +1,864 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	querypb "go.temporal.io/api/query/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/grpc"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+const (
+	queryFlag      = "query"
+	limitFlag      = "limit"
+	runIDFlag      = "run-id"
+	workflowIDFlag = "workflow-id"
+	typeFlag       = "type"
+	taskQueueFlag  = "task-queue"
+	inputFlag      = "input"
+	nameFlag       = "name"
+	reasonFlag     = "reason"
+	eventIDFlag    = "event-id"
+	resetTypeFlag  = "reset-type"
+	formatFlag     = "format"
+	dirFlag        = "dir"
+
+	defaultNamespace = "default"
+)
+
+const (
+	resetFirstWorkflowTask = "first-workflow-task"
+	resetLastWorkflowTask  = "last-workflow-task"
+)
+
+func newWorkflowCommand(defaultCfg *liteconfig.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "workflow",
+		Usage: "Start, inspect and manage workflows of a running server",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List workflows, most recently started first",
+				ArgsUsage: " ",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.StringFlag{
+						Name:    queryFlag,
+						Aliases: []string{"q"},
+						Usage:   "visibility query filtering the workflows, eg. \"ExecutionStatus='Running'\"",
+					},
+					&cli.IntFlag{
+						Name:        limitFlag,
+						Usage:       "maximum number of workflows to list",
+						DefaultText: "no limit",
+					},
+					newOutputFlag(),
+				),
+				Before:       checkOutputFlag,
+				BashComplete: completeWorkflowFlags,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					list, err := ws.list(c.Context, c.String(queryFlag), c.Int(limitFlag))
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to list workflows: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						if list == nil {
+							list = []workflowExecution{}
+						}
+						return writeJSON(c.App.Writer, list)
+					}
+					return writeWorkflowExecutions(c.App.Writer, list)
+				}),
+			},
+			{
+				Name:         "show",
+				Usage:        "Print a workflow along with its history",
+				ArgsUsage:    "WORKFLOW_ID",
+				Flags:        append(newWorkflowTargetFlags(), newRunIDFlag(), newOutputFlag()),
+				Before:       requireWorkflowID(checkOutputFlag),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					details, err := ws.show(c.Context, ws.execution(c))
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to show workflow: %v", err), 1)
+					}
+					if c.String(outputFlag) == "json" {
+						return writeJSON(c.App.Writer, details)
+					}
+					return writeWorkflowDetails(c.App.Writer, details)
+				}),
+			},
+			{
+				Name:      "start",
+				Usage:     "Start a workflow",
+				ArgsUsage: " ",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.StringFlag{
+						Name:     typeFlag,
+						Usage:    "workflow type name",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     taskQueueFlag,
+						Aliases:  []string{"t"},
+						Usage:    "task queue polled by the workers of the workflow",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:        workflowIDFlag,
+						Usage:       "workflow ID",
+						DefaultText: "random UUID",
+					},
+					newInputFlag("workflow argument"),
+					newOutputFlag(),
+				),
+				Before:       checkOutputFlag,
+				BashComplete: completeWorkflowFlags,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					workflowID := c.String(workflowIDFlag)
+					if workflowID == "" {
+						workflowID = uuid.NewString()
+					}
+					input, err := inputPayloads(c)
+					if err != nil {
+						return err
+					}
+					resp, err := ws.client.StartWorkflowExecution(c.Context, &workflowservice.StartWorkflowExecutionRequest{
+						Namespace:    ws.namespace,
+						WorkflowId:   workflowID,
+						WorkflowType: &commonpb.WorkflowType{Name: c.String(typeFlag)},
+						TaskQueue:    &taskqueuepb.TaskQueue{Name: c.String(taskQueueFlag)},
+						Input:        input,
+						Identity:     cliIdentity(),
+						RequestId:    uuid.NewString(),
+					})
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to start workflow: %v", err), 1)
+					}
+					started := workflowRun{WorkflowID: workflowID, RunID: resp.GetRunId()}
+					if c.String(outputFlag) == "json" {
+						return writeJSON(c.App.Writer, started)
+					}
+					fmt.Fprintf(c.App.Writer, "Started workflow %q in namespace %q\n", workflowID, ws.namespace)
+					return writeWorkflowRun(c.App.Writer, started)
+				}),
+			},
+			{
+				Name:      "signal",
+				Usage:     "Send a signal to a workflow",
+				ArgsUsage: "WORKFLOW_ID",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.StringFlag{
+						Name:     nameFlag,
+						Usage:    "signal name",
+						Required: true,
+					},
+					newInputFlag("signal argument"),
+					newRunIDFlag(),
+				),
+				Before:       requireWorkflowID(nil),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					input, err := inputPayloads(c)
+					if err != nil {
+						return err
+					}
+					if _, err := ws.client.SignalWorkflowExecution(c.Context, &workflowservice.SignalWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: ws.execution(c),
+						SignalName:        c.String(nameFlag),
+						Input:             input,
+						Identity:          cliIdentity(),
+						RequestId:         uuid.NewString(),
+					}); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to signal workflow: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Sent signal %q to workflow %q\n", c.String(nameFlag), c.Args().First())
+					return nil
+				}),
+			},
+			{
+				Name:      "query",
+				Usage:     "Query a workflow and print the result as JSON",
+				ArgsUsage: "WORKFLOW_ID",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.StringFlag{
+						Name:     typeFlag,
+						Usage:    "query type, eg. __stack_trace",
+						Required: true,
+					},
+					newInputFlag("query argument"),
+					newRunIDFlag(),
+				),
+				Before:       requireWorkflowID(nil),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					input, err := inputPayloads(c)
+					if err != nil {
+						return err
+					}
+					resp, err := ws.client.QueryWorkflow(c.Context, &workflowservice.QueryWorkflowRequest{
+						Namespace: ws.namespace,
+						Execution: ws.execution(c),
+						Query: &querypb.WorkflowQuery{
+							QueryType: c.String(typeFlag),
+							QueryArgs: input,
+						},
+					})
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to query workflow: %v", err), 1)
+					}
+					if rejected := resp.GetQueryRejected(); rejected != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: query rejected, workflow is %s", rejected.GetStatus()), 1)
+					}
+					for _, result := range payloadsToJSON(resp.GetQueryResult()) {
+						fmt.Fprintln(c.App.Writer, string(result))
+					}
+					return nil
+				}),
+			},
+			{
+				Name:         "cancel",
+				Usage:        "Request a workflow to cancel, letting it clean up",
+				ArgsUsage:    "WORKFLOW_ID",
+				Flags:        append(newWorkflowTargetFlags(), newRunIDFlag()),
+				Before:       requireWorkflowID(nil),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					if _, err := ws.client.RequestCancelWorkflowExecution(c.Context, &workflowservice.RequestCancelWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: ws.execution(c),
+						Identity:          cliIdentity(),
+						RequestId:         uuid.NewString(),
+					}); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to cancel workflow: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Requested cancellation of workflow %q\n", c.Args().First())
+					return nil
+				}),
+			},
+			{
+				Name:         "terminate",
+				Usage:        "Terminate a workflow immediately",
+				ArgsUsage:    "WORKFLOW_ID",
+				Flags:        append(newWorkflowTargetFlags(), newReasonFlag(), newRunIDFlag()),
+				Before:       requireWorkflowID(nil),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					if _, err := ws.client.TerminateWorkflowExecution(c.Context, &workflowservice.TerminateWorkflowExecutionRequest{
+						Namespace:         ws.namespace,
+						WorkflowExecution: ws.execution(c),
+						Reason:            c.String(reasonFlag),
+						Identity:          cliIdentity(),
+					}); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to terminate workflow: %v", err), 1)
+					}
+					fmt.Fprintf(c.App.Writer, "Terminated workflow %q\n", c.Args().First())
+					return nil
+				}),
+			},
+			{
+				Name:      "reset",
+				Usage:     "Start a new run of a workflow replaying its history up to a workflow task, terminating the current run",
+				ArgsUsage: "WORKFLOW_ID",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.Int64Flag{
+						Name:  eventIDFlag,
+						Usage: "ID of the workflow task completed, failed or timed out event to reset to",
+					},
+					&cli.StringFlag{
+						Name:  resetTypeFlag,
+						Usage: fmt.Sprintf("workflow task to reset to, instead of --%s (%s | %s)", eventIDFlag, resetFirstWorkflowTask, resetLastWorkflowTask),
+					},
+					newReasonFlag(),
+					newRunIDFlag(),
+					newOutputFlag(),
+				),
+				Before: requireWorkflowID(func(c *cli.Context) error {
+					switch {
+					case c.IsSet(eventIDFlag) == c.IsSet(resetTypeFlag):
+						return cli.Exit(fmt.Sprintf("ERROR: exactly one of %q or %q flags must be passed", eventIDFlag, resetTypeFlag), 1)
+					case c.IsSet(resetTypeFlag) && c.String(resetTypeFlag) != resetFirstWorkflowTask && c.String(resetTypeFlag) != resetLastWorkflowTask:
+						return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(resetTypeFlag), resetTypeFlag), 1)
+					}
+					return checkOutputFlag(c)
+				}),
+				BashComplete: completeWorkflowArgs,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					execution := ws.execution(c)
+					eventID := c.Int64(eventIDFlag)
+					if c.IsSet(resetTypeFlag) {
+						var err error
+						if eventID, err = ws.findWorkflowTask(c.Context, execution, c.String(resetTypeFlag)); err != nil {
+							return cli.Exit(fmt.Sprintf("ERROR: unable to reset workflow: %v", err), 1)
+						}
+					}
+					resp, err := ws.client.ResetWorkflowExecution(c.Context, &workflowservice.ResetWorkflowExecutionRequest{
+						Namespace:                 ws.namespace,
+						WorkflowExecution:         execution,
+						Reason:                    c.String(reasonFlag),
+						WorkflowTaskFinishEventId: eventID,
+						RequestId:                 uuid.NewString(),
+					})
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to reset workflow: %v", err), 1)
+					}
+					reset := workflowRun{WorkflowID: execution.GetWorkflowId(), RunID: resp.GetRunId()}
+					if c.String(outputFlag) == "json" {
+						return writeJSON(c.App.Writer, reset)
+					}
+					fmt.Fprintf(c.App.Writer, "Reset workflow %q to event %d\n", reset.WorkflowID, eventID)
+					return writeWorkflowRun(c.App.Writer, reset)
+				}),
+			},
+			{
+				Name:      "export",
+				Usage:     "Write the history of a workflow to stdout, or the histories of workflows matching a query to a directory, eg. to replay them or attach them to a bug report",
+				ArgsUsage: " ",
+				Flags: append(newWorkflowTargetFlags(),
+					&cli.StringFlag{
+						Name:    workflowIDFlag,
+						Aliases: []string{"id", "w"},
+						Usage:   "workflow ID",
+					},
+					&cli.StringFlag{
+						Name:    queryFlag,
+						Aliases: []string{"q"},
+						Usage:   "visibility query selecting the workflows to export to --dir, eg. \"WorkflowType='Greet'\"",
+					},
+					&cli.StringFlag{
+						Name:  dirFlag,
+						Usage: "directory to write the histories of the workflows matching --query to, one file per run",
+					},
+					&cli.StringFlag{
+						Name:  formatFlag,
+						Usage: "history format: json (as read by the SDKs' workflow replayers) | proto",
+						Value: "json",
+					},
+					newRunIDFlag(),
+				),
+				Before: func(c *cli.Context) error {
+					switch c.String(formatFlag) {
+					case "json", "proto":
+					default:
+						return cli.Exit(fmt.Sprintf("bad value %q passed for flag %q", c.String(formatFlag), formatFlag), 1)
+					}
+					if c.IsSet(workflowIDFlag) == c.IsSet(queryFlag) {
+						return cli.Exit(fmt.Sprintf("ERROR: exactly one of --%s and --%s is required", workflowIDFlag, queryFlag), 1)
+					}
+					if c.IsSet(queryFlag) != c.IsSet(dirFlag) {
+						return cli.Exit(fmt.Sprintf("ERROR: --%s and --%s must be passed together", queryFlag, dirFlag), 1)
+					}
+					return nil
+				},
+				BashComplete: completeWorkflowFlags,
+				Action: withWorkflowService(func(c *cli.Context, ws *workflowService) error {
+					if c.IsSet(queryFlag) {
+						return exportHistories(c, ws)
+					}
+					events, err := ws.history(c.Context, &commonpb.WorkflowExecution{
+						WorkflowId: c.String(workflowIDFlag),
+						RunId:      c.String(runIDFlag),
+					})
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to export workflow history: %v", err), 1)
+					}
+					if err := writeHistory(c.App.Writer, c.String(formatFlag), events); err != nil {
+						return cli.Exit(fmt.Sprintf("ERROR: unable to export workflow history: %v", err), 1)
+					}
+					return nil
+				}),
+			},
+			newWorkflowImportCommand(defaultCfg),
+			newWorkflowBatchCommand(),
+		},
+	}
+}
+
+// exportHistories writes the history of each workflow run matching the query to the export
+// directory, naming files after the workflow and run IDs.
+func exportHistories(c *cli.Context, ws *workflowService) error {
+	list, err := ws.list(c.Context, c.String(queryFlag), 0)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to list workflows: %v", err), 1)
+	}
+	dir := c.String(dirFlag)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return cli.Exit(fmt.Sprintf("ERROR: unable to create directory: %v", err), 1)
+	}
+	ext := ".json"
+	if c.String(formatFlag) == "proto" {
+		ext = ".pb"
+	}
+	for _, w := range list {
+		events, err := ws.history(c.Context, &commonpb.WorkflowExecution{WorkflowId: w.WorkflowID, RunId: w.RunID})
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("ERROR: unable to export history of workflow %q: %v", w.WorkflowID, err), 1)
+		}
+		var buf bytes.Buffer
+		if err := writeHistory(&buf, c.String(formatFlag), events); err != nil {
+			return cli.Exit(fmt.Sprintf("ERROR: unable to export history of workflow %q: %v", w.WorkflowID, err), 1)
+		}
+		name := filepath.Join(dir, url.PathEscape(w.WorkflowID)+"_"+w.RunID+ext)
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("ERROR: unable to export history of workflow %q: %v", w.WorkflowID, err), 1)
+		}
+	}
+	fmt.Fprintf(c.App.Writer, "Exported %d workflow histories to %s\n", len(list), dir)
+	return nil
+}
+
+// writeHistory writes history events in the JSON format read by client.HistoryFromJSON, or as
+// a binary History protobuf.
+func writeHistory(w io.Writer, format string, events []*historypb.HistoryEvent) error {
+	history := &historypb.History{Events: events}
+	if format == "proto" {
+		data, err := history.Marshal()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	marshaler := jsonpb.Marshaler{Indent: "  "}
+	if err := marshaler.Marshal(w, history); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// newWorkflowTargetFlags returns the flags selecting the server and namespace of workflows.
+func newWorkflowTargetFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        addressFlag,
+			Usage:       "host:port of the temporal-frontend GRPC service",
+			DefaultText: defaultFrontendAddress,
+		},
+		&cli.StringFlag{
+			Name:        namespaceFlag,
+			Aliases:     []string{"n"},
+			Usage:       "namespace of the workflows",
+			DefaultText: fmt.Sprintf("first namespace registered by a --%s or --%s server, otherwise %q", dataDirFlag, profileFlag, defaultNamespace),
+		},
+	}, append(newServerDirFlags(), newClientTLSFlags()...)...)
+}
+
+func newRunIDFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:        runIDFlag,
+		Aliases:     []string{"r"},
+		Usage:       "run ID of the workflow",
+		DefaultText: "latest run",
+	}
+}
+
+func newReasonFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  reasonFlag,
+		Usage: "reason recorded in the workflow history",
+		Value: "temporalite CLI",
+	}
+}
+
+func newInputFlag(usage string) cli.Flag {
+	return &cli.GenericFlag{
+		Name:    inputFlag,
+		Aliases: []string{"i"},
+		Usage:   usage + " as JSON, repeat the flag to pass several arguments",
+		Value:   &jsonValues{},
+	}
+}
+
+// jsonValues collects JSON values. Unlike a string slice flag it doesn't split values on
+// commas, which JSON values are full of.
+type jsonValues []json.RawMessage
+
+var _ flag.Value = (*jsonValues)(nil)
+
+func (v *jsonValues) Set(value string) error {
+	if !json.Valid([]byte(value)) {
+		return errors.New("invalid JSON")
+	}
+	*v = append(*v, json.RawMessage(value))
+	return nil
+}
+
+func (v *jsonValues) String() string {
+	if v == nil {
+		return ""
+	}
+	values := make([]string, len(*v))
+	for i, value := range *v {
+		values[i] = string(value)
+	}
+	return strings.Join(values, " ")
+}
+
+func inputPayloads(c *cli.Context) (*commonpb.Payloads, error) {
+	values, _ := c.Generic(inputFlag).(*jsonValues)
+	if values == nil || len(*values) == 0 {
+		return nil, nil
+	}
+	jsonConverter := converter.NewJSONPayloadConverter()
+	payloads := &commonpb.Payloads{}
+	for _, value := range *values {
+		p, err := jsonConverter.ToPayload(value)
+		if err != nil {
+			return nil, cli.Exit(fmt.Sprintf("bad value %q passed for flag %q: %v", value, inputFlag, err), 1)
+		}
+		payloads.Payloads = append(payloads.Payloads, p)
+	}
+	return payloads, nil
+}
+
+// payloadsToJSON returns JSON payloads as they are and any other payload as a JSON string.
+func payloadsToJSON(payloads *commonpb.Payloads) []json.RawMessage {
+	var values []json.RawMessage
+	for _, p := range payloads.GetPayloads() {
+		if string(p.GetMetadata()[converter.MetadataEncoding]) == converter.MetadataEncodingJSON && json.Valid(p.GetData()) {
+			values = append(values, p.GetData())
+			continue
+		}
+		s, _ := json.Marshal(converter.GetDefaultDataConverter().ToString(p))
+		values = append(values, s)
+	}
+	return values
+}
+
+func requireWorkflowID(next cli.BeforeFunc) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return cli.Exit(fmt.Sprintf("ERROR: %s command requires a workflow ID as its only argument.", c.Command.Name), 1)
+		}
+		if next != nil {
+			return next(c)
+		}
+		return nil
+	}
+}
+
+func cliIdentity() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%d@%s@temporalite", os.Getpid(), host)
+}
+
+// workflowService is the workflow service of the server and the namespace selected by a
+// command's flags.
+type workflowService struct {
+	conn      *grpc.ClientConn
+	client    workflowservice.WorkflowServiceClient
+	namespace string
+}
+
+// withWorkflowService connects to the server selected by the command's flags for action.
+func withWorkflowService(action func(*cli.Context, *workflowService) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		ws, err := dialWorkflowService(c)
+		if err != nil {
+			return err
+		}
+		defer ws.conn.Close()
+		return action(c, ws)
+	}
+}
+
+func dialWorkflowService(c *cli.Context) (*workflowService, error) {
+	var set []string
+	for _, name := range []string{addressFlag, dataDirFlag, profileFlag} {
+		if c.IsSet(name) {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: only one of %q or %q flags may be passed at a time", set[0], set[1]), 1)
+	}
+
+	address, namespace := defaultFrontendAddress, defaultNamespace
+	clientTLS := flagsClientTLS(c)
+	switch {
+	case c.IsSet(dataDirFlag) || c.IsSet(profileFlag):
+		dir, err := serverDataDir(c)
+		if err != nil {
+			return nil, err
+		}
+		state, err := dir.ReadState()
+		if err != nil || !process.Exists(state.PID) {
+			return nil, cli.Exit(fmt.Sprintf("ERROR: no server is running in %s", dir), 1)
+		}
+		address = state.FrontendAddress
+		if clientTLS == nil {
+			clientTLS = state.TLS
+		}
+		if len(state.Namespaces) > 0 {
+			namespace = state.Namespaces[0]
+		}
+	case c.IsSet(addressFlag):
+		address = c.String(addressFlag)
+	}
+	if c.IsSet(namespaceFlag) {
+		namespace = c.String(namespaceFlag)
+	}
+
+	conn, err := dialFrontend(c.Context, address, clientTLS)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("ERROR: unable to connect to %s: %v", address, err), 1)
+	}
+	return &workflowService{
+		conn:      conn,
+		client:    workflowservice.NewWorkflowServiceClient(conn),
+		namespace: namespace,
+	}, nil
+}
+
+// execution returns the workflow execution passed to the command.
+func (ws *workflowService) execution(c *cli.Context) *commonpb.WorkflowExecution {
+	return &commonpb.WorkflowExecution{
+		WorkflowId: c.Args().First(),
+		RunId:      c.String(runIDFlag),
+	}
+}
+
+// workflowRun identifies a run of a workflow.
+type workflowRun struct {
+	WorkflowID string `json:"workflow_id"`
+	RunID      string `json:"run_id"`
+}
+
+// workflowExecution summarizes a workflow run.
+type workflowExecution struct {
+	workflowRun
+	Type          string     `json:"type"`
+	TaskQueue     string     `json:"task_queue"`
+	Status        string     `json:"status"`
+	StartTime     *time.Time `json:"start_time,omitempty"`
+	CloseTime     *time.Time `json:"close_time,omitempty"`
+	HistoryLength int64      `json:"history_length"`
+}
+
+func newWorkflowExecution(info *workflowpb.WorkflowExecutionInfo) workflowExecution {
+	return workflowExecution{
+		workflowRun: workflowRun{
+			WorkflowID: info.GetExecution().GetWorkflowId(),
+			RunID:      info.GetExecution().GetRunId(),
+		},
+		Type:          info.GetType().GetName(),
+		TaskQueue:     info.GetTaskQueue(),
+		Status:        info.GetStatus().String(),
+		StartTime:     info.GetStartTime(),
+		CloseTime:     info.GetCloseTime(),
+		HistoryLength: info.GetHistoryLength(),
+	}
+}
+
+// workflowDetails describes a workflow run along with its history.
+type workflowDetails struct {
+	workflowExecution
+	PendingActivities int               `json:"pending_activities"`
+	Result            []json.RawMessage `json:"result,omitempty"`
+	History           []json.RawMessage `json:"history"`
+	events            []*historypb.HistoryEvent
+}
+
+func (ws *workflowService) list(ctx context.Context, query string, limit int) ([]workflowExecution, error) {
+	var (
+		result []workflowExecution
+		token  []byte
+	)
+	for {
+		resp, err := ws.client.ListWorkflowExecutions(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     ws.namespace,
+			Query:         query,
+			NextPageToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range resp.GetExecutions() {
+			if limit > 0 && len(result) == limit {
+				return result, nil
+			}
+			result = append(result, newWorkflowExecution(info))
+		}
+		if token = resp.GetNextPageToken(); len(token) == 0 {
+			return result, nil
+		}
+	}
+}
+
+func (ws *workflowService) show(ctx context.Context, execution *commonpb.WorkflowExecution) (*workflowDetails, error) {
+	resp, err := ws.client.DescribeWorkflowExecution(ctx, &workflowservice.DescribeWorkflowExecutionRequest{
+		Namespace: ws.namespace,
+		Execution: execution,
+	})
+	if err != nil {
+		return nil, err
+	}
+	details := &workflowDetails{
+		workflowExecution: newWorkflowExecution(resp.GetWorkflowExecutionInfo()),
+		PendingActivities: len(resp.GetPendingActivities()),
+		History:           []json.RawMessage{},
+	}
+	// Pin the run so that the history matches the description.
+	events, err := ws.history(ctx, &commonpb.WorkflowExecution{WorkflowId: details.WorkflowID, RunId: details.RunID})
+	if err != nil {
+		return nil, err
+	}
+	marshaler := jsonpb.Marshaler{}
+	for _, event := range events {
+		data, err := marshaler.MarshalToString(event)
+		if err != nil {
+			return nil, err
+		}
+		details.History = append(details.History, json.RawMessage(data))
+		if completed := event.GetWorkflowExecutionCompletedEventAttributes(); completed != nil {
+			details.Result = payloadsToJSON(completed.GetResult())
+		}
+	}
+	details.events = events
+	return details, nil
+}
+
+func (ws *workflowService) history(ctx context.Context, execution *commonpb.WorkflowExecution) ([]*historypb.HistoryEvent, error) {
+	var (
+		events []*historypb.HistoryEvent
+		token  []byte
+	)
+	for {
+		resp, err := ws.client.GetWorkflowExecutionHistory(ctx, &workflowservice.GetWorkflowExecutionHistoryRequest{
+			Namespace:     ws.namespace,
+			Execution:     execution,
+			NextPageToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, resp.GetHistory().GetEvents()...)
+		if token = resp.GetNextPageToken(); len(token) == 0 {
+			return events, nil
+		}
+	}
+}
+
+// findWorkflowTask returns the ID of the first or last completed workflow task event.
+func (ws *workflowService) findWorkflowTask(ctx context.Context, execution *commonpb.WorkflowExecution, resetType string) (int64, error) {
+	events, err := ws.history(ctx, execution)
+	if err != nil {
+		return 0, err
+	}
+	var eventID int64
+	for _, event := range events {
+		if event.GetEventType() != enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED {
+			continue
+		}
+		eventID = event.GetEventId()
+		if resetType == resetFirstWorkflowTask {
+			break
+		}
+	}
+	if eventID == 0 {
+		return 0, errors.New("workflow has no completed workflow task")
+	}
+	return eventID, nil
+}
+
+func writeWorkflowExecutions(w io.Writer, list []workflowExecution) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW ID\tRUN ID\tTYPE\tSTATUS\tSTART TIME\tCLOSE TIME")
+	for _, e := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.WorkflowID, e.RunID, e.Type, e.Status, formatTime(e.StartTime), formatTime(e.CloseTime))
+	}
+	return tw.Flush()
+}
+
+func writeWorkflowDetails(w io.Writer, d *workflowDetails) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Workflow ID:\t%s\n", d.WorkflowID)
+	fmt.Fprintf(tw, "Run ID:\t%s\n", d.RunID)
+	fmt.Fprintf(tw, "Type:\t%s\n", d.Type)
+	fmt.Fprintf(tw, "Task Queue:\t%s\n", d.TaskQueue)
+	fmt.Fprintf(tw, "Status:\t%s\n", d.Status)
+	fmt.Fprintf(tw, "Start Time:\t%s\n", formatTime(d.StartTime))
+	fmt.Fprintf(tw, "Close Time:\t%s\n", formatTime(d.CloseTime))
+	fmt.Fprintf(tw, "Pending Activities:\t%d\n", d.PendingActivities)
+	if d.Result != nil {
+		results := make([]string, len(d.Result))
+		for i, r := range d.Result {
+			results[i] = string(r)
+		}
+		fmt.Fprintf(tw, "Result:\t%s\n", strings.Join(results, " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tTYPE")
+	for _, event := range d.events {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", event.GetEventId(), formatTime(event.GetEventTime()), event.GetEventType())
+	}
+	return tw.Flush()
+}
+
+func writeWorkflowRun(w io.Writer, run workflowRun) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Workflow ID:\t%s\n", run.WorkflowID)
+	fmt.Fprintf(tw, "Run ID:\t%s\n", run.RunID)
+	return tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC3339)
+}
@@ -0,0 +1,473 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/replay"
+)
+
+// waitForGreeting returns the greeting it is signaled with, addressed to name.
+func waitForGreeting(ctx workflow.Context, name string) (string, error) {
+	state := "waiting"
+	if err := workflow.SetQueryHandler(ctx, "state", func() (string, error) {
+		return state, nil
+	}); err != nil {
+		return "", err
+	}
+	var greeting string
+	workflow.GetSignalChannel(ctx, "greet").Receive(ctx, &greeting)
+	state = "greeted"
+	return greeting + " " + name, nil
+}
+
+func TestWorkflowCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dir := filepath.Join(t.TempDir(), "state")
+	portProvider := liteconfig.NewPortProvider()
+	port := portProvider.MustGetFreePort()
+	portProvider.Close()
+
+	run := func(args ...string) (string, error) {
+		temporaliteCLI := buildCLI()
+		// Don't call os.Exit
+		temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+		var out bytes.Buffer
+		temporaliteCLI.Writer = &out
+		err := temporaliteCLI.RunContext(ctx, append([]string{"temporalite", "workflow"}, args...))
+		return out.String(), err
+	}
+
+	if _, err := run("list", "--data-dir", dir); err == nil || !strings.Contains(err.Error(), "no server is running") {
+		t.Errorf("expected error without a running server, got %v", err)
+	}
+
+	startServer := func(port int) (stop func()) {
+		serverCtx, stopServer := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			temporaliteCLI := buildCLI()
+			temporaliteCLI.ExitErrHandler = func(_ *cli.Context, _ error) {}
+			args := []string{"temporalite", "start", "--data-dir", dir, "--namespace", "dev", "--namespace", "default", "--log-format", "noop", "--headless", "--port", strconv.Itoa(port)}
+			if err := temporaliteCLI.RunContext(serverCtx, args); err != nil {
+				fmt.Println("Server closed with error:", err)
+			}
+		}()
+		return func() {
+			stopServer()
+			<-done
+		}
+	}
+	stopServer := startServer(port)
+	defer func() { stopServer() }()
+	_, clientOpts := newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+
+	clientOpts.Namespace = "dev"
+	c, err := client.Dial(clientOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w := worker.New(c, "cli-test", worker.Options{})
+	w.RegisterWorkflowWithOptions(waitForGreeting, workflow.RegisterOptions{Name: "waitForGreeting"})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// Commands default to the first namespace registered by the server of the data directory.
+	out, err := run("start", "--data-dir", dir, "--type", "waitForGreeting", "-t", "cli-test", "--workflow-id", "greeting", "--input", `"Temporalite"`, "--output", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var started workflowRun
+	if err := json.Unmarshal([]byte(out), &started); err != nil {
+		t.Fatal(err)
+	}
+	if started.WorkflowID != "greeting" || started.RunID == "" {
+		t.Errorf("unexpected started workflow %+v", started)
+	}
+	if _, err := run("start", "--data-dir", dir, "--type", "waitForGreeting", "-t", "cli-test", "--input", "{"); err == nil {
+		t.Error("expected error for invalid JSON input")
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	query := func() string {
+		out, err := run("query", "--address", address, "-n", "dev", "--type", "state", "greeting")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out)
+	}
+	show := func(runID string) workflowDetails {
+		out, err := run("show", "--address", address, "-n", "dev", "--run-id", runID, "--output", "json", "greeting")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var details workflowDetails
+		if err := json.Unmarshal([]byte(out), &details); err != nil {
+			t.Fatal(err)
+		}
+		return details
+	}
+	waitForStatus := func(runID string, status string) workflowDetails {
+		for {
+			details := show(runID)
+			if details.Status == status {
+				return details
+			}
+			if ctx.Err() != nil {
+				t.Fatalf("workflow did not reach status %s: %+v", status, details)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	if state := query(); state != `"waiting"` {
+		t.Errorf("unexpected query result %s", state)
+	}
+	if _, err := run("signal", "--address", address, "-n", "dev", "--name", "greet", "--input", `"Hello"`, "greeting"); err != nil {
+		t.Fatal(err)
+	}
+	details := waitForStatus(started.RunID, "Completed")
+	if len(details.Result) != 1 || string(details.Result[0]) != `"Hello Temporalite"` {
+		t.Errorf("unexpected result %s", details.Result)
+	}
+	if len(details.History) == 0 {
+		t.Error("expected history events")
+	}
+
+	out, err = run("export", "--address", address, "-n", "dev", "--id", "greeting", "--run-id", started.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := client.HistoryFromJSON(strings.NewReader(out), client.HistoryJSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Events) != len(details.History) {
+		t.Errorf("expected %d exported events, got %d", len(details.History), len(history.Events))
+	}
+	out, err = run("export", "--address", address, "-n", "dev", "--id", "greeting", "--format", "proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protoHistory historypb.History
+	if err := protoHistory.Unmarshal([]byte(out)); err != nil {
+		t.Fatal(err)
+	}
+	if !protoHistory.Equal(history) {
+		t.Error("expected proto and JSON exports to hold the same history")
+	}
+	if _, err := run("export", "--address", address, "-n", "dev", "--id", "greeting", "--format", "yaml"); err == nil {
+		t.Error("expected error for unknown export format")
+	}
+	if _, err := run("export", "--address", address, "-n", "dev", "--query", "WorkflowId='greeting'"); err == nil {
+		t.Error("expected error exporting by query without a directory")
+	}
+	complete := func(args ...string) string {
+		// Completion looks at the raw arguments like urfave/cli does
+		defer func(args []string) { os.Args = args }(os.Args)
+		os.Args = append(append([]string{"temporalite", "workflow"}, args...), "--generate-bash-completion")
+		out, err := run(os.Args[2:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if out := complete("show", "--address", address, "-n", "dev"); !strings.Contains(out, "greeting\n") {
+		t.Errorf("expected workflow IDs to be completed, got %q", out)
+	}
+	if out := complete("export", "--address", address, "-n"); !strings.Contains(out, "dev\n") || !strings.Contains(out, "default\n") {
+		t.Errorf("expected namespaces to be completed, got %q", out)
+	}
+	historiesDir := filepath.Join(t.TempDir(), "histories")
+	if _, err := run("export", "--address", address, "-n", "dev", "--query", "WorkflowId='greeting'", "--dir", historiesDir); err != nil {
+		t.Fatal(err)
+	}
+	results, err := replay.Dir(historiesDir, func(r worker.WorkflowRegistry) {
+		r.RegisterWorkflow(waitForGreeting)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil || filepath.Base(results[0].File) != "greeting_"+started.RunID+".json" {
+		t.Errorf("expected exported history to replay, got %v", results)
+	}
+
+	out, err = run("reset", "--address", address, "-n", "dev", "--reset-type", "first-workflow-task", "--output", "json", "greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reset workflowRun
+	if err := json.Unmarshal([]byte(out), &reset); err != nil {
+		t.Fatal(err)
+	}
+	if reset.RunID == "" || reset.RunID == started.RunID {
+		t.Errorf("expected a new run, got %+v", reset)
+	}
+	if _, err := run("reset", "--address", address, "-n", "dev", "--event-id", "4", "--reset-type", "first-workflow-task", "greeting"); err == nil {
+		t.Error("expected error passing both an event ID and a reset type")
+	}
+	// The signal is reapplied to the new run.
+	waitForStatus(reset.RunID, "Completed")
+
+	out, err = run("start", "--data-dir", dir, "--type", "waitForGreeting", "-t", "cli-test", "--workflow-id", "greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "greeting") {
+		t.Errorf("unexpected start output:\n%s", out)
+	}
+	if state := query(); state != `"waiting"` {
+		t.Errorf("unexpected query result %s", state)
+	}
+	if _, err := run("cancel", "--address", address, "-n", "dev", "greeting"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("terminate", "--address", address, "-n", "dev", "--reason", "test", "greeting"); err != nil {
+		t.Fatal(err)
+	}
+	terminated := show("")
+	if terminated.Status != "Terminated" {
+		t.Errorf("expected workflow to be terminated, got %s", terminated.Status)
+	}
+
+	out, err = run("show", "--data-dir", dir, "greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "WorkflowExecutionTerminated") {
+		t.Errorf("expected terminated event in history:\n%s", out)
+	}
+
+	// Visibility is updated asynchronously, poll it slowly enough not to be rate limited.
+	for {
+		out, err := run("list", "--data-dir", dir, "--output", "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list []workflowExecution
+		if err := json.Unmarshal([]byte(out), &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) == 3 && list[0].Status == "Terminated" && list[1].Status == "Completed" {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("unexpected workflows %+v", list)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	out, err = run("list", "--data-dir", dir, "--limit", "1", "--query", "ExecutionStatus='Terminated'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[1], terminated.RunID) {
+		t.Errorf("unexpected workflow list:\n%s", out)
+	}
+	out, err = run("list", "--data-dir", dir, "-n", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "greeting") {
+		t.Errorf("expected no workflows in default namespace:\n%s", out)
+	}
+
+	// Histories are imported while no server uses the database.
+	exported := filepath.Join(historiesDir, "greeting_"+started.RunID+".json")
+	if _, err := run("import", "--data-dir", dir, "-n", "default", exported); err == nil || !strings.Contains(err.Error(), "Stop the server") {
+		t.Errorf("expected error importing into the database of a running server, got %v", err)
+	}
+	stopServer()
+
+	// The exported run keeps its workflow and run IDs, in another namespace.
+	out, err = run("import", "--data-dir", dir, "-n", "default", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"greeting"`) || !strings.Contains(out, started.RunID) {
+		t.Errorf("unexpected import output:\n%s", out)
+	}
+	if _, err := run("import", "--data-dir", dir, "-n", "default", exported); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected error importing a run twice, got %v", err)
+	}
+	out, err = run("import", "--data-dir", dir, "-n", "default", "--workflow-id", "greeting-copy", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "greeting-copy") {
+		t.Errorf("unexpected import output:\n%s", out)
+	}
+
+	writeHistory := func(name string, events []*historypb.HistoryEvent) string {
+		file := filepath.Join(t.TempDir(), name)
+		data, err := (&historypb.History{Events: events}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	running := writeHistory("running.pb", history.Events[:3])
+	if _, err := run("import", "--data-dir", dir, "-n", "default", running); err == nil || !strings.Contains(err.Error(), "closed workflows") {
+		t.Errorf("expected error importing the history of a running workflow, got %v", err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty.json")
+	if err := os.WriteFile(empty, []byte(`{"events": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("import", "--data-dir", dir, "-n", "default", empty); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected error importing an empty history, got %v", err)
+	}
+	if _, err := run("import", "--data-dir", dir, "-n", "default", "--workflow-id", "greeting-gap", writeHistory("gap.pb", append(history.Events[:1:1], history.Events[2:]...))); err == nil || !strings.Contains(err.Error(), "missing events") {
+		t.Errorf("expected error importing a history with missing events, got %v", err)
+	}
+
+	// Histories are stored as they are, fired timers and timeouts included.
+	last := history.Events[len(history.Events)-1]
+	timerEvents := append(append([]*historypb.HistoryEvent{}, history.Events[:len(history.Events)-1]...), &historypb.HistoryEvent{
+		EventId:    last.GetEventId(),
+		EventTime:  last.GetEventTime(),
+		EventType:  enumspb.EVENT_TYPE_TIMER_FIRED,
+		Attributes: &historypb.HistoryEvent_TimerFiredEventAttributes{TimerFiredEventAttributes: &historypb.TimerFiredEventAttributes{TimerId: "1"}},
+	}, &historypb.HistoryEvent{
+		EventId:    last.GetEventId() + 1,
+		EventTime:  last.GetEventTime(),
+		EventType:  last.GetEventType(),
+		Attributes: last.GetAttributes(),
+	})
+	if _, err := run("import", "--data-dir", dir, "-n", "default", "--workflow-id", "greeting-timer", writeHistory("timer.pb", timerEvents)); err != nil {
+		t.Errorf("unexpected error importing a history with a fired timer: %v", err)
+	}
+	timeoutEvents := append(append([]*historypb.HistoryEvent{}, history.Events[:3]...), &historypb.HistoryEvent{
+		EventId:   4,
+		EventTime: history.Events[2].GetEventTime(),
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskTimedOutEventAttributes{WorkflowTaskTimedOutEventAttributes: &historypb.WorkflowTaskTimedOutEventAttributes{
+			ScheduledEventId: 2,
+			StartedEventId:   3,
+			TimeoutType:      enumspb.TIMEOUT_TYPE_START_TO_CLOSE,
+		}},
+	}, &historypb.HistoryEvent{
+		EventId:    5,
+		EventTime:  history.Events[2].GetEventTime(),
+		EventType:  enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionTimedOutEventAttributes{WorkflowExecutionTimedOutEventAttributes: &historypb.WorkflowExecutionTimedOutEventAttributes{}},
+	})
+	if _, err := run("import", "--data-dir", dir, "-n", "default", "--workflow-id", "greeting-timeout", writeHistory("timeout.pb", timeoutEvents)); err != nil {
+		t.Errorf("unexpected error importing a history with timeouts: %v", err)
+	}
+
+	// The first server's membership ports are only released when the process exits.
+	portProvider = liteconfig.NewPortProvider()
+	port = portProvider.MustGetFreePort()
+	portProvider.Close()
+	address = "127.0.0.1:" + strconv.Itoa(port)
+	stopServer = startServer(port)
+	_, clientOpts = newServerAndClientOpts(port)
+	assertServerHealth(t, ctx, clientOpts)
+
+	exportImported := func(workflowID string) *historypb.History {
+		out, err := run("export", "--address", address, "-n", "default", "--id", workflowID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := client.HistoryFromJSON(strings.NewReader(out), client.HistoryJSONOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	if imported := exportImported("greeting"); !imported.Equal(history) {
+		t.Errorf("expected imported history to match the exported one, got %v", imported)
+	}
+	if imported := exportImported("greeting-timer"); !imported.Equal(&historypb.History{Events: timerEvents}) {
+		t.Errorf("expected imported history with a fired timer to match, got %v", imported)
+	}
+	if imported := exportImported("greeting-timeout"); !imported.Equal(&historypb.History{Events: timeoutEvents}) {
+		t.Errorf("expected imported history with timeouts to match, got %v", imported)
+	}
+	out, err = run("show", "--address", address, "-n", "default", "--output", "json", "greeting-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported workflowDetails
+	if err := json.Unmarshal([]byte(out), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if imported.Status != "Completed" || imported.TaskQueue != "cli-test" || len(imported.History) != len(details.History) || string(imported.Result[0]) != `"Hello Temporalite"` {
+		t.Errorf("expected imported workflow to match the exported one, got %+v", imported)
+	}
+
+	// The server records the imported runs in visibility once started.
+	statuses := map[string]string{"greeting": "Completed", "greeting-copy": "Completed", "greeting-timer": "Completed", "greeting-timeout": "TimedOut"}
+	for {
+		out, err := run("list", "--address", address, "-n", "default", "--output", "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list []workflowExecution
+		if err := json.Unmarshal([]byte(out), &list); err != nil {
+			t.Fatal(err)
+		}
+		listed := map[string]string{}
+		for _, e := range list {
+			listed[e.WorkflowID] = e.Status
+		}
+		if reflect.DeepEqual(listed, statuses) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("unexpected imported workflows %+v", list)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
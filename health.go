@@ -0,0 +1,297 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package temporalite
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+	"go.temporal.io/server/common/primitives"
+	"go.temporal.io/server/service/worker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Names of the gRPC services reported by each service's health server.
+var grpcHealthServiceNames = map[string]string{
+	primitives.FrontendService: "temporal.api.workflowservice.v1.WorkflowService",
+	primitives.HistoryService:  "temporal.api.workflowservice.v1.HistoryService",
+	primitives.MatchingService: "temporal.api.workflowservice.v1.MatchingService",
+}
+
+const (
+	healthOK       = "ok"
+	healthFailing  = "failing"
+	healthDisabled = "disabled"
+
+	healthCheckTimeout = 2 * time.Second
+)
+
+// healthReport is the body of the /healthz and /readyz responses.
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthServer serves the metrics listener: /metrics is proxied to metricsURL, the
+// Prometheus listener of the Temporal services, while /healthz and /readyz report the
+// health of each part of the server.
+//
+// /healthz fails when the server is not running or cannot reach its database, so that
+// it can be used as a liveness probe. /readyz fails until every part is healthy.
+type healthServer struct {
+	listenAddress string
+	metricsURL    *url.URL
+	// Addresses of the gRPC services, by service name.
+	serviceAddresses map[string]string
+	// TLS configuration to dial each service with, nil for services serving plaintext.
+	serviceTLS  map[string]*tls.Config
+	databaseDSN string
+	uiEnabled   bool
+	logger      log.Logger
+
+	server    *http.Server
+	conns     map[string]*grpc.ClientConn
+	db        *sql.DB
+	running   atomic.Bool
+	uiRunning atomic.Bool
+	stopOnce  sync.Once
+}
+
+func (h *healthServer) start() error {
+	listener, err := net.Listen("tcp", h.listenAddress)
+	if err != nil {
+		return fmt.Errorf("unable to listen on metrics address: %w", err)
+	}
+
+	// Neither dialing nor opening the database connects until a check runs.
+	h.conns = make(map[string]*grpc.ClientConn, len(h.serviceAddresses))
+	for name, address := range h.serviceAddresses {
+		creds := insecure.NewCredentials()
+		if cfg := h.serviceTLS[name]; cfg != nil {
+			creds = credentials.NewTLS(cfg)
+		}
+		conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		h.conns[name] = conn
+	}
+	if h.db, err = sql.Open("sqlite", h.databaseDSN); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	h.db.SetMaxOpenConns(1)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &httputil.ReverseProxy{Director: func(r *http.Request) {
+		r.URL.Scheme, r.URL.Host, r.URL.Path = h.metricsURL.Scheme, h.metricsURL.Host, h.metricsURL.Path
+	}})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serveReport(w, r, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serveReport(w, r, true)
+	})
+	h.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = h.server.Serve(listener) }()
+	h.logger.Info("Serving metrics and health checks on /metrics, /healthz and /readyz", tag.Address(listener.Addr().String()))
+	return nil
+}
+
+func (h *healthServer) stop() {
+	h.stopOnce.Do(func() {
+		h.running.Store(false)
+		if h.server == nil {
+			return
+		}
+		_ = h.server.Close()
+		for _, conn := range h.conns {
+			_ = conn.Close()
+		}
+		_ = h.db.Close()
+	})
+}
+
+func (h *healthServer) serveReport(w http.ResponseWriter, r *http.Request, ready bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	report := h.check(ctx)
+	healthy := report.Checks["server"].Status == healthOK && report.Checks["database"].Status == healthOK
+	if ready {
+		healthy = report.Status == healthOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+}
+
+// check runs every health check concurrently.
+func (h *healthServer) check(ctx context.Context) healthReport {
+	checks := map[string]func(context.Context) error{
+		"server": func(context.Context) error {
+			if !h.running.Load() {
+				return errors.New("server is not running")
+			}
+			return nil
+		},
+		"database":               h.checkDatabase,
+		primitives.WorkerService: h.checkWorker,
+	}
+	for name := range grpcHealthServiceNames {
+		name := name
+		checks[name] = func(ctx context.Context) error { return h.checkGRPCHealth(ctx, name) }
+	}
+
+	report := healthReport{Status: healthOK, Checks: make(map[string]checkResult, len(checks)+1)}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		name, check := name, check
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := checkResult{Status: healthOK}
+			if err := check(ctx); err != nil {
+				result = checkResult{Status: healthFailing, Error: err.Error()}
+			}
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case !h.uiEnabled:
+		report.Checks["ui"] = checkResult{Status: healthDisabled}
+	case h.uiRunning.Load():
+		report.Checks["ui"] = checkResult{Status: healthOK}
+	default:
+		report.Checks["ui"] = checkResult{Status: healthFailing, Error: "ui server is not running"}
+	}
+
+	for _, result := range report.Checks {
+		if result.Status == healthFailing {
+			report.Status = healthFailing
+		}
+	}
+	return report
+}
+
+func (h *healthServer) checkGRPCHealth(ctx context.Context, service string) error {
+	resp, err := healthpb.NewHealthClient(h.conns[service]).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: grpcHealthServiceNames[service],
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%s service is %s", service, resp.GetStatus())
+	}
+	return nil
+}
+
+// waitFrontend blocks until the frontend reports itself as serving, or ctx is done. Unlike the
+// health checks, it does not depend on the metrics listener being started.
+func (h *healthServer) waitFrontend(ctx context.Context) error {
+	creds := insecure.NewCredentials()
+	if cfg := h.serviceTLS[primitives.FrontendService]; cfg != nil {
+		creds = credentials.NewTLS(cfg)
+	}
+	conn, err := grpc.Dial(h.serviceAddresses[primitives.FrontendService], grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	client := healthpb.NewHealthClient(conn)
+	for {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{
+			Service: grpcHealthServiceNames[primitives.FrontendService],
+		})
+		if err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// checkWorker checks that the worker service polls for the system workflows it runs, as it
+// has no health server and is the last service to finish starting.
+func (h *healthServer) checkWorker(ctx context.Context) error {
+	resp, err := workflowservice.NewWorkflowServiceClient(h.conns[primitives.FrontendService]).
+		DescribeTaskQueue(ctx, &workflowservice.DescribeTaskQueueRequest{
+			Namespace:     primitives.SystemLocalNamespace,
+			TaskQueue:     &taskqueuepb.TaskQueue{Name: worker.DefaultWorkerTaskQueue},
+			TaskQueueType: enumspb.TASK_QUEUE_TYPE_WORKFLOW,
+		})
+	if err != nil {
+		return err
+	}
+	if len(resp.GetPollers()) == 0 {
+		return errors.New("worker service is not polling its task queue")
+	}
+	return nil
+}
+
+func (h *healthServer) checkDatabase(ctx context.Context) error {
+	var n int
+	return h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM namespaces").Scan(&n)
+}
@@ -0,0 +1,404 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package temporalite
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/uuid"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const httpAPIPrefix = "/api/v1/namespaces/"
+
+// Request headers passed to the claim mapper as gRPC metadata, like the frontend's.
+var httpForwardedHeaders = []string{"Authorization", "Authorization-Extras"}
+
+// httpGateway serves a grpc-gateway style JSON mapping of the workflow operations of the
+// WorkflowService, at the paths of the web UI's API:
+//
+//	GET  /api/v1/namespaces/{namespace}/workflows
+//	POST /api/v1/namespaces/{namespace}/workflows/{workflowId}/start
+//	GET  /api/v1/namespaces/{namespace}/workflows/{workflowId}[/runs/{runId}]
+//	GET  /api/v1/namespaces/{namespace}/workflows/{workflowId}[/runs/{runId}]/events
+//	POST /api/v1/namespaces/{namespace}/workflows/{workflowId}[/runs/{runId}]/signal
+//	POST /api/v1/namespaces/{namespace}/workflows/{workflowId}[/runs/{runId}]/query
+//
+// Request bodies and responses are the JSON encoding of the gRPC messages, path parameters
+// override the corresponding request fields. Omitting the run targets the latest run.
+//
+// The frontend only sees the gateway's own client certificate, so requests are authorized by
+// the gateway with the caller's identity: its verified client certificate when the frontend
+// requires them, and its Authorization headers.
+type httpGateway struct {
+	listenAddress   string
+	frontendAddress string
+	// TLS configurations of the frontend, nil when it serves plaintext.
+	serverTLS *tls.Config
+	clientTLS *tls.Config
+	// authorize runs the frontend's claim mapper and authorizer.
+	authorize grpc.UnaryServerInterceptor
+
+	server   *http.Server
+	conn     *grpc.ClientConn
+	client   workflowservice.WorkflowServiceClient
+	stopOnce sync.Once
+}
+
+func (g *httpGateway) start() error {
+	listener, err := net.Listen("tcp", g.listenAddress)
+	if err != nil {
+		return fmt.Errorf("unable to listen on HTTP API address: %w", err)
+	}
+	if g.serverTLS != nil {
+		listener = tls.NewListener(listener, g.serverTLS)
+	}
+
+	creds := insecure.NewCredentials()
+	if g.clientTLS != nil {
+		creds = credentials.NewTLS(g.clientTLS)
+	}
+	if g.conn, err = grpc.Dial(g.frontendAddress, grpc.WithTransportCredentials(creds)); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	g.client = workflowservice.NewWorkflowServiceClient(g.conn)
+
+	g.server = &http.Server{Handler: g, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = g.server.Serve(listener) }()
+	return nil
+}
+
+func (g *httpGateway) stop() {
+	g.stopOnce.Do(func() {
+		if g.server == nil {
+			return
+		}
+		_ = g.server.Close()
+		_ = g.conn.Close()
+	})
+}
+
+// httpRoute is a request path split into its parameters.
+type httpRoute struct {
+	namespace  string
+	workflowID string
+	runID      string
+	// Last path segment after the workflow, empty for the workflow itself.
+	action string
+}
+
+func parseHTTPRoute(u *url.URL) (httpRoute, bool) {
+	path := u.EscapedPath()
+	if !strings.HasPrefix(path, httpAPIPrefix) {
+		return httpRoute{}, false
+	}
+	segments := strings.Split(strings.TrimPrefix(path, httpAPIPrefix), "/")
+	for i, segment := range segments {
+		s, err := url.PathUnescape(segment)
+		if err != nil || s == "" {
+			return httpRoute{}, false
+		}
+		segments[i] = s
+	}
+	if len(segments) < 2 || segments[1] != "workflows" {
+		return httpRoute{}, false
+	}
+
+	route := httpRoute{namespace: segments[0]}
+	if len(segments) == 2 {
+		return route, true
+	}
+	route.workflowID = segments[2]
+	rest := segments[3:]
+	if len(rest) >= 2 && rest[0] == "runs" {
+		route.runID = rest[1]
+		rest = rest[2:]
+	}
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 1 && (rest[0] == "events" || rest[0] == "signal" || rest[0] == "query"):
+		route.action = rest[0]
+	case len(rest) == 1 && rest[0] == "start" && route.runID == "":
+		route.action = rest[0]
+	default:
+		return httpRoute{}, false
+	}
+	return route, true
+}
+
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, ok := parseHTTPRoute(r.URL)
+	if !ok {
+		writeHTTPError(w, status.Errorf(codes.NotFound, "no API at %s", r.URL.Path))
+		return
+	}
+
+	method := http.MethodGet
+	if route.action == "start" || route.action == "signal" || route.action == "query" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeHTTPError(w, status.Errorf(codes.Unimplemented, "method %s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+
+	md := metadata.MD{}
+	for _, header := range httpForwardedHeaders {
+		if values := r.Header.Values(header); len(values) > 0 {
+			md.Set(header, values...)
+		}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	if r.TLS != nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+	}
+
+	resp, err := g.call(ctx, r, route)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	marshaler := jsonpb.Marshaler{}
+	_ = marshaler.Marshal(w, resp)
+}
+
+func (g *httpGateway) call(ctx context.Context, r *http.Request, route httpRoute) (proto.Message, error) {
+	execution := &commonpb.WorkflowExecution{WorkflowId: route.workflowID, RunId: route.runID}
+	query := r.URL.Query()
+
+	switch {
+	case route.workflowID == "":
+		req := &workflowservice.ListWorkflowExecutionsRequest{Namespace: route.namespace, Query: queryParam(query, "query")}
+		var err error
+		if req.PageSize, err = int32QueryParam(query, "page_size", "pageSize"); err != nil {
+			return nil, err
+		}
+		if req.NextPageToken, err = bytesQueryParam(query, "next_page_token", "nextPageToken"); err != nil {
+			return nil, err
+		}
+		return g.invoke(ctx, "ListWorkflowExecutions", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.ListWorkflowExecutions(ctx, req)
+		})
+	case route.action == "":
+		req := &workflowservice.DescribeWorkflowExecutionRequest{Namespace: route.namespace, Execution: execution}
+		return g.invoke(ctx, "DescribeWorkflowExecution", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.DescribeWorkflowExecution(ctx, req)
+		})
+	case route.action == "events":
+		req := &workflowservice.GetWorkflowExecutionHistoryRequest{Namespace: route.namespace, Execution: execution}
+		var err error
+		if req.MaximumPageSize, err = int32QueryParam(query, "maximum_page_size", "maximumPageSize"); err != nil {
+			return nil, err
+		}
+		if req.NextPageToken, err = bytesQueryParam(query, "next_page_token", "nextPageToken"); err != nil {
+			return nil, err
+		}
+		if req.WaitNewEvent, err = boolQueryParam(query, "wait_new_event", "waitNewEvent"); err != nil {
+			return nil, err
+		}
+		return g.invoke(ctx, "GetWorkflowExecutionHistory", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.GetWorkflowExecutionHistory(ctx, req)
+		})
+	case route.action == "start":
+		req := &workflowservice.StartWorkflowExecutionRequest{}
+		if err := decodeHTTPBody(r, req); err != nil {
+			return nil, err
+		}
+		req.Namespace = route.namespace
+		req.WorkflowId = route.workflowID
+		if req.RequestId == "" {
+			req.RequestId = uuid.New().String()
+		}
+		return g.invoke(ctx, "StartWorkflowExecution", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.StartWorkflowExecution(ctx, req)
+		})
+	case route.action == "signal":
+		req := &workflowservice.SignalWorkflowExecutionRequest{}
+		if err := decodeHTTPBody(r, req); err != nil {
+			return nil, err
+		}
+		req.Namespace = route.namespace
+		req.WorkflowExecution = execution
+		return g.invoke(ctx, "SignalWorkflowExecution", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.SignalWorkflowExecution(ctx, req)
+		})
+	default:
+		req := &workflowservice.QueryWorkflowRequest{}
+		if err := decodeHTTPBody(r, req); err != nil {
+			return nil, err
+		}
+		req.Namespace = route.namespace
+		req.Execution = execution
+		return g.invoke(ctx, "QueryWorkflow", req, func(ctx context.Context) (proto.Message, error) {
+			return g.client.QueryWorkflow(ctx, req)
+		})
+	}
+}
+
+// invoke authorizes the caller in ctx to call method of the WorkflowService with req, then
+// makes the call with send, forwarding the caller's headers.
+func (g *httpGateway) invoke(ctx context.Context, method string, req proto.Message, send func(context.Context) (proto.Message, error)) (proto.Message, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/temporal.api.workflowservice.v1.WorkflowService/" + method}
+	resp, err := g.authorize(ctx, req, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return send(metadata.NewOutgoingContext(ctx, md))
+	})
+	if err != nil {
+		var svcErr serviceerror.ServiceError
+		if errors.As(err, &svcErr) {
+			st := serviceerror.ToStatus(svcErr)
+			return nil, status.Error(st.Code(), st.Message())
+		}
+		return nil, err
+	}
+	return resp.(proto.Message), nil
+}
+
+// decodeHTTPBody decodes the JSON request body into req, an empty body leaves it unchanged.
+func decodeHTTPBody(r *http.Request, req proto.Message) error {
+	unmarshaler := jsonpb.Unmarshaler{}
+	if err := unmarshaler.Unmarshal(r.Body, req); err != nil && !errors.Is(err, io.EOF) {
+		return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// queryParam returns the first value of the query parameter with any of names, which are
+// the field's proto and JSON names.
+func queryParam(query url.Values, names ...string) string {
+	for _, name := range names {
+		if value := query.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func int32QueryParam(query url.Values, names ...string) (int32, error) {
+	value := queryParam(query, names...)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "bad value %q for query parameter %q", value, names[0])
+	}
+	return int32(i), nil
+}
+
+func boolQueryParam(query url.Values, names ...string) (bool, error) {
+	value := queryParam(query, names...)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "bad value %q for query parameter %q", value, names[0])
+	}
+	return b, nil
+}
+
+// bytesQueryParam decodes a bytes field, encoded in base64 like in JSON bodies.
+func bytesQueryParam(query url.Values, names ...string) ([]byte, error) {
+	value := queryParam(query, names...)
+	if value == "" {
+		return nil, nil
+	}
+	var b []byte
+	if err := json.Unmarshal([]byte(strconv.Quote(value)), &b); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad value %q for query parameter %q", value, names[0])
+	}
+	return b, nil
+}
+
+// httpError is the body of error responses, like grpc-gateway's.
+type httpError struct {
+	Code    codes.Code    `json:"code"`
+	Message string        `json:"message"`
+	Details []interface{} `json:"details"`
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	_ = json.NewEncoder(w).Encode(httpError{Code: st.Code(), Message: st.Message(), Details: []interface{}{}})
+}
+
+// httpStatusFromCode maps gRPC status codes to HTTP status codes like grpc-gateway does.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,238 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package datadir defines the layout of a Temporalite data directory, which holds
+// all of the state of a server so that each project can keep its own.
+package datadir
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dir is the path of a data directory.
+type Dir string
+
+// DatabaseFile returns the path of the SQLite database.
+func (d Dir) DatabaseFile() string {
+	return filepath.Join(string(d), "temporalite.db")
+}
+
+// TLSDir returns the directory holding the TLS material generated by GenerateTLS.
+func (d Dir) TLSDir() string {
+	return filepath.Join(string(d), "tls")
+}
+
+// HistoryArchivalDir returns the directory workflow histories are archived to.
+func (d Dir) HistoryArchivalDir() string {
+	return filepath.Join(string(d), "archival", "history")
+}
+
+// VisibilityArchivalDir returns the directory visibility records are archived to.
+func (d Dir) VisibilityArchivalDir() string {
+	return filepath.Join(string(d), "archival", "visibility")
+}
+
+// LogFile returns the path of the server log file.
+func (d Dir) LogFile() string {
+	return filepath.Join(string(d), "logs", "temporalite.log")
+}
+
+// StderrFile returns the path of the file receiving the error output of servers
+// started in the background.
+func (d Dir) StderrFile() string {
+	return filepath.Join(string(d), "logs", "stderr.log")
+}
+
+// StateFile returns the path of the file describing the server running in the directory.
+// Clients read it to discover the addresses of the server.
+func (d Dir) StateFile() string {
+	return filepath.Join(string(d), "server.json")
+}
+
+// StopRequestFile returns the path of the file asking the server running in the directory
+// to shut down.
+func (d Dir) StopRequestFile() string {
+	return filepath.Join(string(d), "stop")
+}
+
+// MetadataFile returns the path of the file describing the data directory.
+func (d Dir) MetadataFile() string {
+	return filepath.Join(string(d), "metadata.json")
+}
+
+// Init creates the data directory and its subdirectories if they do not exist yet.
+func (d Dir) Init() error {
+	for _, dir := range []string{
+		string(d),
+		d.HistoryArchivalDir(),
+		d.VisibilityArchivalDir(),
+		filepath.Dir(d.LogFile()),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// Holds private keys
+	return os.MkdirAll(d.TLSDir(), 0700)
+}
+
+// Versions identifies the Temporalite build that used a data directory.
+type Versions struct {
+	Temporalite string `json:"temporalite"`
+	Server      string `json:"server"`
+	Schema      string `json:"schema"`
+}
+
+// Metadata is the content of the metadata file.
+type Metadata struct {
+	CreatedAt       time.Time `json:"created_at"`
+	CreatedWith     Versions  `json:"created_with"`
+	LastStartedAt   time.Time `json:"last_started_at"`
+	LastStartedWith Versions  `json:"last_started_with"`
+}
+
+// ReadMetadata returns the metadata of the data directory, or an error satisfying
+// errors.Is(err, fs.ErrNotExist) if no server was started in it yet.
+func (d Dir) ReadMetadata() (*Metadata, error) {
+	data, err := os.ReadFile(d.MetadataFile())
+	if err != nil {
+		return nil, err
+	}
+	var m Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// RecordStart updates the metadata file for a server started at now with the given versions.
+func (d Dir) RecordStart(versions Versions, now time.Time) error {
+	m, err := d.ReadMetadata()
+	if errors.Is(err, fs.ErrNotExist) {
+		m = &Metadata{CreatedAt: now, CreatedWith: versions}
+	} else if err != nil {
+		return err
+	}
+	m.LastStartedAt = now
+	m.LastStartedWith = versions
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(d.MetadataFile(), append(data, '\n'))
+}
+
+// State describes a running server.
+type State struct {
+	PID             int        `json:"pid"`
+	StartedAt       time.Time  `json:"started_at"`
+	Version         string     `json:"version"`
+	ServerVersion   string     `json:"server_version"`
+	FrontendAddress string     `json:"frontend_address"`
+	UIAddress       string     `json:"ui_address,omitempty"`
+	UIURL           string     `json:"ui_url,omitempty"`
+	MetricsAddress  string     `json:"metrics_address"`
+	HTTPAddress     string     `json:"http_address,omitempty"`
+	Namespaces      []string   `json:"namespaces,omitempty"`
+	TLS             *ClientTLS `json:"tls,omitempty"`
+}
+
+// ClientTLS holds the paths of the TLS material clients use to connect to a server
+// whose frontend serves TLS.
+type ClientTLS struct {
+	ServerName string `json:"server_name,omitempty"`
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+}
+
+// WriteState records the state of the server running in the directory.
+func (d Dir) WriteState(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(d.StateFile(), append(data, '\n'))
+}
+
+// ReadState returns the state of the server running in the directory, or an error
+// satisfying errors.Is(err, fs.ErrNotExist) if no server was started in it.
+//
+// The state is left behind by servers that did not shut down gracefully, callers should
+// check that the process is still running.
+func (d Dir) ReadState() (*State, error) {
+	data, err := os.ReadFile(d.StateFile())
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RemoveState removes the state file once the server stopped.
+func (d Dir) RemoveState() error {
+	if err := os.Remove(d.StateFile()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RequestStop asks the server with the given process ID to shut down gracefully.
+//
+// Unlike signals, this works on every platform, including for servers started in the
+// background on Windows.
+func (d Dir) RequestStop(pid int) error {
+	return writeFile(d.StopRequestFile(), []byte(strconv.Itoa(pid)+"\n"))
+}
+
+// StopRequested reports whether the server with the given process ID was asked to shut down,
+// consuming the request.
+func (d Dir) StopRequested(pid int) bool {
+	data, err := os.ReadFile(d.StopRequestFile())
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(pid) {
+		return false
+	}
+	_ = os.Remove(d.StopRequestFile())
+	return true
+}
+
+// writeFile writes to a temporary file first so that path is never left truncated.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,188 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package datadir
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordStart(t *testing.T) {
+	dir := Dir(t.TempDir())
+	if err := dir.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir.HistoryArchivalDir(), dir.VisibilityArchivalDir(), dir.TLSDir()} {
+		if _, err := os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1 := Versions{Temporalite: "v0.1.0", Server: "1.18.0", Schema: "0.1"}
+	if err := dir.RecordStart(v1, created); err != nil {
+		t.Fatal(err)
+	}
+	started := created.Add(time.Hour)
+	v2 := Versions{Temporalite: "v0.2.0", Server: "1.19.1", Schema: "0.1"}
+	if err := dir.RecordStart(v2, started); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := dir.ReadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Metadata{
+		CreatedAt:       created,
+		CreatedWith:     v1,
+		LastStartedAt:   started,
+		LastStartedWith: v2,
+	}
+	if *m != expected {
+		t.Errorf("expected metadata %+v, got %+v", expected, *m)
+	}
+}
+
+func TestState(t *testing.T) {
+	dir := Dir(t.TempDir())
+	if _, err := dir.ReadState(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected missing state, got %v", err)
+	}
+	state := State{
+		PID:             42,
+		StartedAt:       time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		FrontendAddress: "127.0.0.1:7233",
+		UIURL:           "http://127.0.0.1:8233",
+		Namespaces:      []string{"default"},
+		TLS:             &ClientTLS{ServerName: "localhost", CAFile: "/certs/ca.pem"},
+	}
+	if err := dir.WriteState(state); err != nil {
+		t.Fatal(err)
+	}
+	read, err := dir.ReadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*read, state) {
+		t.Errorf("expected state %+v, got %+v", state, *read)
+	}
+	if err := dir.RemoveState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.ReadState(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected state to be removed, got %v", err)
+	}
+}
+
+func TestStopRequest(t *testing.T) {
+	dir := Dir(t.TempDir())
+	if dir.StopRequested(42) {
+		t.Fatal("expected no stop request")
+	}
+	if err := dir.RequestStop(42); err != nil {
+		t.Fatal(err)
+	}
+	if dir.StopRequested(43) {
+		t.Error("expected stop request to only apply to its process")
+	}
+	if !dir.StopRequested(42) {
+		t.Error("expected stop request")
+	}
+	if dir.StopRequested(42) {
+		t.Error("expected stop request to be consumed")
+	}
+}
+
+func TestGenerateTLS(t *testing.T) {
+	dir := Dir(t.TempDir())
+	clientTLS, err := dir.GenerateTLS("10.0.0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) []byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	ca, cert, clientCert := read(clientTLS.CAFile), read(dir.CertFile()), read(clientTLS.CertFile)
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		t.Fatal("no certificate authority found")
+	}
+	leaf := func(certFile, keyFile string) *x509.Certificate {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	server := leaf(dir.CertFile(), dir.KeyFile())
+	for _, host := range []string{clientTLS.ServerName, "127.0.0.1", "::1", "10.0.0.5"} {
+		if _, err := server.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("expected certificate to be valid for %s: %v", host, err)
+		}
+	}
+	if clientTLS.CertFile == dir.CertFile() {
+		t.Error("expected a dedicated client certificate")
+	}
+	client := leaf(clientTLS.CertFile, clientTLS.KeyFile)
+	if _, err := client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected client certificate to be valid: %v", err)
+	}
+	if _, err := client.Verify(x509.VerifyOptions{DNSName: clientTLS.ServerName, Roots: roots}); err == nil {
+		t.Error("expected client certificate not to be valid for the server")
+	}
+
+	if _, err := dir.GenerateTLS("10.0.0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read(dir.CertFile()), cert) || !bytes.Equal(read(clientTLS.CertFile), clientCert) {
+		t.Error("expected certificates to be reused")
+	}
+	if _, err := dir.GenerateTLS("10.0.0.6"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(read(dir.CertFile()), cert) {
+		t.Error("expected certificate to be replaced for a new host")
+	}
+	if !bytes.Equal(read(clientTLS.CAFile), ca) {
+		t.Error("expected certificate authority to be kept")
+	}
+}
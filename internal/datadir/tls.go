@@ -0,0 +1,249 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package datadir
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// tlsServerName is the name clients verify the generated certificate against.
+	tlsServerName = "localhost"
+	// tlsClientName identifies clients presenting the generated client certificate.
+	tlsClientName = "temporalite-client"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+	// certRenewal is how long before it expires the certificate is replaced.
+	certRenewal = 30 * 24 * time.Hour
+)
+
+// CACertFile returns the path of the generated certificate authority.
+func (d Dir) CACertFile() string {
+	return filepath.Join(d.TLSDir(), "ca.pem")
+}
+
+func (d Dir) caKeyFile() string {
+	return filepath.Join(d.TLSDir(), "ca-key.pem")
+}
+
+// CertFile returns the path of the generated certificate, which the server presents to its
+// clients and its internal clients present to the server.
+func (d Dir) CertFile() string {
+	return filepath.Join(d.TLSDir(), "cert.pem")
+}
+
+// KeyFile returns the path of the private key of CertFile.
+func (d Dir) KeyFile() string {
+	return filepath.Join(d.TLSDir(), "key.pem")
+}
+
+// ClientCertFile returns the path of the generated client certificate, which other clients
+// present to the server.
+func (d Dir) ClientCertFile() string {
+	return filepath.Join(d.TLSDir(), "client-cert.pem")
+}
+
+// ClientKeyFile returns the path of the private key of ClientCertFile.
+func (d Dir) ClientKeyFile() string {
+	return filepath.Join(d.TLSDir(), "client-key.pem")
+}
+
+// GenerateTLS makes sure the directory holds a certificate authority, a server certificate it
+// signed that is valid for localhost and the given hosts and a client certificate it signed,
+// and returns the material clients need to connect to a server using them.
+//
+// The certificate authority is kept across calls so that clients can keep trusting it, the
+// certificates are replaced when they do not cover hosts or are about to expire.
+func (d Dir) GenerateTLS(hosts ...string) (*ClientTLS, error) {
+	if err := os.MkdirAll(d.TLSDir(), 0700); err != nil {
+		return nil, err
+	}
+	ca, caKey, err := d.loadOrGenerateCA()
+	if err != nil {
+		return nil, err
+	}
+	hosts = append([]string{tlsServerName, "127.0.0.1", "::1"}, hosts...)
+	server := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"Temporalite"}, CommonName: tlsServerName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			server.IPAddresses = append(server.IPAddresses, ip)
+		} else {
+			server.DNSNames = append(server.DNSNames, host)
+		}
+	}
+	if !certCovers(d.CertFile(), d.KeyFile(), ca, hosts) {
+		if err := generateCert(d.CertFile(), d.KeyFile(), server, ca, caKey); err != nil {
+			return nil, err
+		}
+	}
+	client := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"Temporalite"}, CommonName: tlsClientName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if !certCovers(d.ClientCertFile(), d.ClientKeyFile(), ca, nil) {
+		if err := generateCert(d.ClientCertFile(), d.ClientKeyFile(), client, ca, caKey); err != nil {
+			return nil, err
+		}
+	}
+	return &ClientTLS{
+		ServerName: tlsServerName,
+		CAFile:     d.CACertFile(),
+		CertFile:   d.ClientCertFile(),
+		KeyFile:    d.ClientKeyFile(),
+	}, nil
+}
+
+func (d Dir) loadOrGenerateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(d.CACertFile(), d.caKeyFile())
+	if err == nil {
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected key type in %s", d.caKeyFile())
+		}
+		return ca, key, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("unable to load certificate authority: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"Temporalite"}, CommonName: "Temporalite development CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	ca, err := createCertificate(template, template, key, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeKey(d.caKeyFile(), key); err != nil {
+		return nil, nil, err
+	}
+	if err := writeFile(d.CACertFile(), encodeCertificate(ca)); err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// certCovers reports whether the certificate at certFile exists, was signed by ca and is valid
+// for hosts for a while longer.
+func certCovers(certFile, keyFile string, ca *x509.Certificate, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || time.Now().Add(certRenewal).After(cert.NotAfter) {
+		return false
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	opts := x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	if _, err := cert.Verify(opts); err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		opts.DNSName = host
+		if _, err := cert.Verify(opts); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generateCert writes a new key and a certificate for it signed by ca, from template.
+func generateCert(certFile, keyFile string, template, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(certValidity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	cert, err := createCertificate(template, ca, key, caKey)
+	if err != nil {
+		return err
+	}
+	if err := writeKey(keyFile, key); err != nil {
+		return err
+	}
+	return writeFile(certFile, encodeCertificate(cert))
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// writeKey writes a private key readable only by the current user.
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
@@ -0,0 +1,148 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dblock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// HeldError is returned by Acquire when another live process holds the lock.
+type HeldError struct {
+	Path string
+	PID  int
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("database is locked by process %d (lock file %s)", e.PID, e.Path)
+}
+
+// Lock is an acquired lock file.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Path returns the lock file path for the given database file.
+func Path(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// Acquire takes an OS advisory lock on the lock file for dbPath and records the current
+// process ID in it. The OS releases the lock when the process exits, so lock files left
+// behind by processes that are no longer running are reused.
+//
+// When force is true and another process holds the lock, the lock file is replaced by a new
+// one. The other process keeps its lock on the removed file. Windows does not allow removing
+// files open in another process, so forcing fails there while the holder is running.
+func Acquire(dbPath string, force bool) (*Lock, error) {
+	path := Path(dbPath)
+	forced := false
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open lock file: %w", err)
+		}
+		err = lockFile(f)
+		if err == nil {
+			// The holder may have released the lock by removing the file between our
+			// open and lock calls, in which case the lock is on a file nobody else sees.
+			if !isCurrent(path, f) {
+				_ = f.Close()
+				continue
+			}
+			if err := writePID(f); err != nil {
+				_ = f.Close()
+				return nil, fmt.Errorf("unable to write lock file: %w", err)
+			}
+			return &Lock{path: path, file: f}, nil
+		}
+		_ = f.Close()
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("unable to lock %s: %w", path, err)
+		}
+		// Only replace the file once: losing the race again means another process
+		// legitimately holds the new lock.
+		if !force || forced {
+			pid, _ := readPID(path)
+			return nil, &HeldError{Path: path, PID: pid}
+		}
+		forced = true
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to remove lock file: %w", err)
+		}
+	}
+}
+
+// Release removes the lock file and releases the lock.
+//
+// The file is left in place when it was replaced by a forced acquisition.
+func (l *Lock) Release() error {
+	current := isCurrent(l.path, l.file)
+	if !removeBeforeUnlock {
+		_ = l.file.Close()
+	} else {
+		// Removing the file before unlocking it lets processes waiting for the lock
+		// detect that they locked a removed file.
+		defer func() { _ = l.file.Close() }()
+	}
+	if !current {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// isCurrent reports whether f is the file at path.
+func isCurrent(path string, f *os.File) bool {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Stat(path)
+	return err == nil && os.SameFile(fileInfo, pathInfo)
+}
+
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+func readPID(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(b)))
+}
@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dblock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	lock, err := Acquire(dbPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The current process is running, so a second acquisition must fail
+	_, err = Acquire(dbPath, false)
+	var heldErr *HeldError
+	if !errors.As(err, &heldErr) {
+		t.Fatalf("expected HeldError, got %v", err)
+	}
+	if heldErr.PID != os.Getpid() {
+		t.Errorf("expected lock to be held by %d, got %d", os.Getpid(), heldErr.PID)
+	}
+
+	forced, err := Acquire(dbPath, true)
+	if err != nil {
+		t.Fatalf("forced acquisition failed: %s", err)
+	}
+	if err := forced.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(Path(dbPath)); !os.IsNotExist(err) {
+		t.Errorf("expected lock file to be removed, got %v", err)
+	}
+	// Releasing an already removed lock is a no-op
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	for _, content := range []string{"", "garbage", strconv.Itoa(-1)} {
+		if err := os.WriteFile(Path(dbPath), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		lock, err := Acquire(dbPath, false)
+		if err != nil {
+			t.Fatalf("expected stale lock %q to be replaced, got %s", content, err)
+		}
+		b, err := os.ReadFile(Path(dbPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != strconv.Itoa(os.Getpid()) {
+			t.Errorf("expected lock file to contain %d, got %q", os.Getpid(), b)
+		}
+		if err := lock.Release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAcquireConcurrently(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	var (
+		holders  atomic.Int32
+		acquired atomic.Int32
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				lock, err := Acquire(dbPath, false)
+				var heldErr *HeldError
+				if errors.As(err, &heldErr) {
+					continue
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				acquired.Add(1)
+				if n := holders.Add(1); n != 1 {
+					t.Errorf("lock held by %d holders at once", n)
+				}
+				holders.Add(-1)
+				if err := lock.Release(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired.Load() == 0 {
+		t.Error("lock was never acquired")
+	}
+}
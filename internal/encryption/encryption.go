@@ -0,0 +1,203 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package encryption encrypts workflow data before it is written to the SQLite
+// database and keeps track of the key a database was created with.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// KeySize is the length in bytes of encryption keys.
+const KeySize = 32
+
+const (
+	// formatVersion prefixes every ciphertext so that the format can evolve.
+	formatVersion byte = 1
+
+	markerTable = "temporalite_encryption"
+	// markerPlaintext is encrypted into the marker table to detect key mismatches.
+	markerPlaintext = "temporalite"
+)
+
+var (
+	// ErrKeyMismatch is returned when a database was encrypted with a different key.
+	ErrKeyMismatch = errors.New("encryption key does not match the key the database was created with")
+	// ErrNotEncrypted is returned when an encryption key is used with a database
+	// holding unencrypted workflow data.
+	ErrNotEncrypted = errors.New("database contains unencrypted workflow data")
+	// ErrKeyRequired is returned when an encrypted database is opened without a key.
+	ErrKeyRequired = errors.New("database is encrypted and requires an encryption key")
+)
+
+// Cipher encrypts and decrypts data with AES-256-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a Cipher for the given KeySize bytes long key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ParseKey decodes the contents of a key file, which holds KeySize bytes either raw
+// or hex or base64 encoded (eg. the output of `openssl rand -hex 32`).
+func ParseKey(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if key, err := hex.DecodeString(string(trimmed)); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if len(data) == KeySize {
+		return data, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes, optionally hex or base64 encoded", KeySize)
+}
+
+// Encrypt returns the ciphertext for plaintext.
+//
+// Empty plaintexts are returned as is since there is nothing to hide and the SQL
+// store returns empty blobs for columns that were never written.
+func (c *Cipher) Encrypt(plaintext []byte) []byte {
+	if len(plaintext) == 0 {
+		return plaintext
+	}
+	nonceSize := c.aead.NonceSize()
+	out := make([]byte, 1+nonceSize, 1+nonceSize+len(plaintext)+c.aead.Overhead())
+	out[0] = formatVersion
+	if _, err := io.ReadFull(rand.Reader, out[1:]); err != nil {
+		panic(fmt.Sprintf("encryption: unable to generate nonce: %v", err))
+	}
+	return c.aead.Seal(out, out[1:], plaintext, nil)
+}
+
+// Decrypt returns the plaintext for a ciphertext produced by Encrypt.
+func (c *Cipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return ciphertext, nil
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < 1+nonceSize || ciphertext[0] != formatVersion {
+		return nil, errors.New("data is not encrypted")
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[1:1+nonceSize], ciphertext[1+nonceSize:], nil)
+	if err != nil {
+		return nil, ErrKeyMismatch
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether the database at path was created with an encryption key.
+func IsEncrypted(path string) (bool, error) {
+	db, err := open(path, "ro")
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = db.Close() }()
+	return hasMarker(db)
+}
+
+// CheckDatabase verifies that the database at path was created with the cipher's key.
+//
+// Databases without any workflow data are marked as encrypted with the cipher's key
+// on first use; an error is returned for databases holding unencrypted workflow data.
+func CheckDatabase(path string, c *Cipher) error {
+	db, err := open(path, "rw")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	ok, err := hasMarker(db)
+	if err != nil {
+		return err
+	}
+	if ok {
+		var check []byte
+		if err := db.QueryRow("SELECT key_check FROM " + markerTable).Scan(&check); err != nil {
+			return err
+		}
+		if plaintext, err := c.Decrypt(check); err != nil || string(plaintext) != markerPlaintext {
+			return ErrKeyMismatch
+		}
+		return nil
+	}
+
+	var populated bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM executions) OR EXISTS (SELECT 1 FROM history_node)").Scan(&populated); err != nil {
+		return err
+	}
+	if populated {
+		return ErrNotEncrypted
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec("CREATE TABLE " + markerTable + " (key_check BLOB NOT NULL)"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO "+markerTable+" (key_check) VALUES (?)", c.Encrypt([]byte(markerPlaintext))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func open(path string, mode string) (*sql.DB, error) {
+	return sql.Open("sqlite", fmt.Sprintf("file:%s?%s", path, url.Values{"mode": {mode}}.Encode()))
+}
+
+func hasMarker(db *sql.DB) (bool, error) {
+	var ok bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", markerTable).Scan(&ok)
+	return ok, err
+}
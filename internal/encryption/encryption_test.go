@@ -0,0 +1,98 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("workflow payload")
+	ciphertext := c.Encrypt(plaintext)
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("ciphertext contains plaintext")
+	}
+	if bytes.Equal(ciphertext, c.Encrypt(plaintext)) {
+		t.Error("expected a different ciphertext for each encryption")
+	}
+	decrypted, err := c.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, decrypted)
+	}
+	if len(c.Encrypt(nil)) != 0 {
+		t.Error("expected empty plaintext to be left as is")
+	}
+
+	other, err := NewCipher(bytes.Repeat([]byte{2}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(ciphertext); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("expected key mismatch error, got %v", err)
+	}
+	if _, err := c.Decrypt(plaintext); err == nil {
+		t.Error("expected error decrypting plaintext")
+	}
+
+	if _, err := NewCipher(key[:16]); err == nil {
+		t.Error("expected error for short key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, KeySize)
+	for name, data := range map[string][]byte{
+		"raw":    key,
+		"hex":    []byte(hex.EncodeToString(key) + "\n"),
+		"base64": []byte(base64.StdEncoding.EncodeToString(key) + "\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParseKey(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(parsed, key) {
+				t.Errorf("expected %x, got %x", key, parsed)
+			}
+		})
+	}
+
+	if _, err := ParseKey([]byte("too short")); err == nil {
+		t.Error("expected error for short key")
+	}
+}
@@ -0,0 +1,284 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encryption
+
+import (
+	"context"
+	"fmt"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/metrics"
+	"go.temporal.io/server/common/persistence"
+	"go.temporal.io/server/common/persistence/client"
+	persistencesql "go.temporal.io/server/common/persistence/sql"
+	"go.temporal.io/server/common/resolver"
+)
+
+// StoreName is the name of the custom data store wrapping the SQL store.
+const StoreName = "sqlite-encrypted"
+
+type abstractDataStoreFactory struct {
+	cfg    config.SQL
+	cipher *Cipher
+}
+
+// NewDataStoreFactory returns a factory for SQL data stores that encrypt workflow
+// mutable state and history events with the given cipher.
+//
+// Everything else, including visibility records, is stored unencrypted: it holds
+// identifiers and metadata the server needs to query.
+func NewDataStoreFactory(cfg config.SQL, cipher *Cipher) client.AbstractDataStoreFactory {
+	return &abstractDataStoreFactory{cfg: cfg, cipher: cipher}
+}
+
+func (f *abstractDataStoreFactory) NewFactory(
+	_ config.CustomDatastoreConfig,
+	r resolver.ServiceResolver,
+	clusterName string,
+	logger log.Logger,
+	_ metrics.MetricsHandler,
+) client.DataStoreFactory {
+	return &dataStoreFactory{
+		DataStoreFactory: persistencesql.NewFactory(f.cfg, r, clusterName, logger),
+		cipher:           f.cipher,
+	}
+}
+
+type dataStoreFactory struct {
+	client.DataStoreFactory
+	cipher *Cipher
+}
+
+func (f *dataStoreFactory) NewExecutionStore() (persistence.ExecutionStore, error) {
+	store, err := f.DataStoreFactory.NewExecutionStore()
+	if err != nil {
+		return nil, err
+	}
+	return &executionStore{ExecutionStore: store, cipher: f.cipher}, nil
+}
+
+// executionStore encrypts every blob of workflow mutable state and history nodes.
+//
+// Execution state blobs are the exception: the SQL store re-serializes them from
+// the decoded state, and they only hold the workflow's status.
+type executionStore struct {
+	persistence.ExecutionStore
+	cipher *Cipher
+}
+
+func (s *executionStore) CreateWorkflowExecution(ctx context.Context, request *persistence.InternalCreateWorkflowExecutionRequest) (*persistence.InternalCreateWorkflowExecutionResponse, error) {
+	req := *request
+	req.NewWorkflowSnapshot = s.encryptSnapshot(request.NewWorkflowSnapshot)
+	req.NewWorkflowNewEvents = s.encryptNodes(request.NewWorkflowNewEvents)
+	return s.ExecutionStore.CreateWorkflowExecution(ctx, &req)
+}
+
+func (s *executionStore) UpdateWorkflowExecution(ctx context.Context, request *persistence.InternalUpdateWorkflowExecutionRequest) error {
+	req := *request
+	req.UpdateWorkflowMutation = s.encryptMutation(request.UpdateWorkflowMutation)
+	req.UpdateWorkflowNewEvents = s.encryptNodes(request.UpdateWorkflowNewEvents)
+	if request.NewWorkflowSnapshot != nil {
+		snapshot := s.encryptSnapshot(*request.NewWorkflowSnapshot)
+		req.NewWorkflowSnapshot = &snapshot
+	}
+	req.NewWorkflowNewEvents = s.encryptNodes(request.NewWorkflowNewEvents)
+	return s.ExecutionStore.UpdateWorkflowExecution(ctx, &req)
+}
+
+func (s *executionStore) ConflictResolveWorkflowExecution(ctx context.Context, request *persistence.InternalConflictResolveWorkflowExecutionRequest) error {
+	req := *request
+	req.ResetWorkflowSnapshot = s.encryptSnapshot(request.ResetWorkflowSnapshot)
+	req.ResetWorkflowEventsNewEvents = s.encryptNodes(request.ResetWorkflowEventsNewEvents)
+	if request.NewWorkflowSnapshot != nil {
+		snapshot := s.encryptSnapshot(*request.NewWorkflowSnapshot)
+		req.NewWorkflowSnapshot = &snapshot
+	}
+	req.NewWorkflowEventsNewEvents = s.encryptNodes(request.NewWorkflowEventsNewEvents)
+	if request.CurrentWorkflowMutation != nil {
+		mutation := s.encryptMutation(*request.CurrentWorkflowMutation)
+		req.CurrentWorkflowMutation = &mutation
+	}
+	req.CurrentWorkflowEventsNewEvents = s.encryptNodes(request.CurrentWorkflowEventsNewEvents)
+	return s.ExecutionStore.ConflictResolveWorkflowExecution(ctx, &req)
+}
+
+func (s *executionStore) SetWorkflowExecution(ctx context.Context, request *persistence.InternalSetWorkflowExecutionRequest) error {
+	req := *request
+	req.SetWorkflowSnapshot = s.encryptSnapshot(request.SetWorkflowSnapshot)
+	return s.ExecutionStore.SetWorkflowExecution(ctx, &req)
+}
+
+func (s *executionStore) GetWorkflowExecution(ctx context.Context, request *persistence.GetWorkflowExecutionRequest) (*persistence.InternalGetWorkflowExecutionResponse, error) {
+	resp, err := s.ExecutionStore.GetWorkflowExecution(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptMutableState(resp.State); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *executionStore) ListConcreteExecutions(ctx context.Context, request *persistence.ListConcreteExecutionsRequest) (*persistence.InternalListConcreteExecutionsResponse, error) {
+	resp, err := s.ExecutionStore.ListConcreteExecutions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range resp.States {
+		if err := s.decryptMutableState(state); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *executionStore) AppendHistoryNodes(ctx context.Context, request *persistence.InternalAppendHistoryNodesRequest) error {
+	return s.ExecutionStore.AppendHistoryNodes(ctx, s.encryptNode(request))
+}
+
+func (s *executionStore) ReadHistoryBranch(ctx context.Context, request *persistence.InternalReadHistoryBranchRequest) (*persistence.InternalReadHistoryBranchResponse, error) {
+	resp, err := s.ExecutionStore.ReadHistoryBranch(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.Nodes {
+		if resp.Nodes[i].Events, err = s.decryptBlob(resp.Nodes[i].Events); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *executionStore) encryptSnapshot(snapshot persistence.InternalWorkflowSnapshot) persistence.InternalWorkflowSnapshot {
+	snapshot.ExecutionInfoBlob = s.encryptBlob(snapshot.ExecutionInfoBlob)
+	snapshot.ActivityInfos = encryptBlobs(s, snapshot.ActivityInfos)
+	snapshot.TimerInfos = encryptBlobs(s, snapshot.TimerInfos)
+	snapshot.ChildExecutionInfos = encryptBlobs(s, snapshot.ChildExecutionInfos)
+	snapshot.RequestCancelInfos = encryptBlobs(s, snapshot.RequestCancelInfos)
+	snapshot.SignalInfos = encryptBlobs(s, snapshot.SignalInfos)
+	return snapshot
+}
+
+func (s *executionStore) encryptMutation(mutation persistence.InternalWorkflowMutation) persistence.InternalWorkflowMutation {
+	mutation.ExecutionInfoBlob = s.encryptBlob(mutation.ExecutionInfoBlob)
+	mutation.UpsertActivityInfos = encryptBlobs(s, mutation.UpsertActivityInfos)
+	mutation.UpsertTimerInfos = encryptBlobs(s, mutation.UpsertTimerInfos)
+	mutation.UpsertChildExecutionInfos = encryptBlobs(s, mutation.UpsertChildExecutionInfos)
+	mutation.UpsertRequestCancelInfos = encryptBlobs(s, mutation.UpsertRequestCancelInfos)
+	mutation.UpsertSignalInfos = encryptBlobs(s, mutation.UpsertSignalInfos)
+	mutation.NewBufferedEvents = s.encryptBlob(mutation.NewBufferedEvents)
+	return mutation
+}
+
+func (s *executionStore) decryptMutableState(state *persistence.InternalWorkflowMutableState) error {
+	var err error
+	if state.ExecutionInfo, err = s.decryptBlob(state.ExecutionInfo); err != nil {
+		return err
+	}
+	if err := decryptBlobs(s, state.ActivityInfos); err != nil {
+		return err
+	}
+	if err := decryptBlobs(s, state.TimerInfos); err != nil {
+		return err
+	}
+	if err := decryptBlobs(s, state.ChildExecutionInfos); err != nil {
+		return err
+	}
+	if err := decryptBlobs(s, state.RequestCancelInfos); err != nil {
+		return err
+	}
+	if err := decryptBlobs(s, state.SignalInfos); err != nil {
+		return err
+	}
+	for i, blob := range state.BufferedEvents {
+		if state.BufferedEvents[i], err = s.decryptBlob(blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *executionStore) encryptNodes(requests []*persistence.InternalAppendHistoryNodesRequest) []*persistence.InternalAppendHistoryNodesRequest {
+	if requests == nil {
+		return nil
+	}
+	encrypted := make([]*persistence.InternalAppendHistoryNodesRequest, len(requests))
+	for i, request := range requests {
+		encrypted[i] = s.encryptNode(request)
+	}
+	return encrypted
+}
+
+func (s *executionStore) encryptNode(request *persistence.InternalAppendHistoryNodesRequest) *persistence.InternalAppendHistoryNodesRequest {
+	req := *request
+	req.Node.Events = s.encryptBlob(request.Node.Events)
+	return &req
+}
+
+// encryptBlob returns an encrypted copy of blob, leaving the original untouched
+// since callers may still hold on to it.
+func (s *executionStore) encryptBlob(blob *commonpb.DataBlob) *commonpb.DataBlob {
+	if blob == nil {
+		return nil
+	}
+	return &commonpb.DataBlob{EncodingType: blob.EncodingType, Data: s.cipher.Encrypt(blob.Data)}
+}
+
+func (s *executionStore) decryptBlob(blob *commonpb.DataBlob) (*commonpb.DataBlob, error) {
+	if blob == nil {
+		return nil, nil
+	}
+	data, err := s.cipher.Decrypt(blob.Data)
+	if err != nil {
+		return nil, serviceerror.NewInternal(fmt.Sprintf("unable to decrypt workflow data: %v", err))
+	}
+	blob.Data = data
+	return blob, nil
+}
+
+func encryptBlobs[K comparable](s *executionStore, blobs map[K]*commonpb.DataBlob) map[K]*commonpb.DataBlob {
+	if blobs == nil {
+		return nil
+	}
+	encrypted := make(map[K]*commonpb.DataBlob, len(blobs))
+	for k, blob := range blobs {
+		encrypted[k] = s.encryptBlob(blob)
+	}
+	return encrypted
+}
+
+func decryptBlobs[K comparable](s *executionStore, blobs map[K]*commonpb.DataBlob) error {
+	for k, blob := range blobs {
+		decrypted, err := s.decryptBlob(blob)
+		if err != nil {
+			return err
+		}
+		blobs[k] = decrypted
+	}
+	return nil
+}
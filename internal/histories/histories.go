@@ -0,0 +1,466 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package histories imports workflow histories exported from any cluster into a
+// Temporalite database file that no server is using.
+package histories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	enumsspb "go.temporal.io/server/api/enums/v1"
+	persistencespb "go.temporal.io/server/api/persistence/v1"
+	"go.temporal.io/server/common"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/definition"
+	"go.temporal.io/server/common/dynamicconfig"
+	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/metrics"
+	"go.temporal.io/server/common/persistence"
+	"go.temporal.io/server/common/persistence/client"
+	"go.temporal.io/server/common/persistence/serialization"
+	persistencesql "go.temporal.io/server/common/persistence/sql"
+	"go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
+	"go.temporal.io/server/common/persistence/versionhistory"
+	"go.temporal.io/server/common/primitives"
+	"go.temporal.io/server/common/primitives/timestamp"
+	"go.temporal.io/server/common/resolver"
+	"go.temporal.io/server/service/history/tasks"
+
+	"github.com/temporalio/temporalite/internal/encryption"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+const (
+	// rangeSizeBits is the number of bits of the task IDs a history shard allocates per
+	// range, as configured by the history service.
+	rangeSizeBits = 20
+	// emptyUUID is the request ID of runs without a workflow task, as set by the history
+	// service.
+	emptyUUID = "emptyUuid"
+)
+
+// Store writes imported workflow runs into a database file.
+//
+// Servers cache shards and workflow state, callers must make sure no server uses the
+// file, eg. by holding its lock.
+type Store struct {
+	factory    client.DataStoreFactory
+	metadata   persistence.MetadataManager
+	shards     persistence.ShardManager
+	executions persistence.ExecutionManager
+}
+
+// Open opens the database file at path, cipher must be the one the server uses if
+// the file is encrypted and nil otherwise.
+func Open(path string, cipher *encryption.Cipher) (*Store, error) {
+	if cipher != nil {
+		if err := encryption.CheckDatabase(path, cipher); err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", path, err)
+		}
+	} else if encrypted, err := encryption.IsEncrypted(path); err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	} else if encrypted {
+		return nil, fmt.Errorf("error opening %s: %w", path, encryption.ErrKeyRequired)
+	}
+
+	cfg := config.SQL{
+		PluginName:        sqlite.PluginName,
+		DatabaseName:      path,
+		ConnectAttributes: map[string]string{"mode": "rw"},
+	}
+	var factory client.DataStoreFactory
+	if cipher != nil {
+		factory = encryption.NewDataStoreFactory(cfg, cipher).NewFactory(config.CustomDatastoreConfig{}, resolver.NewNoopResolver(), liteconfig.ClusterName, log.NewNoopLogger(), metrics.NoopMetricsHandler)
+	} else {
+		factory = persistencesql.NewFactory(cfg, resolver.NewNoopResolver(), liteconfig.ClusterName, log.NewNoopLogger())
+	}
+	store, err := newStore(factory)
+	if err != nil {
+		factory.Close()
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	return store, nil
+}
+
+func newStore(factory client.DataStoreFactory) (*Store, error) {
+	serializer := serialization.NewSerializer()
+	metadataStore, err := factory.NewMetadataStore()
+	if err != nil {
+		return nil, err
+	}
+	shardStore, err := factory.NewShardStore()
+	if err != nil {
+		return nil, err
+	}
+	executionStore, err := factory.NewExecutionStore()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		factory:    factory,
+		metadata:   persistence.NewMetadataManagerImpl(metadataStore, serializer, log.NewNoopLogger(), liteconfig.ClusterName),
+		shards:     persistence.NewShardManager(shardStore, serializer),
+		executions: persistence.NewExecutionManager(executionStore, serializer, log.NewNoopLogger(), dynamicconfig.GetIntPropertyFn(common.DefaultTransactionSizeLimit)),
+	}, nil
+}
+
+// Close closes the database file.
+func (s *Store) Close() {
+	s.factory.Close()
+}
+
+// Import records the closed workflow run of events in the named namespace, as run
+// execution.RunId of workflow execution.WorkflowId.
+//
+// The history is stored as is, along with the state the server would hold for the
+// closed run. The next server using the file records the run in visibility, and
+// deletes it once the namespace retention has passed since the import.
+func (s *Store) Import(ctx context.Context, namespace string, execution *commonpb.WorkflowExecution, events []*historypb.HistoryEvent) error {
+	if err := Check(events); err != nil {
+		return err
+	}
+	ns, err := s.metadata.GetNamespace(ctx, &persistence.GetNamespaceRequest{Name: namespace})
+	if err != nil {
+		return err
+	}
+	namespaceID := ns.Namespace.GetInfo().GetId()
+
+	shardID := common.WorkflowIDToHistoryShard(namespaceID, execution.GetWorkflowId(), liteconfig.NumHistoryShards)
+	rangeID, err := s.renewRange(ctx, shardID)
+	if err != nil {
+		return err
+	}
+	nextTaskID := rangeID << rangeSizeBits
+	newTaskID := func() int64 {
+		nextTaskID++
+		return nextTaskID - 1
+	}
+
+	branchToken, err := persistence.NewHistoryBranchToken(execution.GetRunId(), primitives.NewUUID().String(), nil)
+	if err != nil {
+		return err
+	}
+	r := newRun(namespaceID, execution, branchToken, events)
+	var (
+		prevTxnID int64
+		batches   []*persistence.WorkflowEvents
+	)
+	for _, batch := range splitBatches(events) {
+		txnID := newTaskID()
+		batches = append(batches, &persistence.WorkflowEvents{
+			NamespaceID: namespaceID,
+			WorkflowID:  execution.GetWorkflowId(),
+			RunID:       execution.GetRunId(),
+			BranchToken: branchToken,
+			PrevTxnID:   prevTxnID,
+			TxnID:       txnID,
+			Events:      batch,
+		})
+		r.info.LastFirstEventId = batch[0].GetEventId()
+		r.info.LastFirstEventTxnId = txnID
+		r.info.LastEventTaskId = txnID
+		r.info.StateTransitionCount++
+		prevTxnID = txnID
+	}
+	r.info.CompletionEventBatchId = r.info.LastFirstEventId
+
+	// The tasks the server would have added on closing the run, but for the transfer
+	// task notifying the parent, which belongs to another cluster.
+	key := definition.NewWorkflowKey(namespaceID, execution.GetWorkflowId(), execution.GetRunId())
+	now := time.Now().UTC()
+	visibilityTask := &tasks.CloseExecutionVisibilityTask{
+		WorkflowKey:         key,
+		VisibilityTimestamp: now,
+		TaskID:              newTaskID(),
+		Version:             r.lastWriteVersion,
+	}
+	deleteTask := &tasks.DeleteHistoryEventTask{
+		WorkflowKey:         key,
+		VisibilityTimestamp: now.Add(timestamp.DurationValue(ns.Namespace.GetConfig().GetRetention())),
+		TaskID:              newTaskID(),
+		Version:             r.lastWriteVersion,
+		BranchToken:         branchToken,
+	}
+	r.info.CloseVisibilityTaskId = visibilityTask.TaskID
+
+	_, err = s.executions.CreateWorkflowExecution(ctx, &persistence.CreateWorkflowExecutionRequest{
+		ShardID: shardID,
+		RangeID: rangeID,
+		Mode:    persistence.CreateWorkflowModeBrandNew,
+		NewWorkflowSnapshot: persistence.WorkflowSnapshot{
+			ExecutionInfo:  r.info,
+			ExecutionState: r.state,
+			NextEventID:    events[len(events)-1].GetEventId() + 1,
+			Tasks: map[tasks.Category][]tasks.Task{
+				tasks.CategoryVisibility: {visibilityTask},
+				tasks.CategoryTimer:      {deleteTask},
+			},
+			DBRecordVersion: 1,
+		},
+		NewWorkflowEvents: batches,
+	})
+	var currentErr *persistence.CurrentWorkflowConditionFailedError
+	if errors.As(err, &currentErr) {
+		return fmt.Errorf("workflow %q already exists", execution.GetWorkflowId())
+	}
+	return err
+}
+
+// renewRange takes a new task ID range of the shard, as a server does when it starts
+// owning the shard, and returns it.
+//
+// Task IDs of the range are above those of the servers that used the shard before,
+// and below those of the next one.
+func (s *Store) renewRange(ctx context.Context, shardID int32) (int64, error) {
+	resp, err := s.shards.GetOrCreateShard(ctx, &persistence.GetOrCreateShardRequest{ShardID: shardID})
+	if err != nil {
+		return 0, err
+	}
+	info := resp.ShardInfo
+	previousRangeID := info.GetRangeId()
+	info.RangeId++
+	if err := s.shards.UpdateShard(ctx, &persistence.UpdateShardRequest{ShardInfo: info, PreviousRangeID: previousRangeID}); err != nil {
+		return 0, err
+	}
+	return info.GetRangeId(), nil
+}
+
+// Check returns an error if events isn't the complete history of a closed workflow run.
+func Check(events []*historypb.HistoryEvent) error {
+	if len(events) == 0 {
+		return errors.New("history is empty")
+	}
+	if t := events[0].GetEventType(); t != enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED {
+		return fmt.Errorf("history starts with %s instead of WorkflowExecutionStarted", t)
+	}
+	for i, event := range events {
+		if event.GetEventId() != int64(i)+common.FirstEventID {
+			return fmt.Errorf("history is missing events, event %d is found at position %d", event.GetEventId(), i+1)
+		}
+	}
+	if t := events[len(events)-1].GetEventType(); closeStatus(t) == enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED {
+		return fmt.Errorf("only histories of closed workflows can be imported, this one ends with %s", t)
+	}
+	return nil
+}
+
+// closeStatus returns the status of workflows closed by an event of type t, or
+// WORKFLOW_EXECUTION_STATUS_UNSPECIFIED if t doesn't close workflows.
+func closeStatus(t enumspb.EventType) enumspb.WorkflowExecutionStatus {
+	switch t {
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_FAILED
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_TIMED_OUT
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_CANCELED
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED
+	case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_CONTINUED_AS_NEW
+	default:
+		return enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED
+	}
+}
+
+// commandEvents are the types of events recorded for the commands of a workflow task,
+// in the same transaction as its completion.
+var commandEvents = map[enumspb.EventType]bool{
+	enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:                              true,
+	enumspb.EVENT_TYPE_ACTIVITY_TASK_CANCEL_REQUESTED:                       true,
+	enumspb.EVENT_TYPE_TIMER_STARTED:                                        true,
+	enumspb.EVENT_TYPE_TIMER_CANCELED:                                       true,
+	enumspb.EVENT_TYPE_MARKER_RECORDED:                                      true,
+	enumspb.EVENT_TYPE_UPSERT_WORKFLOW_SEARCH_ATTRIBUTES:                    true,
+	enumspb.EVENT_TYPE_WORKFLOW_PROPERTIES_MODIFIED:                         true,
+	enumspb.EVENT_TYPE_START_CHILD_WORKFLOW_EXECUTION_INITIATED:             true,
+	enumspb.EVENT_TYPE_SIGNAL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED:         true,
+	enumspb.EVENT_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED: true,
+	enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED:                         true,
+	enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:                            true,
+	enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED:                          true,
+	enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW:                  true,
+}
+
+// splitBatches splits events into the transactions the server would have written them
+// in, which histories don't record: command events are written with the completion of
+// their workflow task, and workflow tasks are scheduled with the event causing them.
+//
+// Batches only matter to the server for paging through histories.
+func splitBatches(events []*historypb.HistoryEvent) [][]*historypb.HistoryEvent {
+	var (
+		batches    [][]*historypb.HistoryEvent
+		inCommands bool
+	)
+	for i, event := range events {
+		t := event.GetEventType()
+		joins := i > 0 && event.GetVersion() == events[i-1].GetVersion() &&
+			(t == enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED || inCommands && commandEvents[t])
+		if joins {
+			batches[len(batches)-1] = append(batches[len(batches)-1], event)
+		} else {
+			batches = append(batches, []*historypb.HistoryEvent{event})
+		}
+		inCommands = t == enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED || inCommands && commandEvents[t]
+	}
+	return batches
+}
+
+// run is the state of a closed workflow run.
+type run struct {
+	info             *persistencespb.WorkflowExecutionInfo
+	state            *persistencespb.WorkflowExecutionState
+	lastWriteVersion int64
+}
+
+// newRun returns the state of the closed run of events, but for the fields set from
+// the batches its events are written in.
+//
+// Fields are set the way the server's mutable state sets them on recording the events.
+func newRun(namespaceID string, execution *commonpb.WorkflowExecution, branchToken []byte, events []*historypb.HistoryEvent) *run {
+	startEvent, closeEvent := events[0], events[len(events)-1]
+	started := startEvent.GetWorkflowExecutionStartedEventAttributes()
+	startTime := timestamp.TimeValue(startEvent.GetEventTime())
+
+	info := &persistencespb.WorkflowExecutionInfo{
+		NamespaceId:                    namespaceID,
+		WorkflowId:                     execution.GetWorkflowId(),
+		FirstExecutionRunId:            started.GetFirstExecutionRunId(),
+		TaskQueue:                      started.GetTaskQueue().GetName(),
+		WorkflowTypeName:               started.GetWorkflowType().GetName(),
+		WorkflowRunTimeout:             started.GetWorkflowRunTimeout(),
+		WorkflowExecutionTimeout:       started.GetWorkflowExecutionTimeout(),
+		DefaultWorkflowTaskTimeout:     started.GetWorkflowTaskTimeout(),
+		LastWorkflowTaskStartedEventId: common.EmptyEventID,
+		StartTime:                      &startTime,
+		LastUpdateTime:                 closeEvent.GetEventTime(),
+		CloseTime:                      closeEvent.GetEventTime(),
+		WorkflowTaskVersion:            common.EmptyVersion,
+		WorkflowTaskScheduledEventId:   common.EmptyEventID,
+		WorkflowTaskStartedEventId:     common.EmptyEventID,
+		WorkflowTaskRequestId:          emptyUUID,
+		WorkflowTaskTimeout:            new(time.Duration),
+		WorkflowTaskAttempt:            1,
+		CronSchedule:                   started.GetCronSchedule(),
+		ParentInitiatedId:              common.EmptyEventID,
+		ParentInitiatedVersion:         common.EmptyVersion,
+		ExecutionTime:                  timestamp.TimePtr(startTime.Add(timestamp.DurationValue(started.GetFirstWorkflowTaskBackoff()))),
+		Attempt:                        started.GetAttempt(),
+		Memo:                           map[string]*commonpb.Payload{},
+		SearchAttributes:               map[string]*commonpb.Payload{},
+		ExecutionStats:                 &persistencespb.ExecutionStats{},
+		AutoResetPoints:                started.GetPrevAutoResetPoints(),
+	}
+	if info.FirstExecutionRunId == "" {
+		info.FirstExecutionRunId = execution.GetRunId()
+	}
+	if parent := started.GetParentWorkflowExecution(); parent != nil {
+		info.ParentNamespaceId = started.GetParentWorkflowNamespaceId()
+		info.ParentWorkflowId = parent.GetWorkflowId()
+		info.ParentRunId = parent.GetRunId()
+	}
+	if id := started.GetParentInitiatedEventId(); id != 0 {
+		info.ParentInitiatedId = id
+	}
+	if version := started.GetParentInitiatedEventVersion(); version != 0 {
+		info.ParentInitiatedVersion = version
+	}
+	if !timestamp.TimeValue(started.GetWorkflowExecutionExpirationTime()).IsZero() {
+		info.WorkflowExecutionExpirationTime = started.GetWorkflowExecutionExpirationTime()
+	}
+	var runExpiration time.Time
+	if runTimeout := timestamp.DurationValue(info.WorkflowRunTimeout); runTimeout != 0 {
+		runExpiration = startTime.Add(runTimeout + timestamp.DurationValue(started.GetFirstWorkflowTaskBackoff()))
+		if executionExpiration := timestamp.TimeValue(info.WorkflowExecutionExpirationTime); !executionExpiration.IsZero() && runExpiration.After(executionExpiration) {
+			runExpiration = executionExpiration
+		}
+	}
+	info.WorkflowRunExpirationTime = &runExpiration
+	if policy := started.GetRetryPolicy(); policy != nil {
+		info.HasRetryPolicy = true
+		info.RetryBackoffCoefficient = policy.GetBackoffCoefficient()
+		info.RetryInitialInterval = policy.GetInitialInterval()
+		info.RetryMaximumAttempts = policy.GetMaximumAttempts()
+		info.RetryMaximumInterval = policy.GetMaximumInterval()
+		info.RetryNonRetryableErrorTypes = policy.GetNonRetryableErrorTypes()
+	}
+	for k, v := range started.GetMemo().GetFields() {
+		info.Memo[k] = v
+	}
+	for k, v := range started.GetSearchAttributes().GetIndexedFields() {
+		info.SearchAttributes[k] = v
+	}
+
+	versionHistory := versionhistory.NewVersionHistory(branchToken, nil)
+	for _, event := range events {
+		// Event IDs are checked to increase, which is all the update requires.
+		_ = versionhistory.AddOrUpdateVersionHistoryItem(versionHistory, versionhistory.NewVersionHistoryItem(event.GetEventId(), event.GetVersion()))
+
+		switch attrs := event.GetAttributes().(type) {
+		case *historypb.HistoryEvent_WorkflowTaskCompletedEventAttributes:
+			info.LastWorkflowTaskStartedEventId = attrs.WorkflowTaskCompletedEventAttributes.GetStartedEventId()
+		case *historypb.HistoryEvent_WorkflowExecutionSignaledEventAttributes:
+			info.SignalCount++
+		case *historypb.HistoryEvent_WorkflowExecutionCancelRequestedEventAttributes:
+			info.CancelRequested = true
+		case *historypb.HistoryEvent_UpsertWorkflowSearchAttributesEventAttributes:
+			for k, v := range attrs.UpsertWorkflowSearchAttributesEventAttributes.GetSearchAttributes().GetIndexedFields() {
+				info.SearchAttributes[k] = v
+			}
+		case *historypb.HistoryEvent_WorkflowPropertiesModifiedEventAttributes:
+			for k, v := range attrs.WorkflowPropertiesModifiedEventAttributes.GetUpsertedMemo().GetFields() {
+				info.Memo[k] = v
+			}
+		case *historypb.HistoryEvent_WorkflowExecutionCompletedEventAttributes:
+			info.NewExecutionRunId = attrs.WorkflowExecutionCompletedEventAttributes.GetNewExecutionRunId()
+		case *historypb.HistoryEvent_WorkflowExecutionFailedEventAttributes:
+			info.NewExecutionRunId = attrs.WorkflowExecutionFailedEventAttributes.GetNewExecutionRunId()
+		case *historypb.HistoryEvent_WorkflowExecutionTimedOutEventAttributes:
+			info.NewExecutionRunId = attrs.WorkflowExecutionTimedOutEventAttributes.GetNewExecutionRunId()
+		case *historypb.HistoryEvent_WorkflowExecutionContinuedAsNewEventAttributes:
+			info.NewExecutionRunId = attrs.WorkflowExecutionContinuedAsNewEventAttributes.GetNewExecutionRunId()
+		}
+	}
+	info.VersionHistories = versionhistory.NewVersionHistories(versionHistory)
+
+	return &run{
+		info: info,
+		state: &persistencespb.WorkflowExecutionState{
+			CreateRequestId: primitives.NewUUID().String(),
+			RunId:           execution.GetRunId(),
+			State:           enumsspb.WORKFLOW_EXECUTION_STATE_COMPLETED,
+			Status:          closeStatus(closeEvent.GetEventType()),
+		},
+		lastWriteVersion: closeEvent.GetVersion(),
+	}
+}
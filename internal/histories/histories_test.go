@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package histories
+
+import (
+	"strings"
+	"testing"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+)
+
+func newEvents(types ...enumspb.EventType) []*historypb.HistoryEvent {
+	events := make([]*historypb.HistoryEvent, len(types))
+	for i, t := range types {
+		events[i] = &historypb.HistoryEvent{EventId: int64(i) + 1, EventType: t}
+	}
+	return events
+}
+
+func TestSplitBatches(t *testing.T) {
+	events := newEvents(
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_TIMER_STARTED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_STARTED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_TIMER_CANCELED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+	)
+	var firstEventIDs []int64
+	for _, batch := range splitBatches(events) {
+		firstEventIDs = append(firstEventIDs, batch[0].GetEventId())
+	}
+	expected := []int64{1, 3, 4, 7, 8, 10, 11}
+	if len(firstEventIDs) != len(expected) {
+		t.Fatalf("expected batches starting at %v, got %v", expected, firstEventIDs)
+	}
+	for i := range expected {
+		if firstEventIDs[i] != expected[i] {
+			t.Fatalf("expected batches starting at %v, got %v", expected, firstEventIDs)
+		}
+	}
+
+	// Events of different versions are never written together.
+	events[1].Version = 1
+	if batches := splitBatches(events[:2]); len(batches) != 2 {
+		t.Errorf("expected events of different versions in separate batches, got %v", batches)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		events      []*historypb.HistoryEvent
+		expectedErr string
+	}{
+		{
+			name:        "empty",
+			expectedErr: "empty",
+		},
+		{
+			name:        "not started",
+			events:      newEvents(enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED),
+			expectedErr: "instead of WorkflowExecutionStarted",
+		},
+		{
+			name:        "running",
+			events:      newEvents(enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED, enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED),
+			expectedErr: "closed workflows",
+		},
+		{
+			name: "missing events",
+			events: []*historypb.HistoryEvent{
+				{EventId: 1, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED},
+				{EventId: 3, EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED},
+			},
+			expectedErr: "missing events",
+		},
+		{
+			name: "timed out",
+			events: newEvents(
+				enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT,
+				enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT,
+			),
+		},
+		{
+			name: "continued as new",
+			events: newEvents(
+				enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+				enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+				enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW,
+			),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(tc.events)
+			if tc.expectedErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if tc.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectedErr)) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
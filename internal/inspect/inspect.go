@@ -0,0 +1,405 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package inspect reads a Temporalite SQLite database file without starting a server.
+package inspect
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/server/common/persistence"
+	"go.temporal.io/server/common/persistence/serialization"
+	"go.temporal.io/server/common/primitives"
+	"go.temporal.io/server/schema/sqlite"
+
+	// Load the pure-Go SQLite driver used by the Temporal server
+	_ "modernc.org/sqlite"
+)
+
+// DefaultLargestHistories is the number of histories listed in a Report when unspecified.
+const DefaultLargestHistories = 5
+
+// requiredTables must be present for a file to be recognized as a Temporalite database.
+var requiredTables = []string{
+	"namespaces",
+	"shards",
+	"executions",
+	"current_executions",
+	"history_node",
+	"history_tree",
+	"cluster_metadata_info",
+	"executions_visibility",
+}
+
+// Report summarizes the content of a Temporalite database file.
+//
+// Temporalite databases don't record their schema version: SupportedSchemaVersion and
+// SupportedVisibilitySchemaVersion are the versions of the schema this binary creates and
+// supports, like the version command reports, not the versions of the file.
+type Report struct {
+	Path                             string          `json:"path"`
+	FileSize                         int64           `json:"file_size"`
+	SupportedSchemaVersion           string          `json:"supported_schema_version"`
+	SupportedVisibilitySchemaVersion string          `json:"supported_visibility_schema_version"`
+	ShardCount                       int             `json:"shard_count"`
+	Clusters                         []Cluster       `json:"clusters"`
+	Namespaces                       []Namespace     `json:"namespaces"`
+	Executions                       ExecutionCounts `json:"executions"`
+	LargestHistories                 []History       `json:"largest_histories"`
+	Tables                           []Table         `json:"tables"`
+}
+
+// Cluster is the cluster metadata persisted by the server on first start.
+type Cluster struct {
+	Name              string `json:"name"`
+	ID                string `json:"id"`
+	HistoryShardCount int32  `json:"history_shard_count"`
+	ServerVersion     string `json:"server_version,omitempty"`
+}
+
+// Namespace describes a registered namespace.
+type Namespace struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Retention string `json:"retention"`
+	IsGlobal  bool   `json:"is_global"`
+}
+
+// ExecutionCounts holds the number of workflow executions known to visibility.
+type ExecutionCounts struct {
+	Open   int `json:"open"`
+	Closed int `json:"closed"`
+}
+
+// History describes the persisted event history of a single workflow run.
+type History struct {
+	Namespace  string `json:"namespace"`
+	WorkflowID string `json:"workflow_id"`
+	RunID      string `json:"run_id"`
+	TreeID     string `json:"tree_id"`
+	Batches    int    `json:"batches"`
+	Size       int64  `json:"size"`
+}
+
+// Table holds the row count and, when available, on-disk size of a table.
+type Table struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	Size int64  `json:"size"`
+}
+
+// Inspect opens the database file at path in read-only mode and builds a Report.
+//
+// At most largestHistories entries are included in Report.LargestHistories.
+func Inspect(ctx context.Context, path string, largestHistories int) (*Report, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	r := &Report{
+		Path:     path,
+		FileSize: info.Size(),
+	}
+	if r.Tables, err = tables(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := checkSchema(r.Tables); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.SupportedSchemaVersion = sqlite.Version
+	r.SupportedVisibilitySchemaVersion = sqlite.VisibilityVersion
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM shards").Scan(&r.ShardCount); err != nil {
+		return nil, fmt.Errorf("error counting shards: %w", err)
+	}
+	if r.Clusters, err = clusters(ctx, db); err != nil {
+		return nil, err
+	}
+	if r.Namespaces, err = namespaces(ctx, db); err != nil {
+		return nil, err
+	}
+	if r.Executions, err = executionCounts(ctx, db); err != nil {
+		return nil, err
+	}
+	if r.LargestHistories, err = histories(ctx, db, r.Namespaces, largestHistories); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Open returns a read-only connection to the SQLite database file at path.
+func Open(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?%s", path, url.Values{"mode": {"ro"}}.Encode())
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func checkSchema(tables []Table) error {
+	found := make(map[string]struct{}, len(tables))
+	for _, t := range tables {
+		found[t.Name] = struct{}{}
+	}
+	for _, name := range requiredTables {
+		if _, ok := found[name]; !ok {
+			return fmt.Errorf("not a Temporalite database: missing table %q", name)
+		}
+	}
+	return nil
+}
+
+func tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+	var result []Table
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sizes := tableSizes(ctx, db)
+	for i := range result {
+		// Table names come from sqlite_master, so quoting them is sufficient here.
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %q", result[i].Name)
+		if err := db.QueryRowContext(ctx, query).Scan(&result[i].Rows); err != nil {
+			return nil, fmt.Errorf("error counting rows in %q: %w", result[i].Name, err)
+		}
+		result[i].Size = sizes[result[i].Name]
+	}
+	return result, nil
+}
+
+// tableSizes returns the number of bytes used by each table and its indexes.
+//
+// Sizes are best effort: an empty map is returned when the dbstat virtual table is unavailable.
+func tableSizes(ctx context.Context, db *sql.DB) map[string]int64 {
+	sizes := make(map[string]int64)
+	rows, err := db.QueryContext(ctx, `
+		SELECT COALESCE(m.tbl_name, s.name), SUM(s.pgsize)
+		FROM dbstat s LEFT JOIN sqlite_master m ON m.name = s.name
+		GROUP BY 1`)
+	if err != nil {
+		return sizes
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			name string
+			size int64
+		)
+		if err := rows.Scan(&name, &size); err != nil {
+			return sizes
+		}
+		sizes[name] = size
+	}
+	return sizes
+}
+
+func clusters(ctx context.Context, db *sql.DB) ([]Cluster, error) {
+	rows, err := db.QueryContext(ctx, "SELECT data, data_encoding FROM cluster_metadata_info ORDER BY cluster_name")
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster metadata: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	serializer := serialization.NewSerializer()
+	var result []Cluster
+	for rows.Next() {
+		var (
+			data     []byte
+			encoding string
+		)
+		if err := rows.Scan(&data, &encoding); err != nil {
+			return nil, err
+		}
+		cm, err := serializer.DeserializeClusterMetadata(persistence.NewDataBlob(data, encoding))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding cluster metadata: %w", err)
+		}
+		result = append(result, Cluster{
+			Name:              cm.GetClusterName(),
+			ID:                cm.GetClusterId(),
+			HistoryShardCount: cm.GetHistoryShardCount(),
+			ServerVersion:     cm.GetVersionInfo().GetCurrent().GetVersion(),
+		})
+	}
+	return result, rows.Err()
+}
+
+func namespaces(ctx context.Context, db *sql.DB) ([]Namespace, error) {
+	rows, err := db.QueryContext(ctx, "SELECT data, data_encoding, is_global FROM namespaces ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("error reading namespaces: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	serializer := serialization.NewSerializer()
+	var result []Namespace
+	for rows.Next() {
+		var (
+			data     []byte
+			encoding string
+			isGlobal bool
+		)
+		if err := rows.Scan(&data, &encoding, &isGlobal); err != nil {
+			return nil, err
+		}
+		detail, err := serializer.NamespaceDetailFromBlob(persistence.NewDataBlob(data, encoding))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding namespace: %w", err)
+		}
+		ns := Namespace{
+			ID:       detail.GetInfo().GetId(),
+			Name:     detail.GetInfo().GetName(),
+			State:    detail.GetInfo().GetState().String(),
+			IsGlobal: isGlobal,
+		}
+		if retention := detail.GetConfig().GetRetention(); retention != nil {
+			ns.Retention = retention.String()
+		}
+		result = append(result, ns)
+	}
+	return result, rows.Err()
+}
+
+func executionCounts(ctx context.Context, db *sql.DB) (ExecutionCounts, error) {
+	var counts ExecutionCounts
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(CASE WHEN status = ? THEN 1 END), COUNT(CASE WHEN status != ? THEN 1 END) FROM executions_visibility",
+		int32(enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING), int32(enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING),
+	).Scan(&counts.Open, &counts.Closed)
+	if err != nil {
+		return counts, fmt.Errorf("error counting executions: %w", err)
+	}
+	return counts, nil
+}
+
+func histories(ctx context.Context, db *sql.DB, namespaces []Namespace, limit int) ([]History, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.tree_id, COUNT(*), SUM(LENGTH(n.data)), t.data, t.data_encoding
+		FROM history_node n LEFT JOIN history_tree t ON t.tree_id = n.tree_id AND t.branch_id = n.branch_id
+		GROUP BY n.tree_id
+		ORDER BY 3 DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading histories: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	names := make(map[string]string, len(namespaces))
+	for _, ns := range namespaces {
+		names[ns.ID] = ns.Name
+	}
+
+	serializer := serialization.NewSerializer()
+	var result []History
+	for rows.Next() {
+		var (
+			treeID   []byte
+			h        History
+			data     []byte
+			encoding sql.NullString
+		)
+		if err := rows.Scan(&treeID, &h.Batches, &h.Size, &data, &encoding); err != nil {
+			return nil, err
+		}
+		h.TreeID = hex.EncodeToString(treeID)
+		if len(treeID) == 16 {
+			h.TreeID = primitives.UUID(treeID).String()
+		}
+		if encoding.Valid {
+			if err := describeTree(serializer, data, encoding.String, names, &h); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Size > result[j].Size
+	})
+	return result, nil
+}
+
+// describeTree fills in the workflow identity of a history using the tree info blob,
+// which the server writes for debugging and garbage collection purposes.
+func describeTree(serializer serialization.Serializer, data []byte, encoding string, names map[string]string, h *History) error {
+	info, err := serializer.HistoryTreeInfoFromBlob(persistence.NewDataBlob(data, encoding))
+	if err != nil {
+		return fmt.Errorf("error decoding history tree %s: %w", h.TreeID, err)
+	}
+	namespaceID, workflowID, runID, err := persistence.SplitHistoryGarbageCleanupInfo(info.GetInfo())
+	if err != nil {
+		// Histories without identity information are still worth reporting.
+		return nil
+	}
+	h.Namespace = namespaceID
+	if name, ok := names[namespaceID]; ok {
+		h.Namespace = name
+	}
+	h.WorkflowID = workflowID
+	h.RunID = runID
+	return nil
+}
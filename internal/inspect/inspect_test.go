@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package inspect
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.temporal.io/server/common/config"
+	sqliteplugin "go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
+	"go.temporal.io/server/schema/sqlite"
+)
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.db")
+	if err := sqlite.SetupSchema(&config.SQL{
+		PluginName:        sqliteplugin.PluginName,
+		DatabaseName:      path,
+		ConnectAttributes: map[string]string{"mode": "rwc"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Inspect(ctx, path, DefaultLargestHistories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SupportedSchemaVersion != sqlite.Version || r.SupportedVisibilitySchemaVersion != sqlite.VisibilityVersion {
+		t.Errorf("expected schema versions %s and %s, got %s and %s", sqlite.Version, sqlite.VisibilityVersion, r.SupportedSchemaVersion, r.SupportedVisibilitySchemaVersion)
+	}
+	if r.Path != path || r.FileSize == 0 || len(r.Tables) < len(requiredTables) {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if len(r.Namespaces) != 0 || r.Executions.Open != 0 || r.Executions.Closed != 0 || len(r.LargestHistories) != 0 {
+		t.Errorf("expected an empty database, got %+v", r)
+	}
+
+	if _, err := Inspect(ctx, dir, DefaultLargestHistories); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("expected error inspecting a directory, got %v", err)
+	}
+	other := filepath.Join(dir, "other.db")
+	db, err := sql.Open("sqlite", "file:"+other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE namespaces (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+	if _, err := Inspect(ctx, other, DefaultLargestHistories); err == nil || !strings.Contains(err.Error(), "not a Temporalite database") {
+		t.Errorf("expected error inspecting another database, got %v", err)
+	}
+}
@@ -7,9 +7,11 @@ package liteconfig
 import (
 	"fmt"
 	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"time"
 
 	"go.temporal.io/server/common/cluster"
@@ -19,13 +21,18 @@ import (
 	"go.temporal.io/server/common/metrics"
 	"go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
 	"go.temporal.io/server/temporal"
+
+	"github.com/temporalio/temporalite/internal/datadir"
 )
 
 const (
-	broadcastAddress     = "127.0.0.1"
 	PersistenceStoreName = "sqlite-default"
 	DefaultFrontendPort  = 7233
 	DefaultMetricsPort   = 0
+	ClusterName          = "active"
+	// NumHistoryShards is the number of history shards of Temporalite databases, it can't
+	// change once a database is created.
+	NumHistoryShards = 1
 )
 
 // UIServer abstracts the github.com/temporalio/ui-server project to
@@ -47,20 +54,30 @@ func (noopUIServer) Start() error {
 func (noopUIServer) Stop() {}
 
 type Config struct {
-	Ephemeral        bool
-	DatabaseFilePath string
-	FrontendPort     int
-	MetricsPort      int
-	DynamicPorts     bool
-	Namespaces       []string
-	SQLitePragmas    map[string]string
-	Logger           log.Logger
-	UpstreamOptions  []temporal.ServerOption
-	portProvider     *PortProvider
-	FrontendIP       string
-	UIServer         UIServer
-	BaseConfig       *config.Config
-	DynamicConfig    dynamicconfig.StaticClient
+	Ephemeral             bool
+	DataDir               string
+	DatabaseFilePath      string
+	DatabaseEncryptionKey []byte
+	ForceDatabaseLock     bool
+	ReadOnly              bool
+	FrontendPort          int
+	MetricsPort           int
+	HTTPPort              int
+	GRPCReflection        bool
+	DynamicPorts          bool
+	Namespaces            []string
+	SQLitePragmas         map[string]string
+	Logger                log.Logger
+	UpstreamOptions       []temporal.ServerOption
+	InterruptCh           <-chan interface{}
+	portProvider          *PortProvider
+	FrontendIP            string
+	FrontendUnixSocket    string
+	InternalIP            string
+	BroadcastAddress      string
+	UIServer              UIServer
+	BaseConfig            *config.Config
+	DynamicConfig         dynamicconfig.StaticClient
 }
 
 var SupportedPragmas = map[string]struct{}{
@@ -147,21 +164,29 @@ func Convert(cfg *Config) *config.Config {
 	}
 
 	baseConfig := cfg.BaseConfig
+	broadcastAddress := cfg.broadcastAddress()
 	baseConfig.Global.Membership = config.Membership{
 		MaxJoinDuration:  30 * time.Second,
 		BroadcastAddress: broadcastAddress,
 	}
-	baseConfig.Global.Metrics = &metrics.Config{
-		Prometheus: &metrics.PrometheusConfig{
-			ListenAddress: fmt.Sprintf("%s:%d", cfg.FrontendIP, cfg.MetricsPort),
-			HandlerPath:   "/metrics",
-		},
+	// The metrics port is served by Temporalite, which proxies /metrics to the Prometheus
+	// listener of the services. The listener configured in the base config is kept, otherwise
+	// it listens on a port chosen by the system.
+	if m := baseConfig.Global.Metrics; m == nil || m.Prometheus == nil || m.Prometheus.ListenAddress == "" {
+		baseConfig.Global.Metrics = &metrics.Config{
+			Prometheus: &metrics.PrometheusConfig{
+				ListenAddress: fmt.Sprintf("127.0.0.1:%d", cfg.portProvider.MustGetFreePort()),
+				HandlerPath:   "/metrics",
+			},
+		}
+	} else if m.Prometheus.HandlerPath == "" {
+		m.Prometheus.HandlerPath = "/metrics"
 	}
 	baseConfig.Global.PProf = config.PProf{Port: pprofPort}
 	baseConfig.Persistence = config.Persistence{
 		DefaultStore:     PersistenceStoreName,
 		VisibilityStore:  PersistenceStoreName,
-		NumHistoryShards: 1,
+		NumHistoryShards: NumHistoryShards,
 		DataStores: map[string]config.DataStore{
 			PersistenceStoreName: {SQL: &sqliteConfig},
 		},
@@ -169,13 +194,13 @@ func Convert(cfg *Config) *config.Config {
 	baseConfig.ClusterMetadata = &cluster.Config{
 		EnableGlobalNamespace:    false,
 		FailoverVersionIncrement: 10,
-		MasterClusterName:        "active",
-		CurrentClusterName:       "active",
+		MasterClusterName:        ClusterName,
+		CurrentClusterName:       ClusterName,
 		ClusterInformation: map[string]cluster.ClusterInformation{
-			"active": {
+			ClusterName: {
 				Enabled:                true,
 				InitialFailoverVersion: 1,
-				RPCAddress:             fmt.Sprintf("%s:%d", broadcastAddress, cfg.FrontendPort),
+				RPCAddress:             net.JoinHostPort(cfg.frontendAddress(), strconv.Itoa(cfg.FrontendPort)),
 			},
 		},
 	}
@@ -188,6 +213,8 @@ func Convert(cfg *Config) *config.Config {
 		"matching": cfg.mustGetService(2),
 		"worker":   cfg.mustGetService(3),
 	}
+	// Archival configured in the base config is kept as is
+	archival, archivalDefaults := baseConfig.Archival, baseConfig.NamespaceDefaults.Archival
 	baseConfig.Archival = config.Archival{
 		History: config.HistoryArchival{
 			State:      "disabled",
@@ -201,7 +228,7 @@ func Convert(cfg *Config) *config.Config {
 		},
 	}
 	baseConfig.PublicClient = config.PublicClient{
-		HostPort: fmt.Sprintf("%s:%d", broadcastAddress, cfg.FrontendPort),
+		HostPort: net.JoinHostPort(cfg.frontendAddress(), strconv.Itoa(cfg.FrontendPort)),
 	}
 	baseConfig.NamespaceDefaults = config.NamespaceDefaults{
 		Archival: config.ArchivalNamespaceDefaults{
@@ -213,6 +240,26 @@ func Convert(cfg *Config) *config.Config {
 			},
 		},
 	}
+	if archival.History.State != "" || archival.Visibility.State != "" {
+		baseConfig.Archival = archival
+		baseConfig.NamespaceDefaults.Archival = archivalDefaults
+	} else if cfg.DataDir != "" {
+		// Archival to the data directory is available to namespaces that enable it
+		dir := datadir.Dir(cfg.DataDir)
+		filestore := &config.FilestoreArchiver{FileMode: "0644", DirMode: "0755"}
+		baseConfig.Archival.History = config.HistoryArchival{
+			State:      "enabled",
+			EnableRead: true,
+			Provider:   &config.HistoryArchiverProvider{Filestore: filestore},
+		}
+		baseConfig.Archival.Visibility = config.VisibilityArchival{
+			State:      "enabled",
+			EnableRead: true,
+			Provider:   &config.VisibilityArchiverProvider{Filestore: filestore},
+		}
+		baseConfig.NamespaceDefaults.Archival.History.URI = "file://" + filepath.ToSlash(dir.HistoryArchivalDir())
+		baseConfig.NamespaceDefaults.Archival.Visibility.URI = "file://" + filepath.ToSlash(dir.VisibilityArchivalDir())
+	}
 	return baseConfig
 }
 
@@ -234,11 +281,108 @@ func (cfg *Config) mustGetService(frontendPortOffset int) config.Service {
 		svc.RPC.MembershipPort = cfg.portProvider.MustGetFreePort()
 	}
 
-	// Optionally bind frontend to IPv4 address
-	if frontendPortOffset == 0 && cfg.FrontendIP != "" {
+	internal := frontendPortOffset != 0
+	if frontendPortOffset == 0 && cfg.ProxiesFrontend() {
+		// Clients connect to the proxy on the frontend IP and port, the frontend service
+		// listens next to the other services.
+		svc.RPC.GRPCPort = cfg.portProvider.MustGetFreePort()
+		internal = true
+	} else if frontendPortOffset == 0 && cfg.FrontendIP != "" {
+		// Optionally bind frontend to an IPv4 or IPv6 address
 		svc.RPC.BindOnLocalHost = false
 		svc.RPC.BindOnIP = cfg.FrontendIP
 	}
+	if ip := cfg.internalIP(); internal && ip != "" {
+		svc.RPC.BindOnLocalHost = false
+		svc.RPC.BindOnIP = ip
+	}
 
 	return svc
 }
+
+// internalIP returns the address the history, matching and worker services bind to, or an
+// empty string for localhost.
+//
+// Unless set explicitly, they listen on the broadcast address when one is given, so that they
+// are reachable at the address they advertise. The frontend IP does not move them off
+// localhost.
+func (cfg *Config) internalIP() string {
+	if cfg.InternalIP != "" {
+		return cfg.InternalIP
+	}
+	return cfg.BroadcastAddress
+}
+
+// broadcastAddress returns the address services advertise to each other in the membership
+// ring.
+func (cfg *Config) broadcastAddress() string {
+	if cfg.BroadcastAddress != "" {
+		return cfg.BroadcastAddress
+	}
+	return specificIP(cfg.InternalIP)
+}
+
+// frontendAddress returns the address clients of the server connect to the frontend at.
+func (cfg *Config) frontendAddress() string {
+	return specificIP(cfg.FrontendIP)
+}
+
+// specificIP returns addr unless it is empty or binds to all interfaces, in which case
+// IPv4 localhost is returned. A service listening on all interfaces is reachable on IPv4
+// localhost, even when bound to the IPv6 unspecified address as Go listeners are dual-stack.
+func specificIP(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil && !ip.IsUnspecified() {
+		return ip.String()
+	}
+	return "127.0.0.1"
+}
+
+// ValidateAddresses checks that the addresses services bind to are valid and that the
+// history, matching and worker services are reachable at the broadcast address.
+func (cfg *Config) ValidateAddresses() error {
+	if net.ParseIP(bindIP(cfg.FrontendIP)) == nil {
+		return fmt.Errorf("invalid IP %q for the frontend service", cfg.FrontendIP)
+	}
+	broadcast := net.ParseIP(cfg.broadcastAddress())
+	if broadcast == nil || broadcast.IsUnspecified() {
+		return fmt.Errorf("invalid broadcast address %q: must be a specific IPv4 or IPv6 address", cfg.broadcastAddress())
+	}
+	ip := net.ParseIP(bindIP(cfg.internalIP()))
+	if ip == nil {
+		return fmt.Errorf("invalid IP %q for the history, matching and worker services", cfg.internalIP())
+	}
+	if !reachableAt(ip, broadcast) {
+		return fmt.Errorf("the history, matching and worker services bound to %s cannot be reached at broadcast address %s", ip, broadcast)
+	}
+	return nil
+}
+
+// ProxiesFrontend reports whether clients reach the frontend service through a proxy
+// listening on the frontend IP and port.
+//
+// Services join the membership ring on the address their gRPC service binds to, so when
+// the frontend IP cannot be reached at the broadcast address, the frontend service binds
+// next to the other services on a port of its own instead.
+func (cfg *Config) ProxiesFrontend() bool {
+	return !reachableAt(net.ParseIP(bindIP(cfg.FrontendIP)), net.ParseIP(cfg.broadcastAddress()))
+}
+
+// bindIP returns the address a service configured with ip binds to.
+func bindIP(ip string) string {
+	if ip == "" {
+		return "127.0.0.1"
+	}
+	return ip
+}
+
+// reachableAt reports whether a service bound to ip accepts connections to addr.
+func reachableAt(ip, addr net.IP) bool {
+	// The IPv6 unspecified address accepts IPv4 connections too.
+	return ip.Equal(addr) || (ip.IsUnspecified() && (ip.To4() == nil || addr.To4() != nil))
+}
+
+// HasUI reports whether a web UI server is configured.
+func (cfg *Config) HasUI() bool {
+	_, noop := cfg.UIServer.(noopUIServer)
+	return cfg.UIServer != nil && !noop
+}
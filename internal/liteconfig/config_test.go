@@ -0,0 +1,194 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package liteconfig
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/metrics"
+)
+
+func TestAddresses(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		frontendIP        string
+		internalIP        string
+		broadcastAddress  string
+		expectedBroadcast string
+		expectedFrontend  string
+		// Empty when bound to localhost
+		expectedInternalIP string
+		expectedProxy      bool
+		expectedErr        string
+	}{
+		{name: "default", expectedBroadcast: "127.0.0.1", expectedFrontend: "127.0.0.1"},
+		{name: "frontend on all interfaces", frontendIP: "0.0.0.0", expectedBroadcast: "127.0.0.1", expectedFrontend: "127.0.0.1"},
+		{name: "frontend on IPv6 localhost", frontendIP: "::1", expectedBroadcast: "127.0.0.1", expectedFrontend: "::1", expectedProxy: true},
+		{name: "frontend on private address", frontendIP: "10.0.0.5", expectedBroadcast: "127.0.0.1", expectedFrontend: "10.0.0.5", expectedProxy: true},
+		{name: "internal IP", frontendIP: "127.0.0.1", internalIP: "10.0.0.5", expectedBroadcast: "10.0.0.5", expectedFrontend: "127.0.0.1", expectedInternalIP: "10.0.0.5", expectedProxy: true},
+		{name: "internal IP with frontend on all interfaces", frontendIP: "0.0.0.0", internalIP: "10.0.0.5", expectedBroadcast: "10.0.0.5", expectedFrontend: "127.0.0.1", expectedInternalIP: "10.0.0.5"},
+		{name: "all interfaces", frontendIP: "0.0.0.0", internalIP: "0.0.0.0", broadcastAddress: "10.0.0.5", expectedBroadcast: "10.0.0.5", expectedFrontend: "127.0.0.1", expectedInternalIP: "0.0.0.0"},
+		{name: "broadcast address only", frontendIP: "::", broadcastAddress: "fd00::5", expectedBroadcast: "fd00::5", expectedFrontend: "127.0.0.1", expectedInternalIP: "fd00::5"},
+		{name: "IPv4 wildcard with IPv6 broadcast", frontendIP: "0.0.0.0", internalIP: "::", broadcastAddress: "fd00::5", expectedBroadcast: "fd00::5", expectedFrontend: "127.0.0.1", expectedInternalIP: "::", expectedProxy: true},
+		{name: "unreachable internal services", frontendIP: "0.0.0.0", internalIP: "127.0.0.1", broadcastAddress: "10.0.0.5", expectedErr: "worker services bound to 127.0.0.1"},
+		{name: "unspecified broadcast address", frontendIP: "0.0.0.0", broadcastAddress: "0.0.0.0", expectedErr: "invalid broadcast address"},
+		{name: "invalid internal IP", broadcastAddress: "127.0.0.1", internalIP: "localhost", expectedErr: `invalid IP "localhost"`},
+		{name: "invalid frontend IP", frontendIP: "localhost", expectedErr: `invalid IP "localhost" for the frontend service`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewDefaultConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.FrontendIP = tc.frontendIP
+			cfg.InternalIP = tc.internalIP
+			cfg.BroadcastAddress = tc.broadcastAddress
+
+			err = cfg.ValidateAddresses()
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := Convert(cfg)
+			if c.Global.Membership.BroadcastAddress != tc.expectedBroadcast {
+				t.Errorf("expected broadcast address %q, got %q", tc.expectedBroadcast, c.Global.Membership.BroadcastAddress)
+			}
+			if expected := net.JoinHostPort(tc.expectedFrontend, strconv.Itoa(cfg.FrontendPort)); c.PublicClient.HostPort != expected {
+				t.Errorf("expected frontend host port %q, got %q", expected, c.PublicClient.HostPort)
+			}
+			for _, name := range []string{"history", "matching", "worker"} {
+				rpc := c.Services[name].RPC
+				if rpc.BindOnIP != tc.expectedInternalIP || rpc.BindOnLocalHost != (tc.expectedInternalIP == "") {
+					t.Errorf("expected %s service to bind to %q, got %+v", name, tc.expectedInternalIP, rpc)
+				}
+			}
+			if cfg.ProxiesFrontend() != tc.expectedProxy {
+				t.Errorf("expected frontend proxy %v, got %v", tc.expectedProxy, cfg.ProxiesFrontend())
+			}
+			// A proxied frontend service binds next to the other services
+			frontend := c.Services["frontend"].RPC
+			if tc.expectedProxy {
+				if frontend.BindOnIP != tc.expectedInternalIP || frontend.GRPCPort == cfg.FrontendPort {
+					t.Errorf("expected frontend service to bind to %q on another port, got %+v", tc.expectedInternalIP, frontend)
+				}
+			} else if frontend.BindOnIP != tc.frontendIP || frontend.GRPCPort != cfg.FrontendPort {
+				t.Errorf("expected frontend service to bind to %q, got %+v", tc.frontendIP, frontend)
+			}
+		})
+	}
+}
+
+func TestArchival(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		dataDir       string
+		baseArchival  config.Archival
+		expectedState string
+		expectedURI   string
+	}{
+		{name: "default", expectedState: "disabled"},
+		{name: "data directory", dataDir: "/data", expectedState: "enabled", expectedURI: "file:///data/archival/history"},
+		{
+			name:          "base config",
+			dataDir:       "/data",
+			baseArchival:  config.Archival{History: config.HistoryArchival{State: "paused"}},
+			expectedState: "paused",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewDefaultConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.DataDir = tc.dataDir
+			cfg.BaseConfig.Archival = tc.baseArchival
+
+			c := Convert(cfg)
+			if c.Archival.History.State != tc.expectedState {
+				t.Errorf("expected history archival %q, got %q", tc.expectedState, c.Archival.History.State)
+			}
+			if uri := c.NamespaceDefaults.Archival.History.URI; uri != tc.expectedURI {
+				t.Errorf("expected history archival URI %q, got %q", tc.expectedURI, uri)
+			}
+		})
+	}
+}
+
+func TestInternalMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		baseMetrics     *metrics.Config
+		expectedAddress string
+		expectedPath    string
+	}{
+		{name: "default", expectedPath: "/metrics"},
+		{
+			name:            "base config",
+			baseMetrics:     &metrics.Config{Prometheus: &metrics.PrometheusConfig{ListenAddress: "127.0.0.1:9090"}},
+			expectedAddress: "127.0.0.1:9090",
+			expectedPath:    "/metrics",
+		},
+		{
+			name:            "base config handler path",
+			baseMetrics:     &metrics.Config{Prometheus: &metrics.PrometheusConfig{ListenAddress: "127.0.0.1:9090", HandlerPath: "/prometheus"}},
+			expectedAddress: "127.0.0.1:9090",
+			expectedPath:    "/prometheus",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := NewDefaultConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.BaseConfig.Global.Metrics = tc.baseMetrics
+
+			c := Convert(cfg)
+			prometheus := c.Global.Metrics.Prometheus
+			if tc.expectedAddress != "" && prometheus.ListenAddress != tc.expectedAddress {
+				t.Errorf("expected internal metrics at %q, got %q", tc.expectedAddress, prometheus.ListenAddress)
+			}
+			// Ports derived from the frontend port are left to the listeners Temporalite documents
+			for _, port := range []int{cfg.FrontendPort, cfg.MetricsPort, c.Global.PProf.Port, cfg.FrontendPort + 202} {
+				if prometheus.ListenAddress == fmt.Sprintf("127.0.0.1:%d", port) {
+					t.Errorf("expected internal metrics not to use port %d", port)
+				}
+			}
+			if prometheus.HandlerPath != tc.expectedPath {
+				t.Errorf("expected internal metrics handler path %q, got %q", tc.expectedPath, prometheus.HandlerPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+// Package namespaces manages the namespaces of a Temporalite database file that no server
+// is using, and describes namespaces the same way whether they come from a file or a server.
+package namespaces
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	namespacepb "go.temporal.io/api/namespace/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	persistencespb "go.temporal.io/server/api/persistence/v1"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/persistence"
+	"go.temporal.io/server/common/persistence/serialization"
+	persistencesql "go.temporal.io/server/common/persistence/sql"
+	"go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
+	"go.temporal.io/server/common/primitives"
+	"go.temporal.io/server/common/resolver"
+	sqliteschema "go.temporal.io/server/schema/sqlite"
+
+	"github.com/temporalio/temporalite/internal/inspect"
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+// DefaultRetention is the retention of namespaces created without one, the same as
+// namespaces pre-created by the server.
+const DefaultRetention = 24 * time.Hour
+
+const listPageSize = 100
+
+// Namespace describes a registered namespace.
+type Namespace struct {
+	Name          string            `json:"name"`
+	ID            string            `json:"id"`
+	State         string            `json:"state"`
+	Description   string            `json:"description,omitempty"`
+	OwnerEmail    string            `json:"owner_email,omitempty"`
+	Retention     string            `json:"retention"`
+	Data          map[string]string `json:"data,omitempty"`
+	ActiveCluster string            `json:"active_cluster"`
+	IsGlobal      bool              `json:"is_global"`
+}
+
+// FromDescribeResponse converts a namespace described by a server.
+func FromDescribeResponse(resp *workflowservice.DescribeNamespaceResponse) Namespace {
+	info := resp.GetNamespaceInfo()
+	ns := Namespace{
+		Name:          info.GetName(),
+		ID:            info.GetId(),
+		State:         info.GetState().String(),
+		Description:   info.GetDescription(),
+		OwnerEmail:    info.GetOwnerEmail(),
+		Data:          info.GetData(),
+		ActiveCluster: resp.GetReplicationConfig().GetActiveClusterName(),
+		IsGlobal:      resp.GetIsGlobalNamespace(),
+	}
+	if retention := resp.GetConfig().GetWorkflowExecutionRetentionTtl(); retention != nil {
+		ns.Retention = retention.String()
+	}
+	return ns
+}
+
+func fromDetail(detail *persistencespb.NamespaceDetail, isGlobal bool) Namespace {
+	ns := Namespace{
+		Name:          detail.GetInfo().GetName(),
+		ID:            detail.GetInfo().GetId(),
+		State:         detail.GetInfo().GetState().String(),
+		Description:   detail.GetInfo().GetDescription(),
+		OwnerEmail:    detail.GetInfo().GetOwner(),
+		Data:          detail.GetInfo().GetData(),
+		ActiveCluster: detail.GetReplicationConfig().GetActiveClusterName(),
+		IsGlobal:      isGlobal,
+	}
+	if retention := detail.GetConfig().GetRetention(); retention != nil {
+		ns.Retention = retention.String()
+	}
+	return ns
+}
+
+// Options holds the settable fields of a namespace. Nil fields are left unchanged by
+// updates, and Data entries are merged into the existing data.
+type Options struct {
+	Description *string
+	OwnerEmail  *string
+	Retention   *time.Duration
+	Data        map[string]string
+}
+
+// RegisterRequest returns the request creating the named namespace on a server.
+func (o Options) RegisterRequest(name string) *workflowservice.RegisterNamespaceRequest {
+	retention := DefaultRetention
+	if o.Retention != nil {
+		retention = *o.Retention
+	}
+	req := &workflowservice.RegisterNamespaceRequest{
+		Namespace:                        name,
+		WorkflowExecutionRetentionPeriod: &retention,
+		Data:                             o.Data,
+	}
+	if o.Description != nil {
+		req.Description = *o.Description
+	}
+	if o.OwnerEmail != nil {
+		req.OwnerEmail = *o.OwnerEmail
+	}
+	return req
+}
+
+// UpdateRequest returns the request updating the named namespace on a server.
+func (o Options) UpdateRequest(name string) *workflowservice.UpdateNamespaceRequest {
+	req := &workflowservice.UpdateNamespaceRequest{
+		Namespace:  name,
+		UpdateInfo: &namespacepb.UpdateNamespaceInfo{Data: o.Data},
+	}
+	if o.Description != nil {
+		req.UpdateInfo.Description = *o.Description
+	}
+	if o.OwnerEmail != nil {
+		req.UpdateInfo.OwnerEmail = *o.OwnerEmail
+	}
+	if o.Retention != nil {
+		req.Config = &namespacepb.NamespaceConfig{WorkflowExecutionRetentionTtl: o.Retention}
+	}
+	return req
+}
+
+// Store manages the namespaces of a database file.
+//
+// Servers cache namespaces, callers must make sure no server uses the file, eg. by
+// holding its lock.
+type Store struct {
+	path    string
+	manager persistence.MetadataManager
+}
+
+// Open opens the database file at path.
+func Open(path string) (*Store, error) {
+	cfg := config.SQL{
+		PluginName:        sqlite.PluginName,
+		DatabaseName:      path,
+		ConnectAttributes: map[string]string{"mode": "rw"},
+	}
+	factory := persistencesql.NewFactory(cfg, resolver.NewNoopResolver(), liteconfig.ClusterName, log.NewNoopLogger())
+	metadataStore, err := factory.NewMetadataStore()
+	if err != nil {
+		factory.Close()
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	return &Store{
+		path:    path,
+		manager: persistence.NewMetadataManagerImpl(metadataStore, serialization.NewSerializer(), log.NewNoopLogger(), liteconfig.ClusterName),
+	}, nil
+}
+
+// Close closes the database file.
+func (s *Store) Close() {
+	s.manager.Close()
+}
+
+// List returns all namespaces, ordered by name.
+func (s *Store) List(ctx context.Context) ([]Namespace, error) {
+	var (
+		result []Namespace
+		token  []byte
+	)
+	for {
+		resp, err := s.manager.ListNamespaces(ctx, &persistence.ListNamespacesRequest{PageSize: listPageSize, NextPageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range resp.Namespaces {
+			result = append(result, fromDetail(ns.Namespace, ns.IsGlobalNamespace))
+		}
+		if token = resp.NextPageToken; len(token) == 0 {
+			break
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Describe returns the named namespace.
+func (s *Store) Describe(ctx context.Context, name string) (Namespace, error) {
+	resp, err := s.manager.GetNamespace(ctx, &persistence.GetNamespaceRequest{Name: name})
+	if err != nil {
+		return Namespace{}, err
+	}
+	return fromDetail(resp.Namespace, resp.IsGlobalNamespace), nil
+}
+
+// Create registers a local namespace.
+func (s *Store) Create(ctx context.Context, name string, opts Options) (Namespace, error) {
+	if name == "" {
+		return Namespace{}, serviceerror.NewInvalidArgument("namespace name is required")
+	}
+	detail := sqliteschema.NewNamespaceConfig(liteconfig.ClusterName, name, false).Detail
+	detail.Config.BadBinaries = &namespacepb.BadBinaries{Binaries: map[string]*namespacepb.BadBinaryInfo{}}
+	detail.ReplicationConfig.State = enumspb.REPLICATION_STATE_NORMAL
+	opts.apply(detail)
+	if err := validate(detail); err != nil {
+		return Namespace{}, err
+	}
+	if _, err := s.manager.CreateNamespace(ctx, &persistence.CreateNamespaceRequest{Namespace: detail}); err != nil {
+		return Namespace{}, err
+	}
+	return fromDetail(detail, false), nil
+}
+
+// Update changes the settings of the named namespace.
+func (s *Store) Update(ctx context.Context, name string, opts Options) (Namespace, error) {
+	metadata, err := s.manager.GetMetadata(ctx)
+	if err != nil {
+		return Namespace{}, err
+	}
+	resp, err := s.manager.GetNamespace(ctx, &persistence.GetNamespaceRequest{Name: name})
+	if err != nil {
+		return Namespace{}, err
+	}
+	detail := resp.Namespace
+	opts.apply(detail)
+	if err := validate(detail); err != nil {
+		return Namespace{}, err
+	}
+	// Mirror the versioning done by the server's namespace handler.
+	detail.ConfigVersion++
+	err = s.manager.UpdateNamespace(ctx, &persistence.UpdateNamespaceRequest{
+		Namespace:           detail,
+		IsGlobalNamespace:   resp.IsGlobalNamespace,
+		NotificationVersion: metadata.NotificationVersion,
+	})
+	if err != nil {
+		return Namespace{}, err
+	}
+	return fromDetail(detail, resp.IsGlobalNamespace), nil
+}
+
+// ErrHasExecutions is returned by Delete for namespaces that still hold workflow executions,
+// which only the server can delete.
+var ErrHasExecutions = errors.New("namespace has workflow executions, delete it through a running server")
+
+// Delete removes the named namespace, which must not hold any workflow execution.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	resp, err := s.manager.GetNamespace(ctx, &persistence.GetNamespaceRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	id, err := primitives.ParseUUID(resp.Namespace.GetInfo().GetId())
+	if err != nil {
+		return err
+	}
+	db, err := inspect.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	if err := db.QueryRowContext(ctx, "SELECT 1 FROM executions WHERE namespace_id = ? LIMIT 1", []byte(id)).Scan(new(int)); err == nil {
+		return ErrHasExecutions
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return s.manager.DeleteNamespaceByName(ctx, &persistence.DeleteNamespaceByNameRequest{Name: name})
+}
+
+func (o Options) apply(detail *persistencespb.NamespaceDetail) {
+	if o.Description != nil {
+		detail.Info.Description = *o.Description
+	}
+	if o.OwnerEmail != nil {
+		detail.Info.Owner = *o.OwnerEmail
+	}
+	if o.Retention != nil {
+		retention := *o.Retention
+		detail.Config.Retention = &retention
+	}
+	if len(o.Data) > 0 && detail.Info.Data == nil {
+		detail.Info.Data = make(map[string]string, len(o.Data))
+	}
+	for k, v := range o.Data {
+		detail.Info.Data[k] = v
+	}
+}
+
+func validate(detail *persistencespb.NamespaceDetail) error {
+	if retention := detail.GetConfig().GetRetention(); retention == nil || *retention <= 0 {
+		return serviceerror.NewInvalidArgument("retention must be positive")
+	}
+	return nil
+}
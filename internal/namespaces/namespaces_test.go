@@ -0,0 +1,105 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/persistence/sql/sqlplugin/sqlite"
+	sqliteschema "go.temporal.io/server/schema/sqlite"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := sqliteschema.SetupSchema(&config.SQL{
+		PluginName:        sqlite.PluginName,
+		DatabaseName:      path,
+		ConnectAttributes: map[string]string{"mode": "rwc"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	description := "payments team"
+	created, err := s.Create(ctx, "payments", Options{Description: &description, Data: map[string]string{"team": "payments"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.State != "Registered" || created.Retention != DefaultRetention.String() {
+		t.Errorf("unexpected created namespace %+v", created)
+	}
+	if _, err := s.Create(ctx, "payments", Options{}); !errors.As(err, new(*serviceerror.NamespaceAlreadyExists)) {
+		t.Errorf("expected error creating duplicate namespace, got %v", err)
+	}
+	if _, err := s.Create(ctx, "orders", Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "orders" || list[1].Name != "payments" {
+		t.Fatalf("unexpected namespaces %+v", list)
+	}
+
+	retention := 72 * time.Hour
+	owner := "payments@example.com"
+	if _, err := s.Update(ctx, "payments", Options{Retention: &retention, OwnerEmail: &owner, Data: map[string]string{"tier": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := s.Describe(ctx, "payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Retention != retention.String() || ns.OwnerEmail != owner || ns.Description != description {
+		t.Errorf("unexpected updated namespace %+v", ns)
+	}
+	if ns.Data["team"] != "payments" || ns.Data["tier"] != "1" {
+		t.Errorf("expected data to be merged, got %v", ns.Data)
+	}
+	negative := -time.Hour
+	if _, err := s.Update(ctx, "payments", Options{Retention: &negative}); err == nil {
+		t.Error("expected error setting a negative retention")
+	}
+
+	if err := s.Delete(ctx, "payments"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Describe(ctx, "payments"); !errors.As(err, new(*serviceerror.NamespaceNotFound)) {
+		t.Errorf("expected namespace to be deleted, got %v", err)
+	}
+}
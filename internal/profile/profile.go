@@ -0,0 +1,223 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package profile manages the registry of named Temporalite instances, each with
+// its own data directory and ports.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// firstPort is the frontend port of the first profile, clear of the default 7233.
+	firstPort = 7300
+	// portStep separates the frontend ports of profiles.
+	portStep = 10
+	// uiPortOffset matches the CLI's default web UI port of --port + 1000.
+	uiPortOffset = 1000
+	// metricsPortOffset keeps metrics ports clear of the frontend and UI ports of other profiles.
+	metricsPortOffset = 2000
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// Profile is a named Temporalite instance.
+type Profile struct {
+	Name        string    `json:"name"`
+	Port        int       `json:"port"`
+	UIPort      int       `json:"ui_port"`
+	MetricsPort int       `json:"metrics_port"`
+	DataDir     string    `json:"data_dir"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Registry is the set of profiles stored in a file.
+type Registry struct {
+	path     string
+	Profiles []Profile `json:"profiles"`
+}
+
+// NotFoundError is returned when a profile does not exist in the registry.
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("profile %q does not exist", e.Name)
+}
+
+// Dir returns the directory of the default registry, under the user config directory.
+func Dir() (string, error) {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine user config directory: %w", err)
+	}
+	return filepath.Join(userConfigDir, "temporalite"), nil
+}
+
+// Load reads the default registry, which is empty if it was never saved.
+func Load() (*Registry, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(filepath.Join(dir, "profiles.json"))
+}
+
+// LoadFile reads the registry stored at path, which is empty if the file does not exist.
+func LoadFile(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("unable to read profile registry %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Save writes the registry back to its file.
+func (r *Registry) Save() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so that the registry is never left truncated
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// Get returns the named profile.
+func (r *Registry) Get(name string) (Profile, error) {
+	for _, p := range r.Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, &NotFoundError{Name: name}
+}
+
+// Create adds a profile to the registry, keeping its data under the registry's directory.
+//
+// Ports left to zero are assigned so that they do not collide with other profiles
+// or with ports already in use on this machine.
+func (r *Registry) Create(name string, port, uiPort, metricsPort int, now time.Time) (Profile, error) {
+	if !validName.MatchString(name) {
+		return Profile{}, fmt.Errorf("invalid profile name %q: only letters, digits, '-' and '_' are allowed", name)
+	}
+	if _, err := r.Get(name); err == nil {
+		return Profile{}, fmt.Errorf("profile %q already exists", name)
+	}
+
+	used := make(map[int]string)
+	for _, p := range r.Profiles {
+		used[p.Port] = p.Name
+		used[p.UIPort] = p.Name
+		used[p.MetricsPort] = p.Name
+	}
+	for _, requested := range []int{port, uiPort, metricsPort} {
+		if other, ok := used[requested]; ok && requested != 0 {
+			return Profile{}, fmt.Errorf("port %d is already used by profile %q", requested, other)
+		}
+	}
+
+	// free reports whether a port left to zero can be assigned candidate.
+	free := func(requested, candidate int) bool {
+		if requested != 0 {
+			return true
+		}
+		_, taken := used[candidate]
+		return !taken && available(candidate)
+	}
+	if port == 0 {
+		for candidate := firstPort; ; candidate += portStep {
+			if candidate+metricsPortOffset > 65535 {
+				return Profile{}, errors.New("no free ports left for a new profile")
+			}
+			if !free(0, candidate) || !free(uiPort, candidate+uiPortOffset) || !free(metricsPort, candidate+metricsPortOffset) {
+				continue
+			}
+			port = candidate
+			break
+		}
+	}
+	if uiPort == 0 {
+		uiPort = port + uiPortOffset
+	}
+	if metricsPort == 0 {
+		metricsPort = port + metricsPortOffset
+	}
+
+	p := Profile{
+		Name:        name,
+		Port:        port,
+		UIPort:      uiPort,
+		MetricsPort: metricsPort,
+		DataDir:     filepath.Join(filepath.Dir(r.path), "profiles", name),
+		CreatedAt:   now,
+	}
+	r.Profiles = append(r.Profiles, p)
+	sort.Slice(r.Profiles, func(i, j int) bool { return r.Profiles[i].Name < r.Profiles[j].Name })
+	return p, nil
+}
+
+// Delete removes the named profile from the registry, leaving its data directory as is.
+func (r *Registry) Delete(name string) (Profile, error) {
+	for i, p := range r.Profiles {
+		if p.Name == name {
+			r.Profiles = append(r.Profiles[:i], r.Profiles[i+1:]...)
+			return p, nil
+		}
+	}
+	return Profile{}, &NotFoundError{Name: name}
+}
+
+func available(port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
@@ -0,0 +1,106 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package profile
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	r, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	payments, err := r.Create("payments", 0, 0, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payments.Port < firstPort || payments.UIPort != payments.Port+uiPortOffset || payments.MetricsPort != payments.Port+metricsPortOffset {
+		t.Errorf("unexpected ports for %+v", payments)
+	}
+	if payments.DataDir != filepath.Join(filepath.Dir(path), "profiles", "payments") {
+		t.Errorf("unexpected data dir %q", payments.DataDir)
+	}
+	orders, err := r.Create("orders", 0, 0, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := make(map[int]string)
+	for _, p := range []Profile{payments, orders} {
+		for _, port := range []int{p.Port, p.UIPort, p.MetricsPort} {
+			if other, ok := ports[port]; ok {
+				t.Errorf("expected distinct ports, %s and %s both use %d", other, p.Name, port)
+			}
+			ports[port] = p.Name
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		name        string
+		port        int
+		uiPort      int
+		metricsPort int
+	}{
+		"duplicate":                    {name: "payments"},
+		"invalid name":                 {name: "../payments"},
+		"used port":                    {name: "billing", port: payments.Port},
+		"used UI port":                 {name: "billing", uiPort: orders.UIPort},
+		"used metrics port":            {name: "billing", metricsPort: payments.MetricsPort},
+		"metrics port used as UI port": {name: "billing", metricsPort: orders.UIPort},
+		"empty name":                   {name: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := r.Create(tc.name, tc.port, tc.uiPort, tc.metricsPort, now); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+	r, err = LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Profiles) != 2 || r.Profiles[0].Name != "orders" || r.Profiles[1] != payments {
+		t.Errorf("unexpected profiles after reload: %+v", r.Profiles)
+	}
+
+	if _, err := r.Delete("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get("orders"); err == nil {
+		t.Error("expected deleted profile to be gone")
+	}
+	if _, err := r.Delete("orders"); err == nil {
+		t.Error("expected error deleting missing profile")
+	}
+}
@@ -28,6 +28,54 @@ func WithDatabaseFilePath(filepath string) ServerOption {
 	})
 }
 
+// WithDataDir keeps all server state in the given directory, which is created if needed:
+// the database file and its lock, the archival directory used by namespaces enabling
+// archival, and a metadata file recording the versions that created and last used it.
+//
+// The database file path is derived from the directory, overriding WithDatabaseFilePath.
+func WithDataDir(dir string) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.Ephemeral = false
+		cfg.DataDir = dir
+	})
+}
+
+// WithDatabaseEncryptionKey encrypts workflow state and histories stored in the database
+// file with the given 32 bytes AES-256 key.
+//
+// A database created with a key can only be opened with that same key, while the metadata
+// needed to list and query workflows (eg. IDs, types, search attributes and memos) stays readable.
+func WithDatabaseEncryptionKey(key []byte) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.DatabaseEncryptionKey = key
+	})
+}
+
+// WithForcedDatabaseLock replaces the database lock file even if another process holds
+// its lock, eg. a hung server that cannot be stopped. That process should be killed, as it
+// keeps using the database file too.
+//
+// The lock is released by the OS when its process exits, so locks left behind by processes
+// that are no longer running never need to be forced.
+func WithForcedDatabaseLock() ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.ForceDatabaseLock = true
+	})
+}
+
+// WithReadOnly serves the existing database file for browsing without ever modifying it.
+//
+// The server runs against a temporary copy of the database, rejects all frontend calls
+// that would mutate state, stops executing history tasks such as timers and disables the
+// internal worker's background jobs. The copy is made in os.TempDir on each start, taking
+// time and disk space in proportion to the size of the database. Read-only mode cannot be
+// combined with a file-based dynamic config client.
+func WithReadOnly() ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.ReadOnly = true
+	})
+}
+
 // WithPersistenceDisabled disables file persistence and uses the in-memory storage driver.
 // State will be reset on each process restart.
 func WithPersistenceDisabled() ServerOption {
@@ -43,12 +91,24 @@ func WithPersistenceDisabled() ServerOption {
 // This option accepts a UIServer implementation in order to avoid bloating
 // programs that do not need to embed the UI.
 // See ./cmd/temporalite/main.go for an example of usage.
+//
+// When server has an `Address() string` method returning its listen address, NewServer
+// checks that address is free along with the ports of the other services, unless it is empty.
 func WithUI(server liteconfig.UIServer) ServerOption {
 	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
 		cfg.UIServer = server
 	})
 }
 
+// WithInterruptOn makes Start block until a value is received on interruptCh, and then stop
+// the server, using temporal.InterruptOn for the Temporal services. Stop must not be called
+// on such a server.
+func WithInterruptOn(interruptCh <-chan interface{}) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.InterruptCh = interruptCh
+	})
+}
+
 // WithFrontendPort sets the listening port for the temporal-frontend GRPC service.
 //
 // When unspecified, the default port number of 7233 is used.
@@ -67,16 +127,80 @@ func WithMetricsPort(port int) ServerOption {
 	})
 }
 
-// WithFrontendIP binds the temporal-frontend GRPC service to a specific IP (eg. `0.0.0.0`)
-// Check net.ParseIP for supported syntax; only IPv4 is supported.
+// WithHTTPPort serves a JSON mapping of the workflow operations of the temporal-frontend
+// GRPC service on port, at the same paths as the web UI's API, eg.
+// `POST /api/v1/namespaces/{namespace}/workflows/{workflowId}/start`. It binds to the
+// frontend IP and uses the frontend's TLS configuration. NewServer fails when the frontend
+// requires client certificates, as HTTP callers would get the identity of the server.
 //
-// When unspecified, the frontend service will bind to localhost.
+// When unspecified, the HTTP API is disabled.
+func WithHTTPPort(port int) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.HTTPPort = port
+	})
+}
+
+// WithFrontendIP binds the temporal-frontend GRPC service to a specific IPv4 or IPv6 address
+// (eg. `0.0.0.0`, `::1` or `::`). Check net.ParseIP for supported syntax. Binding to `::`
+// accepts both IPv4 and IPv6 connections.
+//
+// Clients connect to the given address, the other services keep binding to localhost unless
+// WithInternalIP is used. When unspecified, the frontend service will bind to localhost.
 func WithFrontendIP(address string) ServerOption {
 	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
 		cfg.FrontendIP = address
 	})
 }
 
+// WithInternalIP binds the temporal-history, temporal-matching and temporal-worker services
+// to a specific IPv4 or IPv6 address, eg. a private address of a container network.
+//
+// When unspecified, they bind to the broadcast address if WithBroadcastAddress is used, and
+// to localhost otherwise.
+func WithInternalIP(address string) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.InternalIP = address
+	})
+}
+
+// WithBroadcastAddress sets the address services advertise to each other in the membership
+// ring. It is required to be a specific address that reaches the services, so services bound
+// to all interfaces can be advertised at a reachable address.
+//
+// When unspecified, the internal IP is used unless it binds to all interfaces, in which case
+// localhost is used. When the frontend IP cannot be reached at the broadcast address, the
+// frontend service binds next to the other services and connections to the frontend IP and
+// port are forwarded to it.
+func WithBroadcastAddress(address string) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.BroadcastAddress = address
+	})
+}
+
+// WithFrontendUnixSocket serves the temporal-frontend GRPC service on a Unix domain socket
+// at path, which only the user running the server may connect to. Clients created with
+// NewClient connect to the socket, and FrontendHostPort returns its `unix://` address.
+//
+// The other services keep reaching the frontend through its loopback listener, which any
+// local user can connect to as well.
+func WithFrontendUnixSocket(path string) ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.FrontendUnixSocket = path
+	})
+}
+
+// WithGRPCReflection lets tools like grpcurl discover and describe the services of the
+// temporal-frontend GRPC service through its reflection service, without their proto files.
+//
+// Temporal's API is generated with gogo/protobuf, which keeps its descriptors out of the
+// registry read by the reflection service. This option registers them in
+// protoregistry.GlobalFiles, for the whole process.
+func WithGRPCReflection() ServerOption {
+	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
+		cfg.GRPCReflection = true
+	})
+}
+
 // WithDynamicPorts starts Temporal on system-chosen ports.
 func WithDynamicPorts() ServerOption {
 	return newApplyFuncContainer(func(cfg *liteconfig.Config) {
@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package temporalite
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/primitives"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+	"github.com/temporalio/temporalite/internal/process"
+)
+
+// Port is a TCP address the server listens on.
+type Port struct {
+	Address string
+	// What the server uses the port for, eg. "frontend gRPC".
+	Purpose string
+	// Err is why the port cannot be listened on, nil when it is free.
+	Err error
+	// PID and Process identify the process listening on the port, when it can be determined.
+	PID     int
+	Process string
+}
+
+// PortConflictError is returned by NewServer when ports it needs cannot be listened on,
+// usually because another process is using them.
+type PortConflictError struct {
+	// Every port the server listens on, those in use have Err set.
+	Ports []Port
+}
+
+func (e *PortConflictError) Error() string {
+	var conflicts []string
+	for _, p := range e.Ports {
+		if p.Err == nil {
+			continue
+		}
+		conflict := fmt.Sprintf("%s (%s)", p.Address, p.Purpose)
+		if p.PID != 0 {
+			conflict += fmt.Sprintf(" is used by %s (pid %d)", p.Process, p.PID)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return fmt.Sprintf("ports needed by the server are unavailable: %s; use WithFrontendPort to choose other ports or WithDynamicPorts to let the system choose them",
+		strings.Join(conflicts, ", "))
+}
+
+// serverPorts lists the ports the server listens on, given its converted configuration.
+func serverPorts(c *liteconfig.Config, cfg *config.Config) []Port {
+	listenIP := func(rpc config.RPC) string {
+		if rpc.BindOnIP != "" {
+			return rpc.BindOnIP
+		}
+		return "127.0.0.1"
+	}
+	port := func(host string, port int, purpose string) Port {
+		return Port{Address: net.JoinHostPort(host, strconv.Itoa(port)), Purpose: purpose}
+	}
+
+	frontend := cfg.Services[primitives.FrontendService].RPC
+	ports := []Port{port(listenIP(frontend), frontend.GRPCPort, "frontend gRPC")}
+	if c.ProxiesFrontend() {
+		ports[0].Purpose = "frontend gRPC for the other services"
+		ports = append(ports, Port{Address: frontendProxyAddress(c, cfg), Purpose: "frontend gRPC"})
+	}
+	// The worker service does not serve gRPC, but joins the membership ring like the others.
+	for _, name := range []string{primitives.HistoryService, primitives.MatchingService} {
+		rpc := cfg.Services[name].RPC
+		ports = append(ports, port(listenIP(rpc), rpc.GRPCPort, name+" gRPC"))
+	}
+	for _, name := range []string{primitives.FrontendService, primitives.HistoryService, primitives.MatchingService, primitives.WorkerService} {
+		rpc := cfg.Services[name].RPC
+		ports = append(ports, port(listenIP(rpc), rpc.MembershipPort, name+" membership"))
+	}
+	ports = append(ports,
+		port(c.FrontendIP, c.MetricsPort, "metrics and health checks"),
+		Port{Address: cfg.Global.Metrics.Prometheus.ListenAddress, Purpose: "services metrics"},
+		port("localhost", cfg.Global.PProf.Port, "pprof"),
+	)
+	if c.HTTPPort != 0 {
+		ports = append(ports, port(c.FrontendIP, c.HTTPPort, "HTTP API"))
+	}
+	if ui, ok := c.UIServer.(interface{ Address() string }); ok && ui.Address() != "" {
+		ports = append(ports, Port{Address: ui.Address(), Purpose: "web UI"})
+	}
+	return ports
+}
+
+// checkPorts returns a *PortConflictError unless every port can be listened on.
+func checkPorts(ports []Port) error {
+	var conflict bool
+	for i := range ports {
+		p := &ports[i]
+		listener, err := net.Listen("tcp", p.Address)
+		if err != nil {
+			conflict = true
+			p.Err = err
+			if _, portStr, splitErr := net.SplitHostPort(p.Address); splitErr == nil {
+				if n, convErr := strconv.Atoi(portStr); convErr == nil {
+					p.PID, p.Process, _ = process.ListeningOn(n)
+				}
+			}
+			continue
+		}
+		_ = listener.Close()
+	}
+	if conflict {
+		return &PortConflictError{Ports: ports}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package temporalite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+
+	"go.temporal.io/server/common/config"
+
+	"github.com/temporalio/temporalite/internal/liteconfig"
+)
+
+// frontendProxy serves the frontend on another address by forwarding each connection to
+// the frontend's listener, which the other services keep using: on a Unix domain socket, or
+// on the frontend IP when the frontend service binds next to the other services.
+type frontendProxy struct {
+	network string
+	address string
+	target  string
+
+	listener net.Listener
+}
+
+func (p *frontendProxy) start() error {
+	if p.network == "unix" {
+		if err := removeStaleSocket(p.address); err != nil {
+			return err
+		}
+	}
+	var listener net.Listener
+	var err error
+	if p.network == "unix" {
+		listener, err = listenUnix(p.address)
+	} else {
+		listener, err = net.Listen(p.network, p.address)
+	}
+	if err != nil && p.network == "unix" {
+		return fmt.Errorf("unable to listen on unix socket: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("unable to listen on frontend address: %w", err)
+	}
+	p.listener = listener
+	go p.serve()
+	return nil
+}
+
+// stop closes the listener, which removes the socket file. Forwarded connections are closed
+// once the frontend closes its side.
+func (p *frontendProxy) stop() {
+	if p.listener != nil {
+		_ = p.listener.Close()
+	}
+}
+
+func (p *frontendProxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(conn)
+	}
+}
+
+func (p *frontendProxy) forward(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// frontendProxyAddress returns the address the proxy serves the frontend on when the
+// frontend service binds next to the other services, the frontend IP and port.
+func frontendProxyAddress(c *liteconfig.Config, cfg *config.Config) string {
+	if c.FrontendIP == "" {
+		return cfg.PublicClient.HostPort
+	}
+	return net.JoinHostPort(c.FrontendIP, strconv.Itoa(c.FrontendPort))
+}
+
+// removeStaleSocket removes the socket left behind at path by a server that did not shut
+// down gracefully, failing if another server still listens on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
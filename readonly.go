@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package temporalite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/dynamicconfig"
+	"go.temporal.io/server/common/primitives"
+	"google.golang.org/grpc"
+)
+
+// readOnlyDynamicConfig disables the internal worker's background jobs, which would
+// otherwise clean up or rewrite data that is being analyzed.
+//
+// It also stops the history service from executing timer, transfer and visibility tasks
+// by leaving their schedulers without workers, so that pending timers never fire and
+// workflows stay exactly as they were recorded.
+var readOnlyDynamicConfig = map[dynamicconfig.Key]interface{}{
+	dynamicconfig.TaskQueueScannerEnabled:       false,
+	dynamicconfig.HistoryScannerEnabled:         false,
+	dynamicconfig.ExecutionsScannerEnabled:      false,
+	dynamicconfig.EnableBatcher:                 false,
+	dynamicconfig.WorkerEnableScheduler:         false,
+	dynamicconfig.EnableParentClosePolicyWorker: false,
+
+	dynamicconfig.TimerProcessorSchedulerWorkerCount:      0,
+	dynamicconfig.TransferProcessorSchedulerWorkerCount:   0,
+	dynamicconfig.VisibilityProcessorSchedulerWorkerCount: 0,
+	dynamicconfig.TimerTaskWorkerCount:                    0,
+	dynamicconfig.TransferTaskWorkerCount:                 0,
+	dynamicconfig.VisibilityTaskWorkerCount:               0,
+}
+
+// readOnlyMethodPrefixes lists the method name prefixes that do not mutate state.
+var readOnlyMethodPrefixes = []string{"Describe", "Get", "List", "Count", "Scan", "Query"}
+
+// readOnlySystemMethodPrefixes are additionally allowed in the system namespace, where the
+// internal worker keeps polling its task queues.
+var readOnlySystemMethodPrefixes = append([]string{"Poll"}, readOnlyMethodPrefixes...)
+
+// readOnlyAPIs are the gRPC services subject to read-only restrictions.
+var readOnlyAPIs = []string{
+	"/temporal.api.workflowservice.v1.WorkflowService/",
+	"/temporal.api.operatorservice.v1.OperatorService/",
+	"/temporal.server.api.adminservice.v1.AdminService/",
+}
+
+// readOnlyInterceptor rejects frontend calls that would mutate state, including task
+// queue polls so that no workflow or activity task is ever dispatched.
+//
+// The internal worker may still poll the system namespace's task queues.
+func readOnlyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	prefixes := readOnlyMethodPrefixes
+	if r, ok := req.(interface{ GetNamespace() string }); ok && r.GetNamespace() == primitives.SystemLocalNamespace {
+		prefixes = readOnlySystemMethodPrefixes
+	}
+	for _, api := range readOnlyAPIs {
+		method := strings.TrimPrefix(info.FullMethod, api)
+		if method == info.FullMethod {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(method, prefix) {
+				return handler(ctx, req)
+			}
+		}
+		return nil, serviceerror.NewPermissionDenied(fmt.Sprintf("%s is not allowed: Temporalite is running in read-only mode", method), "")
+	}
+	return handler(ctx, req)
+}
+
+// snapshotDatabase writes a consistent copy of the database at src to dst without
+// modifying src.
+//
+// Cluster membership records are dropped from the copy, see resetClusterMembership.
+func snapshotDatabase(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", src, url.Values{"mode": {"ro"}}.Encode()))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err := db.Exec("VACUUM INTO ?", dst); err != nil {
+		return fmt.Errorf("unable to copy %s: %w", src, err)
+	}
+	return resetClusterMembership(dst)
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package temporalite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	_ "github.com/gogo/protobuf/gogoproto"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Files declaring the services of the frontend, generated with gogo/protobuf.
+var reflectionServiceFiles = []string{
+	"temporal/api/workflowservice/v1/service.proto",
+	"temporal/api/operatorservice/v1/service.proto",
+	"temporal/server/api/adminservice/v1/service.proto",
+}
+
+// The API's files import gogo.proto from a copy whose package would register the same
+// extensions as gogo/protobuf's, so its descriptor is taken from gogo/protobuf instead.
+var gogoFileAliases = map[string]string{
+	"dependencies/gogoproto/gogo.proto": "gogo.proto",
+}
+
+var (
+	registerReflectionOnce sync.Once
+	registerReflectionErr  error
+)
+
+// registerReflectionDescriptors copies the descriptors of the frontend's services and their
+// dependencies from the gogo/protobuf registry to protoregistry.GlobalFiles, where the
+// reflection service registered by the frontend looks symbols up.
+func registerReflectionDescriptors() error {
+	registerReflectionOnce.Do(func() {
+		for _, path := range reflectionServiceFiles {
+			if registerReflectionErr = registerGogoFile(path); registerReflectionErr != nil {
+				return
+			}
+		}
+	})
+	return registerReflectionErr
+}
+
+func registerGogoFile(path string) error {
+	if _, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return nil
+	}
+	registeredPath := path
+	if alias, ok := gogoFileAliases[path]; ok {
+		registeredPath = alias
+	}
+	compressed := gogoproto.FileDescriptor(registeredPath)
+	if compressed == nil {
+		return fmt.Errorf("descriptor of %s is not registered", path)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("unable to read descriptor of %s: %w", path, err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to read descriptor of %s: %w", path, err)
+	}
+	var fdp descriptorpb.FileDescriptorProto
+	if err := proto.Unmarshal(b, &fdp); err != nil {
+		return fmt.Errorf("unable to read descriptor of %s: %w", path, err)
+	}
+	fdp.Name = proto.String(path)
+
+	for _, dep := range fdp.GetDependency() {
+		if err := registerGogoFile(dep); err != nil {
+			return err
+		}
+	}
+	fd, err := protodesc.NewFile(&fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		return fmt.Errorf("invalid descriptor of %s: %w", path, err)
+	}
+	// GlobalFiles panics on conflicts instead of returning an error.
+	for _, name := range topLevelNames(fd) {
+		if _, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+			return fmt.Errorf("%s of %s is already registered by another file", name, path)
+		}
+	}
+	return protoregistry.GlobalFiles.RegisterFile(fd)
+}
+
+// topLevelNames returns the names fd declares in its package's scope.
+func topLevelNames(fd protoreflect.FileDescriptor) []protoreflect.FullName {
+	var names []protoreflect.FullName
+	for i := 0; i < fd.Messages().Len(); i++ {
+		names = append(names, fd.Messages().Get(i).FullName())
+	}
+	for i := 0; i < fd.Enums().Len(); i++ {
+		enum := fd.Enums().Get(i)
+		names = append(names, enum.FullName())
+		for j := 0; j < enum.Values().Len(); j++ {
+			names = append(names, enum.Values().Get(j).FullName())
+		}
+	}
+	for i := 0; i < fd.Extensions().Len(); i++ {
+		names = append(names, fd.Extensions().Get(i).FullName())
+	}
+	for i := 0; i < fd.Services().Len(); i++ {
+		names = append(names, fd.Services().Get(i).FullName())
+	}
+	return names
+}
@@ -0,0 +1,212 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package replay checks changes to workflow code for non-determinism by replaying workflow
+// histories against it, eg. histories exported from a Temporalite server with:
+//
+//	temporalite workflow export --query "WorkflowType='Greet'" --dir testdata/histories
+//
+// Go workflows cannot be loaded into the temporalite binary, call Dir from a test of the
+// package registering the workflows instead:
+//
+//	results, err := replay.Dir("testdata/histories", func(r worker.WorkflowRegistry) {
+//		r.RegisterWorkflow(Greet)
+//	})
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+)
+
+// Result is the outcome of replaying a workflow history.
+type Result struct {
+	// File is the path of the history, empty for histories not read from a file.
+	File         string
+	WorkflowType string
+	// Err is nil when the workflow code reproduced the history.
+	Err error
+	// EventID and EventType identify the first event of the history the workflow code
+	// didn't reproduce, when Err is not nil.
+	EventID   int64
+	EventType string
+}
+
+func (r Result) String() string {
+	name := r.File
+	if name == "" {
+		name = r.WorkflowType
+	}
+	if r.Err == nil {
+		return fmt.Sprintf("%s: ok", name)
+	}
+	if r.EventID == 0 {
+		return fmt.Sprintf("%s: %v", name, r.Err)
+	}
+	return fmt.Sprintf("%s: event %d (%s): %v", name, r.EventID, r.EventType, r.Err)
+}
+
+// Dir replays each JSON history file in dir against the workflows registered by register,
+// returning a result per file in file name order.
+func Dir(dir string, register func(worker.WorkflowRegistry)) ([]Result, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	replayer, err := newReplayer(register)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(files))
+	for _, file := range files {
+		history, err := readHistory(file)
+		if err != nil {
+			return nil, err
+		}
+		result := replayer.replay(history)
+		result.File = file
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// History replays a single history against the workflows registered by register.
+func History(history *historypb.History, register func(worker.WorkflowRegistry)) (Result, error) {
+	replayer, err := newReplayer(register)
+	if err != nil {
+		return Result{}, err
+	}
+	return replayer.replay(history), nil
+}
+
+func readHistory(file string) (*historypb.History, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	history, err := client.HistoryFromJSON(f, client.HistoryJSONOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history %s: %w", file, err)
+	}
+	return history, nil
+}
+
+type replayer struct {
+	worker.WorkflowReplayer
+}
+
+func newReplayer(register func(worker.WorkflowRegistry)) (*replayer, error) {
+	r, err := worker.NewWorkflowReplayerWithOptions(worker.WorkflowReplayerOptions{})
+	if err != nil {
+		return nil, err
+	}
+	register(r)
+	return &replayer{r}, nil
+}
+
+func (r *replayer) replay(history *historypb.History) Result {
+	if len(history.GetEvents()) == 0 {
+		return Result{Err: errors.New("history has no events")}
+	}
+	result := Result{
+		WorkflowType: history.GetEvents()[0].GetWorkflowExecutionStartedEventAttributes().GetWorkflowType().GetName(),
+		Err:          r.ReplayWorkflowHistory(nopLogger{}, history),
+	}
+	if result.Err != nil {
+		if event := r.firstFailingEvent(history.Events, result.Err); event != nil {
+			result.EventID = event.EventId
+			result.EventType = event.EventType.String()
+		}
+	}
+	return result
+}
+
+// mismatchedEventPattern matches the type of the event in the SDK's non-determinism errors.
+var mismatchedEventPattern = regexp.MustCompile(`(?:history event is|missing replay command for) (\w+):`)
+
+// firstFailingEvent returns the first event that failed replaying the history with err.
+//
+// The SDK only reports the type and attributes of mismatching events, so the workflow task
+// failing the replay is found first, by replaying prefixes of the history ending before a
+// workflow task is scheduled: replaying such a prefix checks the commands of every workflow
+// task in it. The event recorded for a command of that task matching the error, or else
+// the first one, is returned.
+func (r *replayer) firstFailingEvent(events []*historypb.HistoryEvent, err error) *historypb.HistoryEvent {
+	var cuts []int
+	for i, event := range events {
+		// The SDK refuses to replay histories of less than 3 events
+		if i >= 3 && event.EventType == enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED {
+			cuts = append(cuts, i)
+		}
+	}
+	cuts = append(cuts, len(events))
+	failing := sort.Search(len(cuts), func(i int) bool {
+		return r.ReplayWorkflowHistory(nopLogger{}, &historypb.History{Events: events[:cuts[i]]}) != nil
+	})
+	if failing == len(cuts) {
+		failing = len(cuts) - 1
+	}
+	start := 0
+	if failing > 0 {
+		start = cuts[failing-1]
+	}
+	candidates := events[start:cuts[failing]]
+	for i, event := range candidates {
+		if event.EventType == enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED && i+1 < len(candidates) {
+			candidates = candidates[i+1:]
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if m := mismatchedEventPattern.FindStringSubmatch(err.Error()); m != nil {
+		for _, event := range candidates {
+			if event.EventType.String() == m[1] {
+				return event
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// nopLogger discards the logs of the SDK's replayer, which logs every replayed workflow task.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
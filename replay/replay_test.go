@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2022 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2021 Datadog, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package replay_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/temporalio/temporalite/internal/examples/helloworld"
+	"github.com/temporalio/temporalite/replay"
+	"github.com/temporalio/temporalite/temporaltest"
+)
+
+// greetAfterTimer changes helloworld.Greet in a non-deterministic way, by starting a timer
+// before picking a greeting.
+func greetAfterTimer(ctx workflow.Context, subject string) (string, error) {
+	if err := workflow.Sleep(ctx, time.Second); err != nil {
+		return "", err
+	}
+	return helloworld.Greet(ctx, subject)
+}
+
+func TestDir(t *testing.T) {
+	ts := temporaltest.NewServer(temporaltest.WithT(t))
+	ts.NewWorker("hello_world", func(registry worker.Registry) {
+		helloworld.RegisterWorkflowsAndActivities(registry)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c := ts.DefaultClient()
+	wfr, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: "hello_world"}, helloworld.Greet, "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfr.Get(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "greet.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	iter := c.GetWorkflowHistory(ctx, wfr.GetID(), wfr.GetRunID(), false, 0)
+	var history historypb.History
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		history.Events = append(history.Events, event)
+	}
+	if err := (&jsonpb.Marshaler{}).Marshal(f, &history); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := replay.Dir(dir, func(r worker.WorkflowRegistry) {
+		r.RegisterWorkflow(helloworld.Greet)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].WorkflowType != "Greet" {
+		t.Errorf("expected history to replay, got %v", results)
+	}
+
+	results, err = replay.Dir(dir, func(r worker.WorkflowRegistry) {
+		r.RegisterWorkflowWithOptions(greetAfterTimer, workflow.RegisterOptions{Name: "Greet"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("expected non-determinism error, got %v", results)
+	}
+	// Events 1 to 4 start the workflow and complete its first workflow task
+	if results[0].EventID != 5 || results[0].EventType != "ActivityTaskScheduled" {
+		t.Errorf("expected event 5 to be reported as non-deterministic, got %v", results[0])
+	}
+}
+
+func TestEmptyHistory(t *testing.T) {
+	register := func(r worker.WorkflowRegistry) {
+		r.RegisterWorkflow(helloworld.Greet)
+	}
+	result, err := replay.History(&historypb.History{}, register)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Err == nil || result.Err.Error() != "history has no events" {
+		t.Errorf("expected empty history error, got %v", result)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{"events": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, err := replay.Dir(dir, register)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err == nil || results[0].String() != filepath.Join(dir, "empty.json")+": history has no events" {
+		t.Errorf("expected empty history error, got %v", results)
+	}
+}
@@ -6,27 +6,52 @@ package temporalite
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/server/common/authorization"
 	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/dynamicconfig"
+	"go.temporal.io/server/common/headers"
+	"go.temporal.io/server/common/log/tag"
+	"go.temporal.io/server/common/metrics"
+	persistenceclient "go.temporal.io/server/common/persistence/client"
+	"go.temporal.io/server/common/primitives"
+	rpcencryption "go.temporal.io/server/common/rpc/encryption"
 	"go.temporal.io/server/schema/sqlite"
 	"go.temporal.io/server/temporal"
+	"google.golang.org/grpc"
 
+	"github.com/temporalio/temporalite/internal/datadir"
+	"github.com/temporalio/temporalite/internal/dblock"
+	"github.com/temporalio/temporalite/internal/encryption"
 	"github.com/temporalio/temporalite/internal/liteconfig"
 )
 
+const modulePath = "github.com/temporalio/temporalite"
+
 // Server wraps temporal.Server.
 type Server struct {
 	internal         temporal.Server
 	ui               liteconfig.UIServer
 	frontendHostPort string
 	config           *liteconfig.Config
+	lock             *dblock.Lock
+	snapshotDir      string
+	health           *healthServer
+	frontendProxy    *frontendProxy
+	unixSocket       *frontendProxy
+	httpGateway      *httpGateway
 }
 
 type ServerOption interface {
@@ -34,7 +59,9 @@ type ServerOption interface {
 }
 
 // NewServer returns a new instance of Server.
-func NewServer(opts ...ServerOption) (*Server, error) {
+//
+// Unless persistence is disabled, the database file is locked until Stop is called.
+func NewServer(opts ...ServerOption) (_ *Server, retErr error) {
 	c, err := liteconfig.NewDefaultConfig()
 	if err != nil {
 		return nil, err
@@ -49,10 +76,94 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 		}
 	}
 
+	if err := c.ValidateAddresses(); err != nil {
+		return nil, err
+	}
+
+	if c.GRPCReflection {
+		if err := registerReflectionDescriptors(); err != nil {
+			return nil, fmt.Errorf("unable to register descriptors for gRPC reflection: %w", err)
+		}
+	}
+
+	if c.Ephemeral && c.DatabaseEncryptionKey != nil {
+		return nil, fmt.Errorf("database encryption requires a database file")
+	}
+
+	if c.DataDir != "" {
+		if c.Ephemeral {
+			return nil, fmt.Errorf("a data directory cannot be used with persistence disabled")
+		}
+		if c.DataDir, err = filepath.Abs(c.DataDir); err != nil {
+			return nil, err
+		}
+		if !c.ReadOnly {
+			if err := datadir.Dir(c.DataDir).Init(); err != nil {
+				return nil, fmt.Errorf("unable to create data directory: %w", err)
+			}
+		}
+		c.DatabaseFilePath = datadir.Dir(c.DataDir).DatabaseFile()
+	}
+
+	var (
+		interceptors []grpc.UnaryServerInterceptor
+		snapshotDir  string
+		dbPath       = c.DatabaseFilePath
+	)
+	if c.ReadOnly {
+		if c.Ephemeral {
+			return nil, fmt.Errorf("read-only mode requires a database file")
+		}
+		// The server writes to its database even when no API call mutates state (eg. to
+		// acquire shards), so it runs against a throwaway copy of the database instead.
+		if snapshotDir, err = os.MkdirTemp("", "temporalite-read-only-"); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if retErr != nil {
+				_ = os.RemoveAll(snapshotDir)
+			}
+		}()
+		snapshot := filepath.Join(snapshotDir, filepath.Base(c.DatabaseFilePath))
+		if err := snapshotDatabase(c.DatabaseFilePath, snapshot); err != nil {
+			return nil, fmt.Errorf("unable to open database in read-only mode: %w", err)
+		}
+		c.DatabaseFilePath = snapshot
+		interceptors = append(interceptors, readOnlyInterceptor)
+	}
+
 	cfg := liteconfig.Convert(c)
+	if c.ReadOnly {
+		// The read-only values replace those of the same keys, a dynamic config file would
+		// take precedence over all of them.
+		if cfg.DynamicConfigClient != nil {
+			return nil, fmt.Errorf("read-only mode cannot be used with file-based dynamic config")
+		}
+		for key, value := range readOnlyDynamicConfig {
+			WithDynamicConfigValue(key, []dynamicconfig.ConstrainedValue{{Value: value}}).apply(c)
+		}
+	}
 	sqlConfig := cfg.Persistence.DataStores[liteconfig.PersistenceStoreName].SQL
 
-	if !c.Ephemeral {
+	var lock *dblock.Lock
+	if !c.Ephemeral && !c.ReadOnly {
+		lock, err = dblock.Acquire(c.DatabaseFilePath, c.ForceDatabaseLock)
+		if err != nil {
+			return nil, fmt.Errorf("unable to lock database file %q: %w", c.DatabaseFilePath, err)
+		}
+		defer func() {
+			if retErr != nil {
+				_ = lock.Release()
+			}
+		}()
+	}
+
+	// Checked once the database is locked, a server already using it is reported as such.
+	if err := checkPorts(serverPorts(c, cfg)); err != nil {
+		return nil, err
+	}
+
+	if !c.Ephemeral && !c.ReadOnly {
 		// Apply migrations if file does not already exist
 		if _, err := os.Stat(c.DatabaseFilePath); os.IsNotExist(err) {
 			// Check if any of the parent dirs are missing
@@ -64,8 +175,48 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 			if err := sqlite.SetupSchema(sqlConfig); err != nil {
 				return nil, fmt.Errorf("error setting up schema: %w", err)
 			}
+		} else if !c.ForceDatabaseLock {
+			if err := resetClusterMembership(c.DatabaseFilePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var dataStoreFactory persistenceclient.AbstractDataStoreFactory
+	if c.DatabaseEncryptionKey != nil {
+		cipher, err := encryption.NewCipher(c.DatabaseEncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := encryption.CheckDatabase(c.DatabaseFilePath, cipher); err != nil {
+			return nil, fmt.Errorf("unable to open database file %q: %w", dbPath, err)
+		}
+		dataStoreFactory = encryption.NewDataStoreFactory(*sqlConfig, cipher)
+		cfg.Persistence.DataStores[encryption.StoreName] = config.DataStore{
+			CustomDataStoreConfig: &config.CustomDatastoreConfig{Name: encryption.StoreName},
+		}
+		cfg.Persistence.DefaultStore = encryption.StoreName
+	} else if !c.Ephemeral {
+		encrypted, err := encryption.IsEncrypted(c.DatabaseFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open database file %q: %w", dbPath, err)
+		}
+		if encrypted {
+			return nil, fmt.Errorf("unable to open database file %q: %w", dbPath, encryption.ErrKeyRequired)
+		}
+	}
+
+	if c.DataDir != "" && !c.ReadOnly {
+		versions := datadir.Versions{
+			Temporalite: moduleVersion(),
+			Server:      headers.ServerVersion,
+			Schema:      sqlite.Version,
+		}
+		if err := datadir.Dir(c.DataDir).RecordStart(versions, time.Now()); err != nil {
+			return nil, fmt.Errorf("unable to write data directory metadata: %w", err)
 		}
 	}
+
 	// Pre-create namespaces
 	var namespaces []*sqlite.NamespaceConfig
 	for _, ns := range c.Namespaces {
@@ -95,6 +246,18 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 		}),
 	}
 
+	if dataStoreFactory != nil {
+		serverOpts = append(serverOpts, temporal.WithCustomDataStoreFactory(dataStoreFactory))
+	}
+
+	if c.InterruptCh != nil {
+		serverOpts = append(serverOpts, temporal.InterruptOn(c.InterruptCh))
+	}
+
+	if len(interceptors) > 0 {
+		serverOpts = append(serverOpts, temporal.WithChainedFrontendGrpcInterceptors(interceptors...))
+	}
+
 	if len(c.DynamicConfig) > 0 {
 		// To prevent having to code fall-through semantics right now, we currently
 		// eagerly fail if dynamic config is being configured in two ways
@@ -113,30 +276,174 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 		return nil, fmt.Errorf("unable to instantiate server: %w", err)
 	}
 
+	tlsProvider, err := rpcencryption.NewTLSConfigProviderFromConfig(cfg.Global.TLS, metrics.NoopMetricsHandler, c.Logger, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS configuration: %w", err)
+	}
+	// The frontend is dialed like the system worker does, the other services like each other.
+	frontendTLS, err := tlsProvider.GetFrontendClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS configuration: %w", err)
+	}
+	internodeTLS, err := tlsProvider.GetInternodeClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS configuration: %w", err)
+	}
+
+	databaseAttrs := url.Values{"mode": {"ro"}}
+	if sqlConfig.ConnectAttributes["mode"] == "memory" {
+		databaseAttrs = url.Values{"mode": {"memory"}, "cache": {"shared"}}
+	}
+	health := &healthServer{
+		listenAddress: net.JoinHostPort(c.FrontendIP, strconv.Itoa(c.MetricsPort)),
+		metricsURL: &url.URL{
+			Scheme: "http",
+			Host:   cfg.Global.Metrics.Prometheus.ListenAddress,
+			Path:   cfg.Global.Metrics.Prometheus.HandlerPath,
+		},
+		serviceAddresses: map[string]string{
+			primitives.FrontendService: cfg.PublicClient.HostPort,
+			primitives.HistoryService:  net.JoinHostPort(cfg.Global.Membership.BroadcastAddress, strconv.Itoa(cfg.Services[primitives.HistoryService].RPC.GRPCPort)),
+			primitives.MatchingService: net.JoinHostPort(cfg.Global.Membership.BroadcastAddress, strconv.Itoa(cfg.Services[primitives.MatchingService].RPC.GRPCPort)),
+		},
+		serviceTLS: map[string]*tls.Config{
+			primitives.FrontendService: frontendTLS,
+			primitives.HistoryService:  internodeTLS,
+			primitives.MatchingService: internodeTLS,
+		},
+		databaseDSN: fmt.Sprintf("file:%s?%s", sqlConfig.DatabaseName, databaseAttrs.Encode()),
+		uiEnabled:   c.HasUI(),
+		logger:      c.Logger,
+	}
+
 	s := &Server{
 		internal:         srv,
 		ui:               c.UIServer,
 		frontendHostPort: cfg.PublicClient.HostPort,
 		config:           c,
+		lock:             lock,
+		snapshotDir:      snapshotDir,
+		health:           health,
+	}
+	if c.HTTPPort != 0 {
+		s.httpGateway = &httpGateway{
+			listenAddress:   net.JoinHostPort(c.FrontendIP, strconv.Itoa(c.HTTPPort)),
+			frontendAddress: cfg.PublicClient.HostPort,
+			clientTLS:       frontendTLS,
+			authorize:       authorization.NewAuthorizationInterceptor(claimMapper, authorizer, metrics.NoopMetricsHandler, c.Logger, nil),
+		}
+		if s.httpGateway.serverTLS, err = tlsProvider.GetFrontendServerConfig(); err != nil {
+			return nil, fmt.Errorf("unable to load TLS configuration: %w", err)
+		}
+	}
+	// Like the frontend's listener, the proxies accept connections before the server starts.
+	if c.ProxiesFrontend() {
+		frontend := cfg.Services[primitives.FrontendService].RPC
+		s.frontendProxy = &frontendProxy{
+			network: "tcp",
+			address: frontendProxyAddress(c, cfg),
+			target:  net.JoinHostPort(cfg.Global.Membership.BroadcastAddress, strconv.Itoa(frontend.GRPCPort)),
+		}
+		if err := s.frontendProxy.start(); err != nil {
+			return nil, err
+		}
+	}
+	if c.FrontendUnixSocket != "" {
+		path, err := filepath.Abs(c.FrontendUnixSocket)
+		if err != nil {
+			s.stopProxies()
+			return nil, err
+		}
+		s.unixSocket = &frontendProxy{network: "unix", address: path, target: cfg.PublicClient.HostPort}
+		if err := s.unixSocket.start(); err != nil {
+			s.stopProxies()
+			return nil, err
+		}
+		s.frontendHostPort = "unix://" + path
 	}
 
 	return s, nil
 }
 
 // Start temporal server.
+//
+// The metrics listener starts first, its /readyz endpoint reports when the server is ready.
+// With WithInterruptOn, Start returns once the server is interrupted and stopped.
 func (s *Server) Start() error {
+	if err := s.health.start(); err != nil {
+		return err
+	}
+	if s.httpGateway != nil {
+		if err := s.httpGateway.start(); err != nil {
+			s.health.stop()
+			return err
+		}
+	}
+	s.health.uiRunning.Store(true)
 	go func() {
 		if err := s.ui.Start(); err != nil {
 			panic(err)
 		}
+		s.health.uiRunning.Store(false)
 	}()
-	return s.internal.Start()
+	// A server interrupted through WithInterruptOn is running until Start returns.
+	blocking := s.config.InterruptCh != nil
+	s.health.running.Store(blocking)
+	if err := s.internal.Start(); err != nil {
+		s.health.stop()
+		if s.httpGateway != nil {
+			s.httpGateway.stop()
+		}
+		return err
+	}
+	if blocking {
+		// The Temporal services stopped on the interrupt, the rest of the server is released.
+		s.stop(false)
+		return nil
+	}
+	s.health.running.Store(true)
+	return nil
 }
 
 // Stop the server.
+//
+// A server started with WithInterruptOn stops when interrupted instead.
 func (s *Server) Stop() {
+	s.stop(true)
+}
+
+// stop releases the server, and stops the Temporal services unless they were already stopped
+// by an interrupt.
+func (s *Server) stop(services bool) {
+	s.health.stop()
+	if s.httpGateway != nil {
+		s.httpGateway.stop()
+	}
+	s.stopProxies()
+	if services {
+		s.internal.Stop()
+	}
+	if s.lock != nil {
+		if err := s.lock.Release(); err != nil {
+			s.config.Logger.Warn("Unable to remove database lock file", tag.Error(err))
+		}
+	}
+	if s.snapshotDir != "" {
+		if err := os.RemoveAll(s.snapshotDir); err != nil {
+			s.config.Logger.Warn("Unable to remove read-only database snapshot", tag.Error(err))
+		}
+	}
+	// ui-server exits the process once its listener is closed, so it is stopped last.
 	s.ui.Stop()
-	s.internal.Stop()
+}
+
+func (s *Server) stopProxies() {
+	if s.unixSocket != nil {
+		s.unixSocket.stop()
+	}
+	if s.frontendProxy != nil {
+		s.frontendProxy.stop()
+	}
 }
 
 // NewClient initializes a client ready to communicate with the Temporal
@@ -155,7 +462,14 @@ func (s *Server) NewClientWithOptions(ctx context.Context, options client.Option
 	return client.NewClient(options)
 }
 
-// FrontendHostPort returns the host:port for this server.
+// WaitReady blocks until the frontend of the server passes its gRPC health check, or ctx is
+// done. It is meant to be called while Start runs, eg. with WithInterruptOn.
+func (s *Server) WaitReady(ctx context.Context) error {
+	return s.health.waitFrontend(ctx)
+}
+
+// FrontendHostPort returns the host:port for this server, or the `unix://` address of its
+// socket when served on a Unix domain socket.
 //
 // When constructing a Temporalite client from within the same process,
 // NewClient or NewClientWithOptions should be used instead.
@@ -163,6 +477,61 @@ func (s *Server) FrontendHostPort() string {
 	return s.frontendHostPort
 }
 
+// MetricsHostPort returns the host:port of the metrics listener, which serves /metrics,
+// /healthz and /readyz. Its port is the one chosen for the server when none was configured.
+func (s *Server) MetricsHostPort() string {
+	return s.health.listenAddress
+}
+
+// HTTPHostPort returns the host:port of the HTTP API, or an empty string when it is not
+// served.
+func (s *Server) HTTPHostPort() string {
+	if s.httpGateway == nil {
+		return ""
+	}
+	return s.httpGateway.listenAddress
+}
+
+// resetClusterMembership removes the membership records left behind by the last server
+// that used the database at path.
+//
+// The records of a server stay fresh for a while after it stops, and joining a membership
+// ring through their stale addresses delays startup past the services' start timeout, eg.
+// when the server is restarted right away. It is only safe while holding the database
+// lock, which guarantees no other server is using the database: a forced lock leaves the
+// records alone since the previous server may still be running.
+func resetClusterMembership(path string) error {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", path, url.Values{"mode": {"rw"}}.Encode()))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	if _, err := db.Exec("DELETE FROM cluster_membership"); err != nil {
+		return fmt.Errorf("unable to reset cluster membership: %w", err)
+	}
+	return nil
+}
+
+// moduleVersion returns the version of the Temporalite module built into the program.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return ""
+}
+
 func timeoutFromContext(ctx context.Context, defaultTimeout time.Duration) time.Duration {
 	if deadline, ok := ctx.Deadline(); ok {
 		return deadline.Sub(time.Now())
@@ -7,6 +7,8 @@ package temporaltest_test
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
 
+	"github.com/temporalio/temporalite"
 	"github.com/temporalio/temporalite/internal/examples/helloworld"
 	"github.com/temporalio/temporalite/temporaltest"
 )
@@ -222,6 +225,43 @@ func TestSearchAttributeCacheDisabled(t *testing.T) {
 	}
 }
 
+func TestFrontendUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "temporal.sock")
+	ts := temporaltest.NewServer(temporaltest.WithT(t), temporaltest.WithTemporaliteOptions(temporalite.WithFrontendUnixSocket(socket)))
+
+	ts.NewWorker("hello_world", func(registry worker.Registry) {
+		helloworld.RegisterWorkflowsAndActivities(registry)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var result string
+	wfr, err := ts.DefaultClient().ExecuteWorkflow(ctx, client.StartWorkflowOptions{TaskQueue: "hello_world"}, helloworld.Greet, "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfr.Get(ctx, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result != "Hello world" {
+		t.Fatalf("unexpected result: %q", result)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected socket file mode %s", info.Mode())
+	}
+
+	ts.Stop()
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed on stop, got %v", err)
+	}
+}
+
 func BenchmarkRunWorkflow(b *testing.B) {
 	ts := temporaltest.NewServer()
 	defer ts.Stop()